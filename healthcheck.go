@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/Financial-Times/concept-search-api/service"
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
 	"github.com/olivere/elastic/v7"
@@ -15,21 +19,159 @@ import (
 
 const (
 	deweyURL = "https://dewey.ft.com/up-csa.html"
+
+	defaultMinDocCount   = 1000
+	defaultCanaryTerm    = "London"
+	defaultCanaryLatency = time.Second
+
+	// the criteria GTG can be configured to check
+	gtgServing       = "serving"         // the searched indices can be queried
+	gtgClusterHealth = "cluster-health"  // the cluster is reachable and not red
+	gtgClusterGreen  = "cluster-green"   // the cluster is green, an unassigned replica failing GTG
+	gtgBreaker       = "circuit-breaker" // the circuit breaker is not open, if there is one
 )
 
+// defaultGTGCriteria only take a pod out of the load balancer when it cannot serve the searches
+var defaultGTGCriteria = []string{gtgServing, gtgBreaker}
+
+type esClient interface {
+	getClusterHealth() (*elastic.ClusterHealthResponse, error)
+	getVersion() (string, error)
+	indexExists(index string) (bool, error)
+	countDocuments(index string) (int64, error)
+	canarySearch(index string, term string) (time.Duration, error)
+}
+
+// esClientWrapper checks the cluster, failing fast while the circuit breaker is open without the checks counting as
+// probes of the breaker
+type esClientWrapper struct {
+	backend service.Backend
+	breaker *service.CircuitBreaker
+}
+
+func (ec esClientWrapper) getClusterHealth() (*elastic.ClusterHealthResponse, error) {
+	if err := ec.breaker.AllowCheck(); err != nil {
+		return nil, err
+	}
+	return ec.backend.ClusterHealth(context.Background())
+}
+
+func (ec esClientWrapper) getVersion() (string, error) {
+	if err := ec.breaker.AllowCheck(); err != nil {
+		return "", err
+	}
+	return ec.backend.Version(context.Background())
+}
+
+func (ec esClientWrapper) indexExists(index string) (bool, error) {
+	if err := ec.breaker.AllowCheck(); err != nil {
+		return false, err
+	}
+	return ec.backend.IndexExists(context.Background(), index)
+}
+
+func (ec esClientWrapper) countDocuments(index string) (int64, error) {
+	if err := ec.breaker.AllowCheck(); err != nil {
+		return 0, err
+	}
+	return ec.backend.Count(context.Background(), index)
+}
+
+// canarySearch searches the aliases of the concepts of the index for the term, returning how long the search took
+func (ec esClientWrapper) canarySearch(index string, term string) (time.Duration, error) {
+	if err := ec.breaker.AllowCheck(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	_, err := ec.backend.Search(context.Background(), service.SearchRequest{
+		Index:  index,
+		Source: elastic.NewSearchSource().Size(1).Query(elastic.NewMatchQuery("aliases", term)),
+	})
+	latency := time.Since(start)
+	return latency, err
+}
+
+// searchStatus tells which indices are searched and whether their mappings suit the queries
+type searchStatus interface {
+	IndexTargets() service.IndexTargets
+	MappingStatus() service.MappingStatus
+}
+
+// clusterHealthDetails is the cluster health along with the indices currently searched and the check of their mappings
+type clusterHealthDetails struct {
+	*elastic.ClusterHealthResponse
+	Error        string                 `json:"error,omitempty"` // why the cluster health could not be read
+	IndexTargets *service.IndexTargets  `json:"indexTargets,omitempty"`
+	Mappings     *service.MappingStatus `json:"mappings,omitempty"`
+	Clusters     []service.ClusterState `json:"clusters,omitempty"`
+	Breaker      *service.BreakerStatus `json:"circuitBreaker,omitempty"`
+	Backend      backendDetails         `json:"backend"`
+}
+
+// backendDetails is the search backend along with the version of the cluster, or the error getting it
+type backendDetails struct {
+	Name    service.BackendKind `json:"name"`
+	Version string              `json:"version,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
 type esHealthService struct {
 	client     esClient
 	clientLock *sync.RWMutex
+	search     searchStatus
+	clusters   *service.Clusters // the clusters the reads fail over between, if more than one endpoint is configured
+	breaker    *service.CircuitBreaker
+	backend    service.BackendKind
+	indices    indexCheckConfig
+	gtg        []string // the criteria GTG checks
+}
+
+// indexCheckConfig sets the document count the searched indices must hold, and the canary search of the default index
+// along with the latency above which it is too slow
+type indexCheckConfig struct {
+	minDocCount   int64
+	canaryTerm    string
+	canaryLatency time.Duration
 }
 
 func (service *esHealthService) getClusterHealth() (*elastic.ClusterHealthResponse, error) {
 	return service.esClient().getClusterHealth()
 }
 
-func newEsHealthService() *esHealthService {
+func newEsHealthService(search searchStatus, clusters *service.Clusters, breaker *service.CircuitBreaker) *esHealthService {
 	return &esHealthService{
 		clientLock: &sync.RWMutex{},
+		search:     search,
+		clusters:   clusters,
+		breaker:    breaker,
+		backend:    service.Elasticsearch,
+		indices:    indexCheckConfig{minDocCount: defaultMinDocCount, canaryTerm: defaultCanaryTerm, canaryLatency: defaultCanaryLatency},
+		gtg:        defaultGTGCriteria,
+	}
+}
+
+// SetGTGCriteria sets what GTG checks, among serving, cluster-health, cluster-green and circuit-breaker
+func (service *esHealthService) SetGTGCriteria(criteria []string) error {
+	for _, criterion := range criteria {
+		switch criterion {
+		case gtgServing, gtgClusterHealth, gtgClusterGreen, gtgBreaker:
+		default:
+			return fmt.Errorf("unknown GTG criterion %q", criterion)
+		}
 	}
+	service.gtg = criteria
+	return nil
+}
+
+// SetIndexChecks sets the document count the searched indices must hold, and the term and the latency threshold of the
+// canary search
+func (service *esHealthService) SetIndexChecks(minDocCount int64, canaryTerm string, canaryLatency time.Duration) {
+	service.indices = indexCheckConfig{minDocCount: minDocCount, canaryTerm: canaryTerm, canaryLatency: canaryLatency}
+}
+
+// SetBackend selects the backend the cluster is checked with, Elasticsearch by default, it must be set before the client
+func (service *esHealthService) SetBackend(kind service.BackendKind) {
+	service.backend = kind
 }
 
 func (service *esHealthService) clusterIsHealthyCheck() fthealth.Check {
@@ -39,25 +181,71 @@ func (service *esHealthService) clusterIsHealthyCheck() fthealth.Check {
 		Name:             "Check Elasticsearch cluster health",
 		PanicGuide:       deweyURL,
 		Severity:         1,
-		TechnicalSummary: "Elasticsearch cluster is not healthy. Details on /__health-details",
+		TechnicalSummary: "Elasticsearch cluster is red or unreachable. Details on /__health-details",
 		Checker:          service.healthChecker,
 	}
 }
 
+// healthChecker fails when the cluster is red, a yellow cluster still serving every search
 func (service *esHealthService) healthChecker() (string, error) {
 	if service.esClient() != nil {
 		output, err := service.getClusterHealth()
 		if err != nil {
 			return "Cluster is not healthy: ", err
-		} else if output.Status != "green" {
-			return fmt.Sprintf("Cluster is %v", output.Status), fmt.Errorf("Cluster is %v", output.Status)
 		}
-		return "Cluster is healthy", nil
+		switch output.Status {
+		case "green":
+			return "Cluster is healthy", nil
+		case "yellow":
+			return "Cluster is yellow, degraded but serving", nil
+		}
+		return fmt.Sprintf("Cluster is %v", output.Status), fmt.Errorf("Cluster is %v", output.Status)
 	}
 
 	return "Couldn't check the cluster's health", errors.New("Couldn't establish connectivity")
 }
 
+func (service *esHealthService) clusterIsGreenCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "elasticsearch-cluster-green",
+		BusinessImpact:   "No impact while the primary shards serve the requests, but a lost node may lose data or fail searches",
+		Name:             "Check Elasticsearch cluster is green",
+		PanicGuide:       deweyURL,
+		Severity:         3,
+		TechnicalSummary: "Some replica shards of the Elasticsearch cluster are unassigned. Details on /__health-details",
+		Checker:          service.greenChecker,
+	}
+}
+
+func (service *esHealthService) greenChecker() (string, error) {
+	if service.esClient() == nil {
+		return "Couldn't check the cluster's health", errors.New("Couldn't establish connectivity")
+	}
+	output, err := service.getClusterHealth()
+	if err != nil {
+		return "Cluster is not healthy: ", err
+	}
+	if output.Status != "green" {
+		return fmt.Sprintf("Cluster is %v", output.Status), fmt.Errorf("Cluster is %v", output.Status)
+	}
+	return "Cluster is green", nil
+}
+
+// servingChecker checks the searched indices can be queried, whatever the health of the rest of the cluster
+func (service *esHealthService) servingChecker() (string, error) {
+	client := service.esClient()
+	if client == nil {
+		return "Couldn't query the indices", errors.New("Couldn't establish connectivity")
+	}
+	indices := service.searchedIndices()
+	for _, index := range indices {
+		if _, err := client.countDocuments(index); err != nil {
+			return fmt.Sprintf("Couldn't query index %v", index), err
+		}
+	}
+	return fmt.Sprintf("Indices %v can be queried", strings.Join(indices, ", ")), nil
+}
+
 func (service *esHealthService) connectivityHealthyCheck() fthealth.Check {
 	return fthealth.Check{
 		ID:               "elasticsearch-connectivity",
@@ -82,12 +270,239 @@ func (service *esHealthService) connectivityChecker() (string, error) {
 	return "Successfully connected to the cluster", nil
 }
 
+func (service *esHealthService) mappingCompatibilityCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "elasticsearch-mapping-compatibility",
+		BusinessImpact:   "Concept searches are less relevant, or find fewer concepts",
+		Name:             "Check the mappings of the searched Elasticsearch indices",
+		PanicGuide:       deweyURL,
+		Severity:         2,
+		TechnicalSummary: "Fields the queries depend on are missing from or mistyped in the mappings of the searched indices, the queries are degraded to do without them. Details on /__health-details",
+		Checker:          service.mappingChecker,
+	}
+}
+
+func (service *esHealthService) mappingChecker() (string, error) {
+	if service.search == nil {
+		return "Mappings are not checked", nil
+	}
+	status := service.search.MappingStatus()
+	if status.Checked.IsZero() {
+		return "Mappings have not been checked yet", nil
+	}
+	if status.Error != "" {
+		return "Could not check the mappings", errors.New(status.Error)
+	}
+	if len(status.Problems) > 0 {
+		problems := make([]string, 0, len(status.Problems))
+		for _, p := range status.Problems {
+			problems = append(problems, p.String())
+		}
+		msg := fmt.Sprintf("Fields are missing from or mistyped in the mappings: %v", strings.Join(problems, "; "))
+		return msg, errors.New(msg)
+	}
+	return "Mappings have all the fields the queries depend on", nil
+}
+
+// indexChecks checks that the searched indices exist and hold enough documents, and that a canary search is fast enough
+func (service *esHealthService) indexChecks() []fthealth.Check {
+	return []fthealth.Check{
+		{
+			ID:               "elasticsearch-indices-exist",
+			BusinessImpact:   "Concepts cannot be searched, listed or annotated",
+			Name:             "Check the searched Elasticsearch indices exist",
+			PanicGuide:       deweyURL,
+			Severity:         1,
+			TechnicalSummary: "An index or alias the concepts are searched in does not exist. The searched indices are on /__health-details",
+			Checker:          service.indicesExistChecker,
+		},
+		{
+			ID:               "elasticsearch-indices-document-count",
+			BusinessImpact:   "Concept searches find few or no concepts",
+			Name:             "Check the searched Elasticsearch indices hold enough concepts",
+			PanicGuide:       deweyURL,
+			Severity:         2,
+			TechnicalSummary: "A searched index holds fewer documents than expected, it may have been recreated or not fully populated",
+			Checker:          service.documentCountChecker,
+		},
+		{
+			ID:               "elasticsearch-canary-search",
+			BusinessImpact:   "Concept searches are slow or fail",
+			Name:             "Check a canary search of the default Elasticsearch index is fast enough",
+			PanicGuide:       deweyURL,
+			Severity:         2,
+			TechnicalSummary: "A search of the default index fails or takes longer than the latency threshold, the cluster may be overloaded",
+			Checker:          service.canaryChecker,
+		},
+	}
+}
+
+// searchedIndices are the indices the concepts are currently searched in
+func (service *esHealthService) searchedIndices() []string {
+	if service.search == nil {
+		return nil
+	}
+	targets := service.search.IndexTargets()
+	var indices []string
+	for _, index := range []string{targets.DefaultIndex, targets.ExtendedSearchIndex} {
+		if index != "" && (len(indices) == 0 || indices[0] != index) {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+func (service *esHealthService) indicesExistChecker() (string, error) {
+	client := service.esClient()
+	if client == nil {
+		return "Couldn't check the indices", errors.New("Couldn't establish connectivity")
+	}
+	indices := service.searchedIndices()
+	for _, index := range indices {
+		exists, err := client.indexExists(index)
+		if err != nil {
+			return fmt.Sprintf("Couldn't check whether index %v exists", index), err
+		}
+		if !exists {
+			msg := fmt.Sprintf("Index %v does not exist", index)
+			return msg, errors.New(msg)
+		}
+	}
+	return fmt.Sprintf("Indices %v exist", strings.Join(indices, ", ")), nil
+}
+
+func (service *esHealthService) documentCountChecker() (string, error) {
+	client := service.esClient()
+	if client == nil {
+		return "Couldn't count the documents of the indices", errors.New("Couldn't establish connectivity")
+	}
+	for _, index := range service.searchedIndices() {
+		count, err := client.countDocuments(index)
+		if err != nil {
+			return fmt.Sprintf("Couldn't count the documents of index %v", index), err
+		}
+		if count < service.indices.minDocCount {
+			msg := fmt.Sprintf("Index %v holds %d documents, expected at least %d", index, count, service.indices.minDocCount)
+			return msg, errors.New(msg)
+		}
+	}
+	return fmt.Sprintf("Indices hold at least %d documents each", service.indices.minDocCount), nil
+}
+
+func (service *esHealthService) canaryChecker() (string, error) {
+	client := service.esClient()
+	if client == nil {
+		return "Couldn't run the canary search", errors.New("Couldn't establish connectivity")
+	}
+	indices := service.searchedIndices()
+	if len(indices) == 0 {
+		return "No index is searched", nil
+	}
+	term := service.indices.canaryTerm
+	latency, err := client.canarySearch(indices[0], term)
+	if err != nil {
+		return fmt.Sprintf("Canary search for %q failed", term), err
+	}
+	latency = latency.Round(time.Millisecond)
+	if latency > service.indices.canaryLatency {
+		msg := fmt.Sprintf("Canary search for %q took %v, above the threshold of %v", term, latency, service.indices.canaryLatency)
+		return msg, errors.New(msg)
+	}
+	return fmt.Sprintf("Canary search for %q took %v", term, latency), nil
+}
+
+// clusterChecks checks every cluster the reads fail over between, in order of priority
+func (service *esHealthService) clusterChecks() []fthealth.Check {
+	if service.clusters == nil {
+		return nil
+	}
+	var checks []fthealth.Check
+	for i, state := range service.clusters.States() {
+		checks = append(checks, fthealth.Check{
+			ID:               fmt.Sprintf("elasticsearch-cluster-%d-health", i+1),
+			BusinessImpact:   "Reads cannot fail over to this cluster, or fail over to a lower priority cluster",
+			Name:             fmt.Sprintf("Check health of the Elasticsearch cluster %v (priority %d)", state.Endpoint, state.Priority),
+			PanicGuide:       deweyURL,
+			Severity:         2,
+			TechnicalSummary: "Elasticsearch cluster is either unreachable or red. Details on /__health-details",
+			Checker:          service.clusterChecker(i),
+		})
+	}
+	return checks
+}
+
+func (service *esHealthService) clusterChecker(i int) func() (string, error) {
+	return func() (string, error) {
+		state := service.clusters.CheckCluster(context.Background(), i)
+		if !state.Healthy {
+			return fmt.Sprintf("Cluster %v is not healthy", state.Endpoint), errors.New(state.Error)
+		}
+		if state.Active {
+			return fmt.Sprintf("Cluster %v is %v and serves the reads", state.Endpoint, state.Status), nil
+		}
+		return fmt.Sprintf("Cluster %v is %v and on standby", state.Endpoint, state.Status), nil
+	}
+}
+
+// breakerChecks checks the circuit breaker around the calls to ES, if there is one
+func (service *esHealthService) breakerChecks() []fthealth.Check {
+	if service.breaker == nil {
+		return nil
+	}
+	return []fthealth.Check{{
+		ID:               "elasticsearch-circuit-breaker",
+		BusinessImpact:   "Requests which need Elasticsearch fail fast with 503 while the breaker is open",
+		Name:             "Check the circuit breaker around the calls to Elasticsearch",
+		PanicGuide:       deweyURL,
+		Severity:         1,
+		TechnicalSummary: "Too many calls to Elasticsearch failed in a row, so the calls are stopped for a while. Details on /__health-details",
+		Checker:          service.breakerChecker,
+	}}
+}
+
+func (service *esHealthService) breakerChecker() (string, error) {
+	return breakerStatusMessage(service.breaker.Status())
+}
+
+func breakerStatusMessage(status service.BreakerStatus) (string, error) {
+	switch status.State {
+	case service.BreakerOpen:
+		msg := fmt.Sprintf("Circuit breaker is open since %v after %d failures", status.OpenedAt.Format(time.RFC3339), status.Failures)
+		return msg, fmt.Errorf("Elasticsearch circuit breaker is open: %v", status.LastError)
+	case service.BreakerHalfOpen:
+		return "Circuit breaker is half-open, probing whether Elasticsearch has recovered", nil
+	}
+	return "Circuit breaker is closed", nil
+}
+
+// GTG checks the configured criteria, by default whether the searched indices can be queried and the breaker is not open
 func (service *esHealthService) GTG() gtg.Status {
-	statusCheck := func() gtg.Status {
-		return gtgCheck(service.healthChecker)
+	var checks []gtg.StatusChecker
+	for _, criterion := range service.gtg {
+		if checker := service.gtgChecker(criterion); checker != nil {
+			checks = append(checks, func() gtg.Status {
+				return gtgCheck(checker)
+			})
+		}
 	}
 
-	return gtg.FailFastParallelCheck([]gtg.StatusChecker{statusCheck})()
+	return gtg.FailFastParallelCheck(checks)()
+}
+
+func (service *esHealthService) gtgChecker(criterion string) func() (string, error) {
+	switch criterion {
+	case gtgServing:
+		return service.servingChecker
+	case gtgClusterHealth:
+		return service.healthChecker
+	case gtgClusterGreen:
+		return service.greenChecker
+	case gtgBreaker:
+		if service.breaker != nil {
+			return service.breakerChecker
+		}
+	}
+	return nil
 }
 
 func gtgCheck(handler func() (string, error)) gtg.Status {
@@ -97,27 +512,51 @@ func gtgCheck(handler func() (string, error)) gtg.Status {
 	return gtg.Status{GoodToGo: true}
 }
 
-//HealthDetails returns the response from elasticsearch service /__health endpoint - describing the cluster health
+//HealthDetails returns the response from elasticsearch service /__health endpoint - describing the cluster health, along with the indices searched and the check of their mappings
 func (service *esHealthService) healthDetails(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")
 
-	if writer == nil || service.esClient() == nil {
-		writer.WriteHeader(http.StatusServiceUnavailable)
-		return
+	// the details are written even when the cluster health cannot be read, e.g. while the circuit breaker is open,
+	// which is when they matter most
+	details := clusterHealthDetails{Backend: backendDetails{Name: service.backend}}
+	client := service.esClient()
+	if client == nil {
+		details.Error = "Couldn't establish connectivity"
+		details.Backend.Error = details.Error
+	} else {
+		if output, err := client.getClusterHealth(); err != nil {
+			details.Error = err.Error()
+		} else {
+			details.ClusterHealthResponse = output
+		}
+		if version, err := client.getVersion(); err != nil {
+			details.Backend.Error = err.Error()
+		} else {
+			details.Backend.Version = version
+		}
 	}
-
-	output, err := service.getClusterHealth()
-	if err != nil {
-		writer.WriteHeader(http.StatusServiceUnavailable)
-		return
+	if service.search != nil {
+		targets := service.search.IndexTargets()
+		mappings := service.search.MappingStatus()
+		details.IndexTargets = &targets
+		details.Mappings = &mappings
+	}
+	if service.clusters != nil {
+		details.Clusters = service.clusters.States()
+	}
+	if service.breaker != nil {
+		breaker := service.breaker.Status()
+		details.Breaker = &breaker
 	}
 
-	var response []byte
-	response, err = json.Marshal(*output)
+	response, err := json.Marshal(details)
 	if err != nil {
 		response = []byte(err.Error())
 	}
 
+	if details.ClusterHealthResponse == nil {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
 	_, err = writer.Write(response)
 	if err != nil {
 		log.Errorf(err.Error())
@@ -127,7 +566,7 @@ func (service *esHealthService) healthDetails(writer http.ResponseWriter, req *h
 func (service *esHealthService) SetElasticClient(client *elastic.Client) {
 	service.clientLock.Lock()
 	defer service.clientLock.Unlock()
-	service.client = &esClientWrapper{elasticClient: client}
+	service.client = &esClientWrapper{backend: service.backend.New(client), breaker: service.breaker}
 }
 
 func (service *esHealthService) esClient() esClient {
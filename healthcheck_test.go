@@ -3,10 +3,14 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/stretchr/testify/assert"
 
@@ -23,7 +27,7 @@ func TestHealthDetailsHealthyCluster(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: true}
 
 	//create a responseRecorder
@@ -55,6 +59,43 @@ func TestHealthDetailsHealthyCluster(t *testing.T) {
 	}
 }
 
+func TestHealthDetailsIncludesIndexTargets(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__health-details", nil)
+
+	healthService := newEsHealthService(service.NewEsConceptSearchService("concepts-v2", "all-concepts-v2", 50, 1000, 10), nil, nil)
+	healthService.client = hcClient{healthy: true}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthService.healthDetails).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var respObject struct {
+		Status       string               `json:"status"`
+		IndexTargets service.IndexTargets `json:"indexTargets"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, "green", respObject.Status)
+	assert.Equal(t, service.IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts-v2"}, respObject.IndexTargets)
+}
+
+func TestHealthDetailsIncludesBackend(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__health-details", nil)
+
+	healthService := newEsHealthService(nil, nil, nil)
+	healthService.SetBackend(service.OpenSearch)
+	healthService.client = hcClient{healthy: true, version: "2.11.0"}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthService.healthDetails).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var respObject struct {
+		Backend backendDetails `json:"backend"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, backendDetails{Name: service.OpenSearch, Version: "2.11.0"}, respObject.Backend)
+}
+
 func TestHealthDetailsReturnsError(t *testing.T) {
 
 	//create a request to pass to our handler
@@ -62,7 +103,7 @@ func TestHealthDetailsReturnsError(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{returnError: errors.New("test error")}
 
 	//create a responseRecorder
@@ -84,16 +125,17 @@ func TestHealthDetailsReturnsError(t *testing.T) {
 			contentType, "application/json")
 	}
 
-	if rr.Body.Bytes() != nil {
-		t.Error("Response body should be empty")
-	}
+	var respObject map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, "test error", respObject["error"])
+	assert.NotContains(t, respObject, "status", "the cluster health is unknown")
 }
 
 func TestGTGUnhealthyCluster(t *testing.T) {
 	//create a request to pass to our handler
 	req := httptest.NewRequest("GET", "/__gtg", nil)
 
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts"}}, nil, nil)
 	healthService.client = hcClient{returnError: errors.New("test error")}
 	//create a responseRecorder
 	rr := httptest.NewRecorder()
@@ -113,7 +155,7 @@ func TestGTGUnhealthyCluster(t *testing.T) {
 func TestGTGHealthyCluster(t *testing.T) {
 	//create a request to pass to our handler
 	req := httptest.NewRequest("GET", "/__gtg", nil)
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: true}
 	//create a responseRecorder
 	rr := httptest.NewRecorder()
@@ -130,8 +172,53 @@ func TestGTGHealthyCluster(t *testing.T) {
 	assert.Equal(t, "OK", rr.Body.String(), "GTG response body")
 }
 
+func TestGTGYellowCluster(t *testing.T) {
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"}}, nil, nil)
+	healthService.client = hcClient{status: "yellow"}
+
+	assert.True(t, healthService.GTG().GoodToGo, "a yellow cluster still serves the searches")
+
+	assert.NoError(t, healthService.SetGTGCriteria([]string{"serving", "cluster-green"}))
+	gtgStatus := healthService.GTG()
+	assert.False(t, gtgStatus.GoodToGo)
+	assert.Equal(t, "Cluster is yellow", gtgStatus.Message)
+}
+
+func TestGTGNotServing(t *testing.T) {
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"}}, nil, nil)
+	healthService.client = hcClient{healthy: true, missingIndex: "all-concepts"}
+
+	gtgStatus := healthService.GTG()
+	assert.False(t, gtgStatus.GoodToGo)
+	assert.Equal(t, "no such index [all-concepts]", gtgStatus.Message)
+
+	assert.NoError(t, healthService.SetGTGCriteria([]string{"cluster-health"}))
+	assert.True(t, healthService.GTG().GoodToGo)
+}
+
+func TestGTGRedCluster(t *testing.T) {
+	healthService := newEsHealthService(nil, nil, nil)
+	healthService.client = hcClient{healthy: false}
+
+	assert.True(t, healthService.GTG().GoodToGo, "no searched index is red")
+
+	assert.NoError(t, healthService.SetGTGCriteria([]string{"cluster-health"}))
+	gtgStatus := healthService.GTG()
+	assert.False(t, gtgStatus.GoodToGo)
+	assert.Equal(t, "Cluster is red", gtgStatus.Message)
+}
+
+func TestSetUnknownGTGCriterion(t *testing.T) {
+	healthService := newEsHealthService(nil, nil, nil)
+
+	err := healthService.SetGTGCriteria([]string{"serving", "latency"})
+
+	assert.EqualError(t, err, `unknown GTG criterion "latency"`)
+	assert.Equal(t, []string{"serving", "circuit-breaker"}, healthService.gtg)
+}
+
 func TestHealthServiceConnectivityChecker(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: true}
 	hc := healthService.connectivityHealthyCheck()
 
@@ -144,7 +231,7 @@ func TestHealthServiceConnectivityChecker(t *testing.T) {
 }
 
 func TestHealthServiceConnectivityCheckerForFailedConnection(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{returnError: errors.New("test error")}
 	message, err := healthService.connectivityChecker()
 
@@ -153,7 +240,7 @@ func TestHealthServiceConnectivityCheckerForFailedConnection(t *testing.T) {
 }
 
 func TestHealthServiceConnectivityCheckerNilClient(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 
 	_, err := healthService.connectivityChecker()
 
@@ -162,7 +249,7 @@ func TestHealthServiceConnectivityCheckerNilClient(t *testing.T) {
 }
 
 func TestHealthServiceHealthCheckerNilClient(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 
 	_, err := healthService.healthChecker()
 
@@ -171,7 +258,7 @@ func TestHealthServiceHealthCheckerNilClient(t *testing.T) {
 }
 
 func TestHealthServiceHealthCheckerNotHealthyClient(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: false}
 
 	message, err := healthService.healthChecker()
@@ -187,7 +274,7 @@ func TestHealthDetailsNilClient(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 
 	//create a responseRecorder
 	rr := httptest.NewRecorder()
@@ -208,13 +295,13 @@ func TestHealthDetailsNilClient(t *testing.T) {
 			contentType, "application/json")
 	}
 
-	if rr.Body.Bytes() != nil {
-		t.Error("Response body should be empty")
-	}
+	var respObject map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, "Couldn't establish connectivity", respObject["error"])
 }
 
 func TestClusterIsHealthyChecker(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: true}
 	hc := healthService.clusterIsHealthyCheck()
 
@@ -227,7 +314,7 @@ func TestClusterIsHealthyChecker(t *testing.T) {
 }
 
 func TestClusterIsHealthyCheckerError(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	expectedError := errors.New("test error")
 	healthService.client = hcClient{healthy: false, returnError: expectedError}
 	hc := healthService.clusterIsHealthyCheck()
@@ -240,8 +327,50 @@ func TestClusterIsHealthyCheckerError(t *testing.T) {
 	assert.Error(t, expectedError, err)
 }
 
+func TestClusterIsHealthyCheckerYellow(t *testing.T) {
+	healthService := newEsHealthService(nil, nil, nil)
+	healthService.client = hcClient{status: "yellow"}
+
+	message, err := healthService.clusterIsHealthyCheck().Checker()
+
+	assert.Equal(t, "Cluster is yellow, degraded but serving", message)
+	assert.NoError(t, err)
+}
+
+func TestClusterIsGreenChecker(t *testing.T) {
+	testCases := map[string]struct {
+		client          hcClient
+		expectedMessage string
+		expectedError   bool
+	}{
+		"green":  {client: hcClient{healthy: true}, expectedMessage: "Cluster is green"},
+		"yellow": {client: hcClient{status: "yellow"}, expectedMessage: "Cluster is yellow", expectedError: true},
+		"red":    {client: hcClient{healthy: false}, expectedMessage: "Cluster is red", expectedError: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			healthService := newEsHealthService(nil, nil, nil)
+			healthService.client = tc.client
+			hc := healthService.clusterIsGreenCheck()
+
+			assert.Equal(t, "elasticsearch-cluster-green", hc.ID, "healthcheck id")
+			assert.Equal(t, uint8(3), hc.Severity)
+
+			message, err := hc.Checker()
+
+			assert.Equal(t, tc.expectedMessage, message)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestClusterIsHealthyCheckerNotHealthy(t *testing.T) {
-	healthService := newEsHealthService()
+	healthService := newEsHealthService(nil, nil, nil)
 	healthService.client = hcClient{healthy: false}
 	hc := healthService.clusterIsHealthyCheck()
 
@@ -253,9 +382,279 @@ func TestClusterIsHealthyCheckerNotHealthy(t *testing.T) {
 	assert.EqualError(t, err, "Cluster is red")
 }
 
+func TestMappingCompatibilityChecker(t *testing.T) {
+	testCases := map[string]struct {
+		status          service.MappingStatus
+		expectedMessage string
+		expectedError   bool
+	}{
+		"not checked yet": {
+			status:          service.MappingStatus{},
+			expectedMessage: "Mappings have not been checked yet",
+		},
+		"compatible": {
+			status:          service.MappingStatus{Checked: time.Now()},
+			expectedMessage: "Mappings have all the fields the queries depend on",
+		},
+		"incompatible": {
+			status: service.MappingStatus{Checked: time.Now(), Problems: []service.FieldProblem{
+				{Index: "concepts", Field: "prefLabel.edge_ngram", Problem: "missing from concepts-000001"},
+				{Index: "concepts", Field: "metrics.annotationsCount", Problem: "mapped as text in concepts-000001, expected long"},
+			}},
+			expectedMessage: "Fields are missing from or mistyped in the mappings: prefLabel.edge_ngram in concepts: missing from concepts-000001; metrics.annotationsCount in concepts: mapped as text in concepts-000001, expected long",
+			expectedError:   true,
+		},
+		"check failure": {
+			status:          service.MappingStatus{Checked: time.Now(), Error: "no mapping found for index concepts"},
+			expectedMessage: "Could not check the mappings",
+			expectedError:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			healthService := newEsHealthService(stubSearchStatus{mappings: tc.status}, nil, nil)
+			hc := healthService.mappingCompatibilityCheck()
+
+			assert.Equal(t, "elasticsearch-mapping-compatibility", hc.ID, "healthcheck id")
+
+			message, err := hc.Checker()
+
+			assert.Equal(t, tc.expectedMessage, message)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIndexChecks(t *testing.T) {
+	targets := service.IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"}
+	testCases := map[string]struct {
+		client          hcClient
+		check           int
+		expectedMessage string
+		expectedError   bool
+	}{
+		"indices exist": {
+			client:          hcClient{healthy: true},
+			check:           0,
+			expectedMessage: "Indices concepts, all-concepts exist",
+		},
+		"missing index": {
+			client:          hcClient{healthy: true, missingIndex: "all-concepts"},
+			check:           0,
+			expectedMessage: "Index all-concepts does not exist",
+			expectedError:   true,
+		},
+		"enough documents": {
+			client:          hcClient{healthy: true, docCount: 5000},
+			check:           1,
+			expectedMessage: "Indices hold at least 1000 documents each",
+		},
+		"too few documents": {
+			client:          hcClient{healthy: true, docCount: 12},
+			check:           1,
+			expectedMessage: "Index concepts holds 12 documents, expected at least 1000",
+			expectedError:   true,
+		},
+		"fast canary search": {
+			client:          hcClient{healthy: true, canaryLatency: 120 * time.Millisecond},
+			check:           2,
+			expectedMessage: `Canary search for "London" took 120ms`,
+		},
+		"slow canary search": {
+			client:          hcClient{healthy: true, canaryLatency: 1500 * time.Millisecond},
+			check:           2,
+			expectedMessage: `Canary search for "London" took 1.5s, above the threshold of 1s`,
+			expectedError:   true,
+		},
+		"failed canary search": {
+			client:          hcClient{returnError: errors.New("test error")},
+			check:           2,
+			expectedMessage: `Canary search for "London" failed`,
+			expectedError:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			healthService := newEsHealthService(stubSearchStatus{targets: targets}, nil, nil)
+			healthService.client = tc.client
+			checks := healthService.indexChecks()
+
+			assert.Equal(t, []string{"elasticsearch-indices-exist", "elasticsearch-indices-document-count", "elasticsearch-canary-search"},
+				[]string{checks[0].ID, checks[1].ID, checks[2].ID})
+
+			message, err := checks[tc.check].Checker()
+
+			assert.Equal(t, tc.expectedMessage, message)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIndexChecksWithConfiguredThresholds(t *testing.T) {
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts"}}, nil, nil)
+	healthService.SetIndexChecks(10, "Paris", 100*time.Millisecond)
+	healthService.client = hcClient{healthy: true, docCount: 12, canaryLatency: 120 * time.Millisecond}
+	checks := healthService.indexChecks()
+
+	_, err := checks[1].Checker()
+	assert.NoError(t, err)
+
+	_, err = checks[2].Checker()
+	assert.EqualError(t, err, `Canary search for "Paris" took 120ms, above the threshold of 100ms`)
+}
+
+func TestIndexChecksNilClient(t *testing.T) {
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts"}}, nil, nil)
+
+	for _, check := range healthService.indexChecks() {
+		_, err := check.Checker()
+		assert.EqualError(t, err, "Couldn't establish connectivity", check.ID)
+	}
+}
+
+func TestClusterChecks(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cluster unavailable", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"cluster_name":"secondary","status":"yellow"}`))
+	}))
+	defer secondary.Close()
+	endpoints, err := service.ParseEndpoints([]string{primary.URL, secondary.URL}, "http")
+	assert.NoError(t, err)
+
+	clusters, err := service.NewClusters(endpoints, service.DefaultHTTPConfig(), service.ESAuth{}, time.Second)
+	assert.NoError(t, err)
+
+	healthService := newEsHealthService(nil, clusters, nil)
+	checks := healthService.clusterChecks()
+
+	assert.Len(t, checks, 2)
+	assert.Equal(t, "elasticsearch-cluster-1-health", checks[0].ID)
+	assert.Equal(t, "elasticsearch-cluster-2-health", checks[1].ID)
+
+	message, err := checks[0].Checker()
+	assert.Error(t, err)
+	assert.Equal(t, "Cluster "+strings.TrimPrefix(primary.URL, "http://")+" is not healthy", message)
+
+	message, err = checks[1].Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Cluster "+strings.TrimPrefix(secondary.URL, "http://")+" is yellow and serves the reads", message)
+}
+
+func TestNoClusterChecksForSingleEndpoint(t *testing.T) {
+	healthService := newEsHealthService(nil, nil, nil)
+
+	assert.Empty(t, healthService.clusterChecks())
+}
+
+func TestBreakerChecks(t *testing.T) {
+	breaker := service.NewCircuitBreaker(1, time.Minute, 1)
+	healthService := newEsHealthService(nil, nil, breaker)
+	healthService.client = hcClient{healthy: true}
+
+	checks := healthService.breakerChecks()
+	assert.Len(t, checks, 1)
+	assert.Equal(t, "elasticsearch-circuit-breaker", checks[0].ID)
+	message, err := checks[0].Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Circuit breaker is closed", message)
+	assert.True(t, healthService.GTG().GoodToGo)
+
+	done, err := breaker.Allow()
+	assert.NoError(t, err)
+	done(errors.New("connection refused"))
+
+	message, err = checks[0].Checker()
+	assert.Error(t, err)
+	assert.Contains(t, message, "Circuit breaker is open since")
+	gtgStatus := healthService.GTG()
+	assert.False(t, gtgStatus.GoodToGo)
+	assert.Equal(t, "Elasticsearch circuit breaker is open: connection refused", gtgStatus.Message)
+}
+
+func TestHealthDetailsIncludesBreaker(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__health-details", nil)
+	healthService := newEsHealthService(nil, nil, service.NewCircuitBreaker(5, time.Minute, 1))
+	healthService.client = hcClient{healthy: true}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthService.healthDetails).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var respObject struct {
+		Breaker service.BreakerStatus `json:"circuitBreaker"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, service.BreakerClosed, respObject.Breaker.State)
+}
+
+func TestHealthDetailsWithOpenBreaker(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__health-details", nil)
+	breaker := service.NewCircuitBreaker(1, time.Minute, 1)
+	done, err := breaker.Allow()
+	assert.NoError(t, err)
+	done(errors.New("connection refused"))
+	healthService := newEsHealthService(stubSearchStatus{targets: service.IndexTargets{DefaultIndex: "concepts"}}, nil, breaker)
+	healthService.client = hcClient{returnError: util.ErrCircuitOpen}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(healthService.healthDetails).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	var respObject struct {
+		Error        string                `json:"error"`
+		IndexTargets service.IndexTargets  `json:"indexTargets"`
+		Breaker      service.BreakerStatus `json:"circuitBreaker"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &respObject))
+	assert.Equal(t, util.ErrCircuitOpen.Error(), respObject.Error)
+	assert.Equal(t, "concepts", respObject.IndexTargets.DefaultIndex)
+	assert.Equal(t, service.BreakerOpen, respObject.Breaker.State)
+	assert.Equal(t, "connection refused", respObject.Breaker.LastError)
+}
+
+func TestNoBreakerChecksWithoutBreaker(t *testing.T) {
+	healthService := newEsHealthService(nil, nil, nil)
+
+	assert.Empty(t, healthService.breakerChecks())
+}
+
+type stubSearchStatus struct {
+	targets  service.IndexTargets
+	mappings service.MappingStatus
+}
+
+func (s stubSearchStatus) IndexTargets() service.IndexTargets {
+	return s.targets
+}
+
+func (s stubSearchStatus) MappingStatus() service.MappingStatus {
+	return s.mappings
+}
+
 type hcClient struct {
 	healthy     bool
 	returnError error
+	version     string
+	// missingIndex does not exist, docCount is the count of the other indices
+	missingIndex  string
+	docCount      int64
+	canaryLatency time.Duration
+	// status overrides the status of the healthy flag, e.g. yellow
+	status string
 }
 
 func (c hcClient) query(indexName string, query elastic.Query, resultLimit int) (*elastic.SearchResult, error) {
@@ -270,9 +669,43 @@ func (c hcClient) getClusterHealth() (*elastic.ClusterHealthResponse, error) {
 	if c.returnError != nil {
 		return nil, c.returnError
 	}
+	if c.status != "" {
+		return &elastic.ClusterHealthResponse{Status: c.status}, nil
+	}
 	if c.healthy {
 		return &elastic.ClusterHealthResponse{Status: "green"}, nil
 	}
 	return &elastic.ClusterHealthResponse{Status: "red"}, nil
 
 }
+
+func (c hcClient) getVersion() (string, error) {
+	if c.returnError != nil {
+		return "", c.returnError
+	}
+	return c.version, nil
+}
+
+func (c hcClient) indexExists(index string) (bool, error) {
+	if c.returnError != nil {
+		return false, c.returnError
+	}
+	return index != c.missingIndex, nil
+}
+
+func (c hcClient) countDocuments(index string) (int64, error) {
+	if c.returnError != nil {
+		return 0, c.returnError
+	}
+	if index == c.missingIndex {
+		return 0, fmt.Errorf("no such index [%v]", index)
+	}
+	return c.docCount, nil
+}
+
+func (c hcClient) canarySearch(index string, term string) (time.Duration, error) {
+	if c.returnError != nil {
+		return 0, c.returnError
+	}
+	return c.canaryLatency, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"time"
@@ -8,10 +9,11 @@ import (
 	"github.com/Financial-Times/api-endpoint"
 	"github.com/Financial-Times/concept-search-api/resources"
 	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/http-handlers-go/httphandlers"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/husobee/vestigo"
 	cli "github.com/jawher/mow.cli"
 	"github.com/rcrowley/go-metrics"
@@ -38,12 +40,114 @@ func main() {
 		Desc:   "ES region",
 		EnvVar: "ELASTICSEARCH_REGION",
 	})
+	esEndpoints := app.Strings(cli.StringsOpt{
+		Name:   "elasticsearch-endpoints",
+		Value:  nil,
+		Desc:   "ES endpoints to fail over reads between, each optionally followed by ;priority=N (lowest first) and ;region=R, e.g. https://primary.example.com,https://dr.example.com;priority=2. Overrides elasticsearch-endpoint if set",
+		EnvVar: "ELASTICSEARCH_ENDPOINTS",
+	})
+	esFailoverTimeout := app.String(cli.StringOpt{
+		Name:   "elasticsearch-failover-timeout",
+		Value:  "5s",
+		Desc:   "How long a request to an ES cluster can take before it is failed over to the next of the elasticsearch-endpoints",
+		EnvVar: "ELASTICSEARCH_FAILOVER_TIMEOUT",
+	})
+	esDialTimeout := app.String(cli.StringOpt{
+		Name:   "elasticsearch-dial-timeout",
+		Value:  "5s",
+		Desc:   "How long connecting to ES can take",
+		EnvVar: "ELASTICSEARCH_DIAL_TIMEOUT",
+	})
+	esTLSHandshakeTimeout := app.String(cli.StringOpt{
+		Name:   "elasticsearch-tls-handshake-timeout",
+		Value:  "10s",
+		Desc:   "How long the TLS handshake with ES can take",
+		EnvVar: "ELASTICSEARCH_TLS_HANDSHAKE_TIMEOUT",
+	})
+	esResponseHeaderTimeout := app.String(cli.StringOpt{
+		Name:   "elasticsearch-response-header-timeout",
+		Value:  "30s",
+		Desc:   "How long ES can take to answer the headers of a response once the request is sent",
+		EnvVar: "ELASTICSEARCH_RESPONSE_HEADER_TIMEOUT",
+	})
+	esTimeout := app.String(cli.StringOpt{
+		Name:   "elasticsearch-timeout",
+		Value:  "60s",
+		Desc:   "How long a whole request to ES can take, including its failovers and reading the response",
+		EnvVar: "ELASTICSEARCH_TIMEOUT",
+	})
+	esMaxIdleConnsPerHost := app.Int(cli.IntOpt{
+		Name:   "elasticsearch-max-idle-conns-per-host",
+		Value:  30,
+		Desc:   "Idle connections kept open to every ES host",
+		EnvVar: "ELASTICSEARCH_MAX_IDLE_CONNS_PER_HOST",
+	})
+	esMaxRetries := app.Int(cli.IntOpt{
+		Name:   "elasticsearch-max-retries",
+		Value:  0,
+		Desc:   "How many times a request to ES failing with a connection error is retried, with an exponential backoff",
+		EnvVar: "ELASTICSEARCH_MAX_RETRIES",
+	})
 	esAuth := app.String(cli.StringOpt{
 		Name:   "auth",
 		Value:  "none",
-		Desc:   "Authentication method for ES cluster (aws or none)",
+		Desc:   "Authentication method for ES cluster (aws, basic, apikey, mtls or none)",
 		EnvVar: "AUTH",
 	})
+	esUsername := app.String(cli.StringOpt{
+		Name:   "elasticsearch-username",
+		Value:  "",
+		Desc:   "Username of the basic auth",
+		EnvVar: "ELASTICSEARCH_USERNAME",
+	})
+	esPassword := app.String(cli.StringOpt{
+		Name:   "elasticsearch-password",
+		Value:  "",
+		Desc:   "Password of the basic auth",
+		EnvVar: "ELASTICSEARCH_PASSWORD",
+	})
+	esPasswordFile := app.String(cli.StringOpt{
+		Name:   "elasticsearch-password-file",
+		Value:  "",
+		Desc:   "File the password of the basic auth is read from, instead of elasticsearch-password",
+		EnvVar: "ELASTICSEARCH_PASSWORD_FILE",
+	})
+	esAPIKey := app.String(cli.StringOpt{
+		Name:   "elasticsearch-api-key",
+		Value:  "",
+		Desc:   "Encoded API key of the apikey auth",
+		EnvVar: "ELASTICSEARCH_API_KEY",
+	})
+	esAPIKeyFile := app.String(cli.StringOpt{
+		Name:   "elasticsearch-api-key-file",
+		Value:  "",
+		Desc:   "File the encoded API key of the apikey auth is read from, instead of elasticsearch-api-key",
+		EnvVar: "ELASTICSEARCH_API_KEY_FILE",
+	})
+	esClientCert := app.String(cli.StringOpt{
+		Name:   "elasticsearch-client-cert",
+		Value:  "",
+		Desc:   "PEM file of the client certificate of the mtls auth",
+		EnvVar: "ELASTICSEARCH_CLIENT_CERT",
+	})
+	esClientKey := app.String(cli.StringOpt{
+		Name:   "elasticsearch-client-key",
+		Value:  "",
+		Desc:   "PEM file of the private key of the client certificate of the mtls auth",
+		EnvVar: "ELASTICSEARCH_CLIENT_KEY",
+	})
+	esCABundle := app.String(cli.StringOpt{
+		Name:   "elasticsearch-ca-bundle",
+		Value:  "",
+		Desc:   "PEM file of the CAs trusted instead of the system ones to sign the certificates of ES, with the basic, apikey, mtls or none auth",
+		EnvVar: "ELASTICSEARCH_CA_BUNDLE",
+	})
+	searchBackend := app.String(cli.StringOpt{
+		Name:   "search-backend",
+		Value:  "elasticsearch",
+		Desc:   "Search engine of the cluster (elasticsearch or opensearch)",
+		EnvVar: "SEARCH_BACKEND",
+	})
 	esDefaultIndex := app.String(cli.StringOpt{
 		Name:   "elasticsearch-default-index",
 		Value:  "concepts",
@@ -80,6 +184,78 @@ func main() {
 		Desc:   "The maximum number of autocomplete results returned",
 		EnvVar: "AUTOCOMPLETE_LIMIT",
 	})
+	conceptTypesConfig := app.String(cli.StringOpt{
+		Name:   "concept-types-config",
+		Value:  "",
+		Desc:   "Location of the JSON file configuring the searchable concept types, the built-in configuration is used if not set",
+		EnvVar: "CONCEPT_TYPES_CONFIG",
+	})
+	adminAPIKey := app.String(cli.StringOpt{
+		Name:   "admin-api-key",
+		Value:  "",
+		Desc:   "API key required in the X-Api-Key header of the admin endpoints, which are disabled if not set",
+		EnvVar: "ADMIN_API_KEY",
+	})
+	mappingRefreshInterval := app.String(cli.StringOpt{
+		Name:   "mapping-refresh-interval",
+		Value:  "5m",
+		Desc:   "How often the mappings of the searched indices are checked for the fields the queries depend on, 0 disables the check",
+		EnvVar: "MAPPING_REFRESH_INTERVAL",
+	})
+	breakerFailures := app.Int(cli.IntOpt{
+		Name:   "elasticsearch-breaker-failures",
+		Value:  5,
+		Desc:   "Consecutive failed ES calls which open the circuit breaker, failing the requests fast with 503, 0 disables the breaker",
+		EnvVar: "ELASTICSEARCH_BREAKER_FAILURES",
+	})
+	breakerOpenDuration := app.String(cli.StringOpt{
+		Name:   "elasticsearch-breaker-open-duration",
+		Value:  "30s",
+		Desc:   "How long the circuit breaker stays open before probing whether ES has recovered",
+		EnvVar: "ELASTICSEARCH_BREAKER_OPEN_DURATION",
+	})
+	breakerProbes := app.Int(cli.IntOpt{
+		Name:   "elasticsearch-breaker-probes",
+		Value:  1,
+		Desc:   "Successful probe calls which close the circuit breaker again",
+		EnvVar: "ELASTICSEARCH_BREAKER_PROBES",
+	})
+	hedgingPercentile := app.Int(cli.IntOpt{
+		Name:   "search-hedging-percentile",
+		Value:  0,
+		Desc:   "Percentile of the recent search latencies after which a search of the search mode is sent again, taking the first response, 0 disables the hedging",
+		EnvVar: "SEARCH_HEDGING_PERCENTILE",
+	})
+	hedgingBudget := app.Int(cli.IntOpt{
+		Name:   "search-hedging-budget",
+		Value:  5,
+		Desc:   "Maximum percentage of the searches of the search mode which are hedged",
+		EnvVar: "SEARCH_HEDGING_BUDGET",
+	})
+	healthMinDocCount := app.Int(cli.IntOpt{
+		Name:   "health-min-document-count",
+		Value:  1000,
+		Desc:   "Documents each searched index must hold for its healthcheck to pass",
+		EnvVar: "HEALTH_MIN_DOCUMENT_COUNT",
+	})
+	healthCanaryTerm := app.String(cli.StringOpt{
+		Name:   "health-canary-term",
+		Value:  "London",
+		Desc:   "Term the aliases of the default index are searched for by the canary search of the healthcheck",
+		EnvVar: "HEALTH_CANARY_TERM",
+	})
+	healthCanaryLatency := app.String(cli.StringOpt{
+		Name:   "health-canary-latency-threshold",
+		Value:  "1s",
+		Desc:   "Latency above which the canary search of the healthcheck fails",
+		EnvVar: "HEALTH_CANARY_LATENCY_THRESHOLD",
+	})
+	gtgCriteria := app.Strings(cli.StringsOpt{
+		Name:   "gtg-criteria",
+		Value:  []string{"serving", "circuit-breaker"},
+		Desc:   "What GTG checks, among serving (the searched indices can be queried), cluster-health (the cluster is not red), cluster-green and circuit-breaker",
+		EnvVar: "GTG_CRITERIA",
+	})
 	esTraceLogging := app.Bool(cli.BoolOpt{
 		Name:   "elasticsearch-trace",
 		Value:  false,
@@ -92,29 +268,113 @@ func main() {
 	app.Action = func() {
 		logStartupConfig(port, esEndpoint, esAuth, esDefaultIndex, esExtendedSearchIndex, searchResultLimit, maxIdsLimit, autoCompleteResultLimit)
 
-		search := service.NewEsConceptSearchService(*esDefaultIndex, *esExtendedSearchIndex, *searchResultLimit, *maxIdsLimit, *autoCompleteResultLimit)
-		conceptFinder := newConceptFinder(*esDefaultIndex, *esExtendedSearchIndex, *searchResultLimit)
-		healthcheck := newEsHealthService()
+		if *conceptTypesConfig != "" {
+			registry, err := util.LoadTypeRegistry(*conceptTypesConfig)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to load the concept types configuration")
+			}
+			util.SetTypeRegistry(registry)
+			log.WithField("file", *conceptTypesConfig).Infof("Loaded %d concept types", len(registry.Types))
+		}
 
-		awsSession, sessionErr := session.NewSession()
-		if sessionErr != nil {
-			log.WithError(sessionErr).Fatal("Failed to initialize AWS session")
+		backend, err := service.ParseBackendKind(*searchBackend)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid search backend")
 		}
-		credValues, err := awsSession.Config.Credentials.Get()
+		search := service.NewEsConceptSearchService(*esDefaultIndex, *esExtendedSearchIndex, *searchResultLimit, *maxIdsLimit, *autoCompleteResultLimit)
+		search.SetBackend(backend)
+		conceptFinder := newConceptFinder(search)
+		refreshInterval, err := time.ParseDuration(*mappingRefreshInterval)
 		if err != nil {
-			log.WithError(err).Fatal("Failed to obtain AWS credentials values")
+			log.WithError(err).Fatal("Invalid mapping refresh interval")
+		}
+		if refreshInterval > 0 {
+			search.StartMappingRefresh(refreshInterval)
 		}
-		awsCreds := awsSession.Config.Credentials
-		log.WithField("Provider", credValues.ProviderName).Info("Establishing AWS session using authentication provider", credValues.ProviderName)
 
+		var breaker *service.CircuitBreaker
+		if *breakerFailures > 0 {
+			openDuration, err := time.ParseDuration(*breakerOpenDuration)
+			if err != nil {
+				log.WithError(err).Fatal("Invalid circuit breaker open duration")
+			}
+			breaker = service.NewCircuitBreaker(*breakerFailures, openDuration, *breakerProbes)
+			search.SetCircuitBreaker(breaker)
+		}
+
+		if *hedgingPercentile > 0 {
+			if *hedgingPercentile >= 100 || *hedgingBudget < 0 || *hedgingBudget > 100 {
+				log.Fatal("The search hedging percentile must be below 100 and its budget between 0 and 100")
+			}
+			search.SetHedger(service.NewHedger(float64(*hedgingPercentile)/100, float64(*hedgingBudget)/100))
+		}
+
+		var awsCreds *credentials.Credentials
 		if *esAuth == "aws" {
-			go service.AWSClientSetup(awsCreds, *esEndpoint, *esRegion, *esTraceLogging, time.Minute, search, conceptFinder, healthcheck)
+			awsCreds, err = service.NewAWSCredentials()
+			if err != nil {
+				log.WithError(err).Fatal("Failed to initialize AWS session")
+			}
+			credValues, err := awsCreds.Get()
+			if err != nil {
+				log.WithError(err).Fatal("Failed to obtain AWS credentials values")
+			}
+			log.WithField("Provider", credValues.ProviderName).Info("Establishing AWS session using authentication provider", credValues.ProviderName)
+		}
+
+		auth := service.ESAuth{
+			Mode:       *esAuth,
+			Username:   *esUsername,
+			Password:   service.Secret{Value: *esPassword, File: *esPasswordFile},
+			APIKey:     service.Secret{Value: *esAPIKey, File: *esAPIKeyFile},
+			ClientCert: *esClientCert,
+			ClientKey:  *esClientKey,
+			CABundle:   *esCABundle,
+		}
+		switch *esAuth {
+		case "aws", service.AuthNone, service.AuthBasic, service.AuthAPIKey, service.AuthMTLS:
+		default:
+			log.WithField("auth", *esAuth).Fatal("Unknown ES authentication method")
+		}
+		if *esAuth != "aws" {
+			if err := auth.Validate(); err != nil {
+				log.WithError(err).Fatal("Invalid ES authentication")
+			}
+		}
+
+		httpConfig := newHTTPConfig(*esDialTimeout, *esTLSHandshakeTimeout, *esResponseHeaderTimeout, *esTimeout, *esMaxIdleConnsPerHost, *esMaxRetries)
+		var clusters *service.Clusters
+		if len(*esEndpoints) > 0 {
+			clusters = newClusters(*esEndpoints, *esFailoverTimeout, *esAuth, awsCreds, *esRegion, httpConfig, auth)
+		}
+		healthcheck := newEsHealthService(search, clusters, breaker)
+		healthcheck.SetBackend(backend)
+		canaryLatency, err := time.ParseDuration(*healthCanaryLatency)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid canary search latency threshold")
+		}
+		healthcheck.SetIndexChecks(int64(*healthMinDocCount), *healthCanaryTerm, canaryLatency)
+		if err := healthcheck.SetGTGCriteria(*gtgCriteria); err != nil {
+			log.WithError(err).Fatal("Invalid GTG criteria")
+		}
+
+		if clusters != nil {
+			go service.NewFailoverClientSupervisor(clusters, *esTraceLogging, time.Second, search, healthcheck).Run(context.Background())
+		} else if *esAuth == "aws" {
+			go service.NewAWSClientSupervisor(awsCreds, *esEndpoint, *esRegion, httpConfig, *esTraceLogging, time.Second, search, healthcheck).Run(context.Background())
 		} else {
-			go service.SimpleClientSetup(*esEndpoint, *esTraceLogging, time.Minute, search, conceptFinder, healthcheck)
+			go service.NewSimpleClientSupervisor(*esEndpoint, httpConfig, auth, *esTraceLogging, time.Second, search, healthcheck).Run(context.Background())
 		}
 
 		handler := resources.NewHandler(search)
-		routeRequest(port, apiYml, conceptFinder, handler, healthcheck)
+		typeahead := resources.NewTypeaheadHandler(search)
+		var admin *resources.AdminHandler
+		if *adminAPIKey != "" {
+			admin = resources.NewAdminHandler(search, *adminAPIKey)
+		} else {
+			log.Info("No admin API key is set, the admin endpoints are disabled")
+		}
+		routeRequest(port, apiYml, conceptFinder, handler, typeahead, admin, healthcheck)
 	}
 
 	log.SetLevel(log.InfoLevel)
@@ -125,6 +385,51 @@ func main() {
 	}
 }
 
+func newHTTPConfig(dialTimeout, tlsHandshakeTimeout, responseHeaderTimeout, timeout string, maxIdleConnsPerHost int, maxRetries int) service.HTTPConfig {
+	config := service.HTTPConfig{MaxIdleConnsPerHost: maxIdleConnsPerHost, MaxRetries: maxRetries}
+	for _, d := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"dial", dialTimeout, &config.DialTimeout},
+		{"TLS handshake", tlsHandshakeTimeout, &config.TLSHandshakeTimeout},
+		{"response header", responseHeaderTimeout, &config.ResponseHeaderTimeout},
+		{"request", timeout, &config.Timeout},
+	} {
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			log.WithError(err).Fatalf("Invalid ES %s timeout", d.name)
+		}
+		*d.into = duration
+	}
+	return config
+}
+
+func newClusters(specs []string, failoverTimeout string, esAuth string, awsCreds *credentials.Credentials, region string, httpConfig service.HTTPConfig, auth service.ESAuth) *service.Clusters {
+	scheme := "http"
+	if esAuth != service.AuthNone {
+		scheme = "https"
+	}
+	endpoints, err := service.ParseEndpoints(specs, scheme)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid ES endpoints")
+	}
+	timeout, err := time.ParseDuration(failoverTimeout)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid ES failover timeout")
+	}
+
+	if esAuth == "aws" {
+		return service.NewAWSClusters(endpoints, awsCreds, region, httpConfig, timeout)
+	}
+	clusters, err := service.NewClusters(endpoints, httpConfig, auth, timeout)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid ES authentication")
+	}
+	return clusters
+}
+
 func logStartupConfig(port, esEndpoint, esAuth, esDefaultIndex *string, esExtendedSearchIndex *string, searchResultLimit *int, maxIdsLimit *int, autoCompleteResultLimit *int) {
 	log.Info("Concept Search API uses the following configurations:")
 	log.Infof("port: %v", *port)
@@ -137,10 +442,19 @@ func logStartupConfig(port, esEndpoint, esAuth, esDefaultIndex *string, esExtend
 	log.Infof("autocomplete-result-limit: %v", autoCompleteResultLimit)
 }
 
-func routeRequest(port *string, apiYml *string, conceptFinder conceptFinder, handler *resources.Handler, healthService *esHealthService) {
+func routeRequest(port *string, apiYml *string, conceptFinder *conceptFinder, handler *resources.Handler, typeahead *resources.TypeaheadHandler, admin *resources.AdminHandler, healthService *esHealthService) {
 	servicesRouter := vestigo.NewRouter()
 	servicesRouter.Post("/concept/search", conceptFinder.FindConcept)
 	servicesRouter.Get("/concepts", handler.ConceptSearch, resources.AcceptInterceptor)
+	servicesRouter.Get("/concepts/types", handler.ConceptTypes)
+	servicesRouter.Post("/concepts/annotate", handler.Annotate)
+	servicesRouter.Post("/concepts/typeahead", typeahead.CreateSession)
+	servicesRouter.Get("/concepts/typeahead/:session", typeahead.Stream)
+	servicesRouter.Post("/concepts/typeahead/:session", typeahead.UpdateQuery)
+	if admin != nil {
+		servicesRouter.Get("/__admin/indices", admin.Indices, admin.Authenticate)
+		servicesRouter.Post("/__admin/indices", admin.SwitchIndices, admin.Authenticate)
+	}
 
 	if apiYml != nil {
 		apiEndpoint, err := api.NewAPIEndpointForFile(*apiYml)
@@ -160,10 +474,12 @@ func routeRequest(port *string, apiYml *string, conceptFinder conceptFinder, han
 			SystemCode:  "up-csa",
 			Name:        "Amazon Elasticsearch Service Healthcheck",
 			Description: "Checks for AES",
-			Checks: []fthealth.Check{
+			Checks: append(append([]fthealth.Check{
 				healthService.connectivityHealthyCheck(),
 				healthService.clusterIsHealthyCheck(),
-			},
+				healthService.clusterIsGreenCheck(),
+				healthService.mappingCompatibilityCheck(),
+			}, healthService.indexChecks()...), append(healthService.breakerChecks(), healthService.clusterChecks()...)...),
 		},
 		Timeout: 10 * time.Second,
 	}
@@ -1,17 +1,16 @@
 package main
 
-import (
-	"github.com/olivere/elastic/v7"
-)
-
 type searchCriteria struct {
 	Term           *string  `json:"term"`
 	BestMatchTerms []string `json:"bestMatchTerms"`
 	ConceptTypes   []string `json:"conceptTypes"`
 	BoostType      string   `json:"boost"`
 	FilterType     string   `json:"filter"`
+	BestMatchLimit *int     `json:"bestMatchLimit"`
+	MinScore       float64  `json:"minScore"`
 }
 
+// concept is the representation of a concept in the POST /concept/search responses
 type concept struct {
 	ID                     string   `json:"id"`
 	UUID                   string   `json:"uuid"`
@@ -26,13 +25,16 @@ type concept struct {
 	IsDeprecated           bool     `json:"isDeprecated,omitempty"`
 	CountryCode            string   `json:"countryCode,omitempty"`
 	CountryOfIncorporation string   `json:"countryOfIncorporation,omitempty"`
+	ReplacedBy             string   `json:"replacedBy,omitempty"`
 }
 
 type searchResult struct {
 	Results []concept `json:"results"`
 }
 
-type multiSearchWrapper struct {
-	term          string
-	searchRequest *elastic.SearchRequest
+// bestMatchResult is the outcome of the best match search of a term, when the status of the terms is requested
+type bestMatchResult struct {
+	Status   string    `json:"status"`
+	Concepts []concept `json:"concepts"`
+	Error    string    `json:"error,omitempty"`
 }
@@ -2,16 +2,97 @@ package resources
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeJSONLD = "application/ld+json"
+	mediaTypeTurtle = "text/turtle"
+	mediaTypeCSV    = "text/csv"
+)
+
+// supportedMediaTypes are listed in order of preference, the first one being the default representation
+var supportedMediaTypes = []string{mediaTypeJSON, mediaTypeJSONLD, mediaTypeTurtle, mediaTypeCSV}
+
 func AcceptInterceptor(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		accept := r.Header.Get("Accept")
-		if accept == "" || strings.Contains(accept, "application/json") || strings.Contains(accept, "*/*") {
+		if _, ok := negotiateMediaType(r); ok {
 			f(w, r)
 			return
 		}
 		w.WriteHeader(http.StatusNotAcceptable)
 	}
 }
+
+// negotiateMediaType picks the supported media type with the highest quality in the Accept header of the request, the
+// quality of a media type being the one of the most specific range matching it. Ties are broken by the order of
+// supportedMediaTypes, whatever the order of the ranges in the header. The format=csv query parameter takes precedence
+// over the header, so that CSV exports can be downloaded from a browser.
+func negotiateMediaType(r *http.Request) (string, bool) {
+	if r.URL.Query().Get("format") == "csv" {
+		return mediaTypeCSV, true
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypeJSON, true
+	}
+
+	best := ""
+	bestQuality := 0.0
+	for _, supported := range supportedMediaTypes {
+		quality := 0.0
+		specificity := -1
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, q := parseMediaRange(mediaRange)
+			if matchesMediaRange(supported, mediaType) && rangeSpecificity(mediaType) > specificity {
+				quality = q
+				specificity = rangeSpecificity(mediaType)
+			}
+		}
+		if quality > bestQuality {
+			best = supported
+			bestQuality = quality
+		}
+	}
+	return best, best != ""
+}
+
+// rangeSpecificity ranks */* below type/* below a media type
+func rangeSpecificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	}
+	return 2
+}
+
+func parseMediaRange(mediaRange string) (string, float64) {
+	parts := strings.Split(mediaRange, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+	quality := 1.0
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err == nil {
+				quality = q
+			}
+		}
+	}
+	return mediaType, quality
+}
+
+func matchesMediaRange(mediaType string, mediaRange string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
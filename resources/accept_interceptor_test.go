@@ -115,6 +115,70 @@ func TestAcceptMultipleTypesContainingWildcard(t *testing.T) {
 	h.AssertExpectations(t)
 }
 
+func TestAcceptLinkedData(t *testing.T) {
+	for _, accept := range []string{"application/ld+json", "text/turtle", "text/*"} {
+		req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre", nil)
+		req.Header.Add("Accept", accept)
+		w := httptest.NewRecorder()
+
+		h := new(mockHttpHandler)
+		h.On("ServeHTTP", w, req).Return()
+		r := vestigo.NewRouter()
+		r.Get("/concepts", h.ServeHTTP, AcceptInterceptor)
+
+		r.ServeHTTP(w, req)
+
+		h.AssertExpectations(t)
+	}
+}
+
+func TestNegotiateMediaType(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{accept: "", expected: mediaTypeJSON, ok: true},
+		{accept: "application/json; charset=utf-8", expected: mediaTypeJSON, ok: true},
+		{accept: "*/*", expected: mediaTypeJSON, ok: true},
+		{accept: "application/ld+json", expected: mediaTypeJSONLD, ok: true},
+		{accept: "text/turtle, application/json;q=0.5", expected: mediaTypeTurtle, ok: true},
+		{accept: "application/ld+json;q=0.9, text/turtle", expected: mediaTypeTurtle, ok: true},
+		{accept: "application/json, application/ld+json", expected: mediaTypeJSON, ok: true},
+		{accept: "text/turtle, application/json", expected: mediaTypeJSON, ok: true},
+		{accept: "text/*, application/ld+json", expected: mediaTypeJSONLD, ok: true},
+		{accept: "text/*, text/turtle;q=0", expected: mediaTypeCSV, ok: true},
+		{accept: "*/*;q=0.1, text/csv", expected: mediaTypeCSV, ok: true},
+		{accept: "text/csv", expected: mediaTypeCSV, ok: true},
+		{accept: "application/xml, text/xml", ok: false},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/concepts", nil)
+		req.Header.Add("Accept", tc.accept)
+
+		actual, ok := negotiateMediaType(req)
+
+		assert.Equal(t, tc.ok, ok, "negotiated %v", tc.accept)
+		assert.Equal(t, tc.expected, actual, "media type for %v", tc.accept)
+	}
+}
+
+func TestAcceptCSVFormatParameterOverridesHeader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&format=csv", nil)
+	req.Header.Add("Accept", "application/xml")
+	w := httptest.NewRecorder()
+
+	h := new(mockHttpHandler)
+	h.On("ServeHTTP", w, req).Return()
+	r := vestigo.NewRouter()
+	r.Get("/concepts", h.ServeHTTP, AcceptInterceptor)
+
+	r.ServeHTTP(w, req)
+
+	h.AssertExpectations(t)
+}
+
 type mockHttpHandler struct {
 	mock.Mock
 }
@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
+)
+
+const apiKeyHeader = "X-Api-Key"
+
+var errInvalidAPIKey = errors.New("missing or invalid API key")
+
+// AdminHandler serves the operational endpoints, such as switching the searched indices after a reindex
+type AdminHandler struct {
+	service service.ConceptSearchService
+	apiKey  string
+}
+
+func NewAdminHandler(service service.ConceptSearchService, apiKey string) *AdminHandler {
+	return &AdminHandler{service: service, apiKey: apiKey}
+}
+
+// Authenticate only lets through the requests carrying the admin API key in their X-Api-Key header
+func (h *AdminHandler) Authenticate(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(apiKeyHeader)
+		if h.apiKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(h.apiKey)) != 1 {
+			writeHTTPError(w, req, http.StatusUnauthorized, errInvalidAPIKey)
+			return
+		}
+		f(w, req)
+	}
+}
+
+// Indices returns the indices currently searched
+func (h *AdminHandler) Indices(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", mediaTypeJSON)
+	json.NewEncoder(w).Encode(h.service.IndexTargets())
+}
+
+// SwitchIndices points the searches at other indices, the ones left out of the request body are kept
+func (h *AdminHandler) SwitchIndices(w http.ResponseWriter, req *http.Request) {
+	var targets service.IndexTargets
+	if err := json.NewDecoder(req.Body).Decode(&targets); err != nil {
+		writeHTTPError(w, req, http.StatusBadRequest, NewValidationError(util.ErrCodeInvalidRequestBody, "", fmt.Sprintf("invalid indices request: %v", err)))
+		return
+	}
+	defer req.Body.Close()
+
+	if err := h.service.SwitchIndices(req.Context(), targets); err != nil {
+		writeServiceError(w, req, err)
+		return
+	}
+	h.Indices(w, req)
+}
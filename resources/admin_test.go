@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/husobee/vestigo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminAPIKey = "secret"
+
+func doAdminCall(svc *mockConceptSearchService, req *http.Request) *http.Response {
+	admin := NewAdminHandler(svc, testAdminAPIKey)
+
+	router := vestigo.NewRouter()
+	router.Get("/__admin/indices", admin.Indices, admin.Authenticate)
+	router.Post("/__admin/indices", admin.SwitchIndices, admin.Authenticate)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestAdminIndices(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__admin/indices", nil)
+	req.Header.Set("X-Api-Key", testAdminAPIKey)
+
+	svc := &mockConceptSearchService{}
+	svc.On("IndexTargets").Return(service.IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"})
+	actual := doAdminCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+	var body service.IndexTargets
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	assert.Equal(t, service.IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"}, body)
+	svc.AssertExpectations(t)
+}
+
+func TestAdminSwitchIndices(t *testing.T) {
+	req := httptest.NewRequest("POST", "/__admin/indices", strings.NewReader(`{"defaultIndex":"concepts-v2"}`))
+	req.Header.Set("X-Api-Key", testAdminAPIKey)
+
+	svc := &mockConceptSearchService{}
+	svc.On("SwitchIndices", service.IndexTargets{DefaultIndex: "concepts-v2"}).Return(nil)
+	svc.On("IndexTargets").Return(service.IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts"})
+	actual := doAdminCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	var body service.IndexTargets
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	assert.Equal(t, service.IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts"}, body)
+	svc.AssertExpectations(t)
+}
+
+func TestAdminSwitchToMissingIndex(t *testing.T) {
+	req := httptest.NewRequest("POST", "/__admin/indices", strings.NewReader(`{"defaultIndex":"concepts-v3"}`))
+	req.Header.Set("X-Api-Key", testAdminAPIKey)
+
+	svc := &mockConceptSearchService{}
+	svc.On("SwitchIndices", service.IndexTargets{DefaultIndex: "concepts-v3"}).Return(util.NewInputError(util.ErrCodeInvalidParameter, "defaultIndex", "index concepts-v3 does not exist"))
+	actual := doAdminCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	respObject := unmarshallResponseMessage(t, actual)
+	assert.Equal(t, util.ErrCodeInvalidParameter, respObject["code"])
+	assert.Equal(t, "defaultIndex", respObject["parameter"])
+	svc.AssertExpectations(t)
+}
+
+func TestAdminSwitchIndicesFailure(t *testing.T) {
+	req := httptest.NewRequest("POST", "/__admin/indices", strings.NewReader(`{"defaultIndex":"concepts-v2"}`))
+	req.Header.Set("X-Api-Key", testAdminAPIKey)
+
+	svc := &mockConceptSearchService{}
+	svc.On("SwitchIndices", service.IndexTargets{DefaultIndex: "concepts-v2"}).Return(errors.New("computer says no"))
+	actual := doAdminCall(svc, req)
+
+	assert.Equal(t, http.StatusInternalServerError, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
+}
+
+func TestAdminSwitchIndicesInvalidBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/__admin/indices", strings.NewReader(`concepts-v2`))
+	req.Header.Set("X-Api-Key", testAdminAPIKey)
+
+	svc := &mockConceptSearchService{}
+	actual := doAdminCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	respObject := unmarshallResponseMessage(t, actual)
+	assert.Equal(t, util.ErrCodeInvalidRequestBody, respObject["code"])
+	svc.AssertExpectations(t)
+}
+
+func TestAdminRequiresAPIKey(t *testing.T) {
+	testCases := map[string]string{
+		"no key":    "",
+		"wrong key": "guess",
+	}
+
+	for name, key := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/__admin/indices", strings.NewReader(`{"defaultIndex":"concepts-v2"}`))
+			if key != "" {
+				req.Header.Set("X-Api-Key", key)
+			}
+
+			svc := &mockConceptSearchService{}
+			actual := doAdminCall(svc, req)
+
+			assert.Equal(t, http.StatusUnauthorized, actual.StatusCode, "http status")
+			respObject := unmarshallResponseMessage(t, actual)
+			assert.Equal(t, util.ErrCodeUnauthorized, respObject["code"])
+			svc.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
+)
+
+type annotateRequest struct {
+	Text         string   `json:"text"`
+	ConceptTypes []string `json:"type"`
+}
+
+type annotateResponse struct {
+	Annotations []service.Annotation `json:"annotations"`
+}
+
+// Annotate finds the concepts mentioned in the text of the request body, along with their character offsets.
+func (h *Handler) Annotate(w http.ResponseWriter, req *http.Request) {
+	var body annotateRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeHTTPError(w, req, http.StatusBadRequest, NewValidationError(util.ErrCodeInvalidRequestBody, "", fmt.Sprintf("invalid annotate request: %v", err)))
+		return
+	}
+	defer req.Body.Close()
+
+	annotations, err := h.service.AnnotateText(req.Context(), body.Text, body.ConceptTypes)
+	if err != nil {
+		writeServiceError(w, req, err)
+		return
+	}
+
+	if annotations == nil {
+		annotations = []service.Annotation{}
+	}
+	w.Header().Add("Content-Type", mediaTypeJSON)
+	json.NewEncoder(w).Encode(annotateResponse{Annotations: annotations})
+}
@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotate(t *testing.T) {
+	text := "Test Genre 1 is mentioned"
+	annotations := []service.Annotation{{Start: 0, End: 12, Text: "Test Genre 1", Concept: dummyConcepts()[0], Score: 12.5}}
+	svc := &mockConceptSearchService{}
+	svc.On("AnnotateText", text, []string(nil)).Return(annotations, nil)
+
+	req := httptest.NewRequest("POST", "/concepts/annotate", strings.NewReader(`{"text":"`+text+`"}`))
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+
+	var body map[string][]service.Annotation
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	assert.Equal(t, annotations, body["annotations"], "annotations")
+	svc.AssertExpectations(t)
+}
+
+func TestAnnotateWithTypes(t *testing.T) {
+	types := []string{"http://www.ft.com/ontology/person/Person"}
+	svc := &mockConceptSearchService{}
+	svc.On("AnnotateText", "nobody", types).Return([]service.Annotation(nil), nil)
+
+	req := httptest.NewRequest("POST", "/concepts/annotate", strings.NewReader(`{"text":"nobody","type":["http://www.ft.com/ontology/person/Person"]}`))
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+
+	var body map[string][]service.Annotation
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	assert.NotNil(t, body["annotations"], "annotations should be an empty list")
+	assert.Empty(t, body["annotations"], "annotations")
+	svc.AssertExpectations(t)
+}
+
+func TestAnnotateInvalidBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/concepts/annotate", strings.NewReader(`{"text":`))
+	actual := doHttpCall(&mockConceptSearchService{}, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	assert.Equal(t, util.ErrCodeInvalidRequestBody, unmarshallResponseMessage(t, actual)["code"], "error code")
+}
+
+func TestAnnotateInputError(t *testing.T) {
+	svc := &mockConceptSearchService{}
+	svc.On("AnnotateText", "", []string(nil)).Return([]service.Annotation(nil), util.NewInputError(util.ErrCodeMissingParameter, "text", "empty text to annotate"))
+
+	req := httptest.NewRequest("POST", "/concepts/annotate", strings.NewReader(`{}`))
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	assert.Equal(t, "text", unmarshallResponseMessage(t, actual)["parameter"], "error parameter")
+}
+
+func TestAnnotateServerError(t *testing.T) {
+	svc := &mockConceptSearchService{}
+	svc.On("AnnotateText", "text", []string(nil)).Return([]service.Annotation(nil), errors.New("test error"))
+
+	req := httptest.NewRequest("POST", "/concepts/annotate", strings.NewReader(`{"text":"text"}`))
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusInternalServerError, actual.StatusCode, "http status")
+}
@@ -0,0 +1,27 @@
+package resources
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/Financial-Times/concept-search-api/service"
+)
+
+// csvColumns is the stable column set of the CSV export, new columns should only ever be appended
+var csvColumns = []string{"id", "uuid", "prefLabel", "type", "isDeprecated", "scopeNote", "countryCode", "countryOfIncorporation", "replacedBy"}
+
+func writeCSV(w io.Writer, concepts []service.Concept) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, c := range concepts {
+		record := []string{c.Id, c.UUID, c.PrefLabel, c.ConceptType, strconv.FormatBool(c.IsDeprecated), c.ScopeNote, c.CountryCode, c.CountryOfIncorporation, c.ReplacedBy}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -1,41 +1,53 @@
 package resources
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/Financial-Times/concept-search-api/util"
 
-	"strings"
-
 	"github.com/Financial-Times/concept-search-api/service"
 	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
 )
 
+var errCSVNotSupported = NewValidationError(util.ErrCodeNotAcceptable, "format", "csv output is only supported for type listings and ids lookups")
+
 type Handler struct {
 	service service.ConceptSearchService
 }
 
 type validationError struct {
-	msg string
+	code  string
+	param string
+	msg   string
 }
 
-func NewValidationError(msg string) validationError {
-	return validationError{msg}
+func NewValidationError(code string, param string, msg string) validationError {
+	return validationError{code: code, param: param, msg: msg}
 }
 
 func (e validationError) Error() string {
 	return e.msg
 }
 
+func (e validationError) Code() string {
+	return e.code
+}
+
+func (e validationError) Parameter() string {
+	return e.param
+}
+
 func NewHandler(service service.ConceptSearchService) *Handler {
 	return &Handler{service}
 }
 
 func (h *Handler) ConceptSearch(w http.ResponseWriter, req *http.Request) {
-	response := make(map[string]interface{})
 	var err error
 	var concepts []service.Concept
+	var groups []service.ConceptGroup
 
 	mode, foundMode, modeErr := util.GetSingleValueQueryParameter(req, "mode", "search", "text")
 	q, foundQ, qErr := util.GetSingleValueQueryParameter(req, "q")
@@ -44,105 +56,154 @@ func (h *Handler) ConceptSearch(w http.ResponseWriter, req *http.Request) {
 	ids, foundIds := util.GetMultipleValueQueryParameter(req, "ids")
 	includeDeprecated, _, includeDeprecatedErr := util.GetBoolQueryParameter(req, "include_deprecated", false)
 	searchAllAuthorities, _, searchAllErr := util.GetBoolQueryParameter(req, "searchAllAuthorities", false)
+	includeSubtypes, _, includeSubtypesErr := util.GetBoolQueryParameter(req, "includeSubtypes", false)
+	directTypes, foundDirectTypes := util.GetMultipleValueQueryParameter(req, "directType")
+	followReplacements, foundFollowReplacements, followReplacementsErr := util.GetBoolQueryParameter(req, "followReplacements", false)
+	cursors, foundCursors := util.GetMultipleValueQueryParameter(req, "cursor")
 
-	err = util.FirstError(modeErr, qErr, boostTypeErr, includeDeprecatedErr, searchAllErr)
+	_, _, formatErr := util.GetSingleValueQueryParameter(req, "format", "csv")
+	err = util.FirstError(modeErr, qErr, boostTypeErr, includeDeprecatedErr, searchAllErr, includeSubtypesErr, followReplacementsErr, formatErr)
 	if err != nil {
-		writeHTTPError(w, http.StatusBadRequest, err)
+		writeHTTPError(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if mediaType, _ := negotiateMediaType(req); mediaType == mediaTypeCSV && foundMode {
+		writeHTTPError(w, req, http.StatusNotAcceptable, errCSVNotSupported)
 		return
 	}
 	if foundIds {
-		if foundBoostType || foundQ || foundConceptTypes || foundMode {
-			err = NewValidationError("invalid parameters, 'ids' cannot be combined with any other parameter")
+		if foundBoostType || foundQ || foundConceptTypes || foundMode || foundDirectTypes || foundCursors {
+			err = NewValidationError(util.ErrCodeInvalidParameter, "ids", "invalid parameters, 'ids' cannot be combined with any other parameter")
 		} else {
-			concepts, err = h.service.FindConceptsById(ids)
+			concepts, err = h.service.FindConceptsById(req.Context(), ids, followReplacements)
 		}
+	} else if foundFollowReplacements {
+		err = NewValidationError(util.ErrCodeInvalidParameter, "followReplacements", "invalid parameters, 'followReplacements' is only supported with 'ids'")
+	} else if foundCursors && (foundMode || len(conceptTypes) < 2) {
+		err = NewValidationError(util.ErrCodeInvalidParameter, "cursor", "invalid parameters, 'cursor' is only supported when listing several types")
 	} else {
 		if foundMode {
 			if !foundConceptTypes {
-				err = NewValidationError("invalid or missing parameters for concept search (require type)")
+				err = NewValidationError(util.ErrCodeMissingParameter, "type", "invalid or missing parameters for concept search (require type)")
 			} else {
 				if mode == "search" {
-					concepts, err = h.searchConcepts(foundBoostType, boostType, foundQ, q, conceptTypes, searchAllAuthorities, includeDeprecated)
+					concepts, err = h.searchConcepts(req.Context(), foundBoostType, boostType, foundQ, q, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 				} else if mode == "text" {
 					validationErr := util.ValidateConceptTypesForTextModeSearch(conceptTypes)
 					if validationErr != nil {
 						err = validationErr
 					} else {
-						concepts, err = h.searchConceptsInTextMode(foundQ, q, conceptTypes, searchAllAuthorities, includeDeprecated)
+						concepts, err = h.searchConceptsInTextMode(req.Context(), foundQ, q, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 					}
 				}
 			}
 		} else {
 			if foundQ {
-				err = NewValidationError("invalid or missing parameters for concept search (q but no mode)")
+				err = NewValidationError(util.ErrCodeMissingParameter, "mode", "invalid or missing parameters for concept search (q but no mode)")
 			} else if foundBoostType {
-				err = NewValidationError("invalid or missing parameters for concept search (boost but no mode)")
+				err = NewValidationError(util.ErrCodeMissingParameter, "mode", "invalid or missing parameters for concept search (boost but no mode)")
+			} else if len(conceptTypes) > 1 {
+				groups, err = h.service.FindAllConceptsByTypes(req.Context(), conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes, cursors)
 			} else if foundConceptTypes {
-				concepts, err = h.findConceptsByType(conceptTypes, includeDeprecated, searchAllAuthorities)
+				concepts, err = h.findConceptsByType(req.Context(), conceptTypes, includeDeprecated, searchAllAuthorities, includeSubtypes, directTypes)
 			} else {
-				err = NewValidationError("invalid or missing parameters for concept search")
+				err = NewValidationError(util.ErrCodeMissingParameter, "", "invalid or missing parameters for concept search")
 			}
 		}
 	}
 
 	if err != nil {
-		switch err.(type) {
+		writeServiceError(w, req, err)
+		return
+	}
 
-		case validationError, util.InputError:
+	if groups != nil {
+		writeConceptGroups(w, req, groups)
+		return
+	}
+	writeConcepts(w, req, concepts)
+}
 
-			writeHTTPError(w, http.StatusBadRequest, err)
+// writeServiceError maps the errors of the search service to the response status
+func writeServiceError(w http.ResponseWriter, req *http.Request, err error) {
+	switch err.(type) {
 
-		default:
-			if err == util.ErrNoElasticClient || err == elastic.ErrNoClient {
-				writeHTTPError(w, http.StatusServiceUnavailable, err)
-			} else {
-				writeHTTPError(w, http.StatusInternalServerError, err)
-			}
+	case validationError, util.InputError:
+
+		writeHTTPError(w, req, http.StatusBadRequest, err)
+
+	default:
+		if err == util.ErrNoElasticClient || err == util.ErrCircuitOpen || err == elastic.ErrNoClient {
+			writeHTTPError(w, req, http.StatusServiceUnavailable, err)
+		} else {
+			writeHTTPError(w, req, http.StatusInternalServerError, err)
 		}
-		return
 	}
+}
+
+func writeConcepts(w http.ResponseWriter, req *http.Request, concepts []service.Concept) {
+	writeConceptsAs(w, req, concepts, map[string]interface{}{"concepts": concepts})
+}
+
+// writeConceptGroups writes the concepts of a multi-type listing grouped by type in JSON. The other media types have no
+// room for the groups, so the concepts are written in the order of the groups.
+func writeConceptGroups(w http.ResponseWriter, req *http.Request, groups []service.ConceptGroup) {
+	var concepts []service.Concept
+	for _, g := range groups {
+		concepts = append(concepts, g.Concepts...)
+	}
+	writeConceptsAs(w, req, concepts, map[string]interface{}{"types": groups})
+}
+
+// writeConceptsAs writes the concepts in the negotiated media type, using the given body for JSON
+func writeConceptsAs(w http.ResponseWriter, req *http.Request, concepts []service.Concept, jsonBody interface{}) {
+	mediaType, ok := negotiateMediaType(req)
+	if !ok {
+		mediaType = mediaTypeJSON
+	}
+	w.Header().Add("Content-Type", mediaType)
+	w.Header().Add("Vary", "Accept")
 
-	response["concepts"] = concepts
-	w.Header().Add("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	var err error
+	switch mediaType {
+	case mediaTypeJSONLD:
+		err = writeJSONLD(w, concepts)
+	case mediaTypeTurtle:
+		err = writeTurtle(w, concepts)
+	case mediaTypeCSV:
+		err = writeCSV(w, concepts)
+	default:
+		err = json.NewEncoder(w).Encode(jsonBody)
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to write concepts")
+	}
 }
 
-func (h *Handler) searchConcepts(foundBoostType bool, boostType string, foundQ bool, q string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
+func (h *Handler) searchConcepts(ctx context.Context, foundBoostType bool, boostType string, foundQ bool, q string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
 	if !foundQ {
-		return nil, NewValidationError("invalid or missing parameters for concept search (require q)")
+		return nil, NewValidationError(util.ErrCodeMissingParameter, "q", "invalid or missing parameters for concept search (require q)")
 	} else if foundBoostType {
-		return h.service.SearchConceptByTextAndTypesWithBoost(q, conceptTypes, boostType, searchAllAuthorities, includeDeprecated)
+		return h.service.SearchConceptByTextAndTypesWithBoost(ctx, q, conceptTypes, boostType, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 	}
-	return h.service.SearchConceptByTextAndTypes(q, conceptTypes, searchAllAuthorities, includeDeprecated)
+	return h.service.SearchConceptByTextAndTypes(ctx, q, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
-func (h *Handler) searchConceptsInTextMode(foundQ bool, q string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
+func (h *Handler) searchConceptsInTextMode(ctx context.Context, foundQ bool, q string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
 	if !foundQ {
-		return nil, NewValidationError("invalid or missing parameters for concept search (require q)")
+		return nil, NewValidationError(util.ErrCodeMissingParameter, "q", "invalid or missing parameters for concept search (require q)")
 	}
-	return h.service.SearchConceptByTextAndTypesInTextMode(q, conceptTypes, searchAllAuthorities, includeDeprecated)
+	return h.service.SearchConceptByTextAndTypesInTextMode(ctx, q, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
-func (h *Handler) findConceptsByType(conceptTypes []string, includeDeprecated bool, searchAllAuthorities bool) ([]service.Concept, error) {
+func (h *Handler) findConceptsByType(ctx context.Context, conceptTypes []string, includeDeprecated bool, searchAllAuthorities bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
 	if len(conceptTypes) == 0 {
 		return []service.Concept{}, nil
 	}
 
-	if len(conceptTypes) > 1 {
-		return nil, NewValidationError("only a single type is supported by this kind of request")
-	}
-
-	if strings.Contains(conceptTypes[0], "PublicCompany") {
-		return h.service.FindAllConceptsByDirectType(conceptTypes[0], searchAllAuthorities, includeDeprecated)
-	}
-
-	return h.service.FindAllConceptsByType(conceptTypes[0], searchAllAuthorities, includeDeprecated)
+	return h.service.FindAllConceptsByType(ctx, conceptTypes[0], searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
-func writeHTTPError(w http.ResponseWriter, status int, err error) {
-	response := make(map[string]interface{})
-	response["message"] = err.Error()
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(response)
+func writeHTTPError(w http.ResponseWriter, req *http.Request, status int, err error) {
+	util.WriteHTTPError(w, req, status, err)
 }
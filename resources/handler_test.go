@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/concept-search-api/service"
 	"github.com/Financial-Times/concept-search-api/util"
@@ -16,33 +19,34 @@ import (
 	"github.com/olivere/elastic/v7"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 var (
-	expectedInputErr = util.NewInputError("computer says no")
+	expectedInputErr = util.NewInputError(util.ErrCodeInvalidConceptType, "type", "computer says no")
 )
 
 type mockConceptSearchService struct {
 	mock.Mock
 }
 
-func (s *mockConceptSearchService) FindAllConceptsByType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
-	args := s.Called(conceptType, searchAllAuthorities, includeDeprecated)
+func (s *mockConceptSearchService) FindAllConceptsByType(ctx context.Context, conceptType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
+	args := s.Called(conceptType, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 	return args.Get(0).([]service.Concept), args.Error(1)
 }
 
-func (s *mockConceptSearchService) FindAllConceptsByDirectType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
-	args := s.Called(conceptType, searchAllAuthorities, includeDeprecated)
-	return args.Get(0).([]service.Concept), args.Error(1)
+func (s *mockConceptSearchService) FindAllConceptsByTypes(ctx context.Context, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string, cursors []string) ([]service.ConceptGroup, error) {
+	args := s.Called(conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes, cursors)
+	return args.Get(0).([]service.ConceptGroup), args.Error(1)
 }
 
-func (s *mockConceptSearchService) FindConceptsById(ids []string) ([]service.Concept, error) {
-	args := s.Called(ids)
+func (s *mockConceptSearchService) FindConceptsById(ctx context.Context, ids []string, followReplacements bool) ([]service.Concept, error) {
+	args := s.Called(ids, followReplacements)
 	return args.Get(0).([]service.Concept), args.Error(1)
 }
 
-func (s *mockConceptSearchService) SearchConceptByTextAndTypes(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
-	args := s.Called(textQuery, conceptTypes, searchAllAuthorities, includeDeprecated)
+func (s *mockConceptSearchService) SearchConceptByTextAndTypes(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
+	args := s.Called(textQuery, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 	return args.Get(0).([]service.Concept), args.Error(1)
 }
 
@@ -50,16 +54,62 @@ func (s *mockConceptSearchService) SetElasticClient(client *elastic.Client) {
 	s.Called(client)
 }
 
-func (s *mockConceptSearchService) SearchConceptByTextAndTypesWithBoost(textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
-	args := s.Called(textQuery, conceptTypes, boostType, searchAllAuthorities, includeDeprecated)
+func (s *mockConceptSearchService) SearchConceptByTextAndTypesWithBoost(ctx context.Context, textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
+	args := s.Called(textQuery, conceptTypes, boostType, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 	return args.Get(0).([]service.Concept), args.Error(1)
 }
 
-func (s *mockConceptSearchService) SearchConceptByTextAndTypesInTextMode(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]service.Concept, error) {
-	args := s.Called(textQuery, conceptTypes, searchAllAuthorities, includeDeprecated)
+func (s *mockConceptSearchService) SearchConceptByTextAndTypesInTextMode(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
+	args := s.Called(textQuery, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 	return args.Get(0).([]service.Concept), args.Error(1)
 }
 
+func (s *mockConceptSearchService) SearchConceptsByTerm(ctx context.Context, term string, searchAllAuthorities bool, includeDeprecated bool) ([]service.ScoredConcept, error) {
+	args := s.Called(term, searchAllAuthorities, includeDeprecated)
+	return args.Get(0).([]service.ScoredConcept), args.Error(1)
+}
+
+func (s *mockConceptSearchService) FindBestMatchingConcepts(ctx context.Context, criteria service.BestMatchCriteria) (map[string]service.BestMatch, error) {
+	args := s.Called(criteria)
+	return args.Get(0).(map[string]service.BestMatch), args.Error(1)
+}
+
+func (s *mockConceptSearchService) AnnotateText(ctx context.Context, text string, conceptTypes []string) ([]service.Annotation, error) {
+	args := s.Called(text, conceptTypes)
+	return args.Get(0).([]service.Annotation), args.Error(1)
+}
+
+func (s *mockConceptSearchService) IndexTargets() service.IndexTargets {
+	args := s.Called()
+	return args.Get(0).(service.IndexTargets)
+}
+
+func (s *mockConceptSearchService) SwitchIndices(ctx context.Context, targets service.IndexTargets) error {
+	args := s.Called(targets)
+	return args.Error(0)
+}
+
+func (s *mockConceptSearchService) StartMappingRefresh(interval time.Duration) {
+	s.Called(interval)
+}
+
+func (s *mockConceptSearchService) MappingStatus() service.MappingStatus {
+	args := s.Called()
+	return args.Get(0).(service.MappingStatus)
+}
+
+func (s *mockConceptSearchService) SetCircuitBreaker(breaker *service.CircuitBreaker) {
+	s.Called(breaker)
+}
+
+func (s *mockConceptSearchService) SetHedger(hedger *service.Hedger) {
+	s.Called(hedger)
+}
+
+func (s *mockConceptSearchService) SetBackend(kind service.BackendKind) {
+	s.Called(kind)
+}
+
 func dummyConcepts() []service.Concept {
 	return []service.Concept{
 		{
@@ -105,7 +155,7 @@ func TestAllConceptsByType(t *testing.T) {
 
 	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -118,12 +168,81 @@ func TestAllConceptsByType(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(respObject["concepts"], concepts))
 }
 
+func TestAllConceptsByTypeAsJSONLD(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre", nil)
+	req.Header.Add("Accept", "application/ld+json")
+
+	concepts := dummyConcepts()
+	concepts[0].Aliases = []string{"Test Genre 1", "Genre One"}
+	concepts[0].ScopeNote = "The first genre"
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "application/ld+json", actual.Header.Get("Content-Type"), "content-type")
+
+	body, _ := ioutil.ReadAll(actual.Body)
+	assert.JSONEq(t, `{
+		"@context": {
+			"skos": "http://www.w3.org/2004/02/skos/core#",
+			"prefLabel": "skos:prefLabel",
+			"altLabel": "skos:altLabel",
+			"scopeNote": "skos:scopeNote"
+		},
+		"@graph": [
+			{
+				"@id": "http://api.ft.com/things/1",
+				"@type": ["skos:Concept", "http://www.ft.com/ontology/Genre"],
+				"prefLabel": "Test Genre 1",
+				"altLabel": ["Genre One"],
+				"scopeNote": "The first genre"
+			},
+			{
+				"@id": "http://api.ft.com/things/2",
+				"@type": ["skos:Concept", "http://www.ft.com/ontology/Genre"],
+				"prefLabel": "Test Genre 2"
+			}
+		]
+	}`, string(body))
+}
+
+func TestAllConceptsByTypeAsTurtle(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre", nil)
+	req.Header.Add("Accept", "text/turtle")
+
+	concepts := dummyConcepts()
+	concepts[0].Aliases = []string{"Genre One", "Genre \"1\""}
+	concepts[0].ScopeNote = "The first genre"
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "text/turtle", actual.Header.Get("Content-Type"), "content-type")
+
+	body, _ := ioutil.ReadAll(actual.Body)
+	expected := `@prefix skos: <http://www.w3.org/2004/02/skos/core#> .
+
+<http://api.ft.com/things/1> a skos:Concept, <http://www.ft.com/ontology/Genre> ;
+	skos:prefLabel "Test Genre 1" ;
+	skos:altLabel "Genre One", "Genre \"1\"" ;
+	skos:scopeNote "The first genre" .
+
+<http://api.ft.com/things/2> a skos:Concept, <http://www.ft.com/ontology/Genre> ;
+	skos:prefLabel "Test Genre 2" .
+`
+	assert.Equal(t, expected, string(body))
+}
+
 func TestAllConceptsByTypeIncludeAllAuthorities(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&searchAllAuthorities=true", nil)
 
 	concepts := dummyAllAutoritiesConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", true, mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", true, mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -139,7 +258,7 @@ func TestAllConceptsByTypeIncludeAllAuthorities(t *testing.T) {
 func TestAllConceptsByTypeInputError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FFoo", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, expectedInputErr)
+	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, expectedInputErr)
 
 	actual := doHttpCall(svc, req)
 
@@ -149,12 +268,32 @@ func TestAllConceptsByTypeInputError(t *testing.T) {
 	respObject := unmarshallResponseMessage(t, actual)
 
 	assert.Equal(t, expectedInputErr.Error(), respObject["message"], "error message")
+	assert.Equal(t, util.ErrCodeInvalidConceptType, respObject["code"], "error code")
+	assert.Equal(t, "type", respObject["parameter"], "error parameter")
+	assert.NotEmpty(t, respObject["transactionId"], "transaction id")
+}
+
+func TestErrorResponseCarriesRequestTransactionID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?ids=1&q=test", nil)
+	req.Header.Set("X-Request-Id", "tid_test")
+	svc := &mockConceptSearchService{}
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+
+	respObject := unmarshallResponseMessage(t, actual)
+
+	assert.Equal(t, util.ErrCodeInvalidParameter, respObject["code"], "error code")
+	assert.Equal(t, "ids", respObject["parameter"], "error parameter")
+	assert.Equal(t, "tid_test", respObject["transactionId"], "transaction id")
+	svc.AssertExpectations(t)
 }
 
 func TestAllConceptByTypeNoElasticsearchError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FFoo", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, elastic.ErrNoClient)
+	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, elastic.ErrNoClient)
 
 	actual := doHttpCall(svc, req)
 
@@ -169,7 +308,7 @@ func TestAllConceptByTypeNoElasticsearchError(t *testing.T) {
 func TestAllConceptByTypeNoElasticsearchClientError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FFoo", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, util.ErrNoElasticClient)
+	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, util.ErrNoElasticClient)
 
 	actual := doHttpCall(svc, req)
 
@@ -179,6 +318,22 @@ func TestAllConceptByTypeNoElasticsearchClientError(t *testing.T) {
 	respObject := unmarshallResponseMessage(t, actual)
 
 	assert.Equal(t, util.ErrNoElasticClient.Error(), respObject["message"], "error message")
+	assert.Equal(t, util.ErrCodeESUnavailable, respObject["code"], "error code")
+}
+
+func TestAllConceptByTypeCircuitOpenError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre", nil)
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, util.ErrCircuitOpen)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, actual.StatusCode, "http status")
+
+	respObject := unmarshallResponseMessage(t, actual)
+
+	assert.Equal(t, util.ErrCircuitOpen.Error(), respObject["message"], "error message")
+	assert.Equal(t, util.ErrCodeESUnavailable, respObject["code"], "error code")
 }
 
 func TestAllConceptByTypeServerError(t *testing.T) {
@@ -186,7 +341,7 @@ func TestAllConceptByTypeServerError(t *testing.T) {
 
 	expectedError := errors.New("Test error")
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, expectedError)
+	svc.On("FindAllConceptsByType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, expectedError)
 
 	actual := doHttpCall(svc, req)
 
@@ -198,12 +353,12 @@ func TestAllConceptByTypeServerError(t *testing.T) {
 	assert.Equal(t, expectedError.Error(), respObject["message"], "error message")
 }
 
-func TestAllConceptsByDirectType(t *testing.T) {
+func TestAllConceptsByTypeMatchedOnDirectType(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPublicCompany", nil)
 
 	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", "http://www.ft.com/ontology/company/PublicCompany", mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/company/PublicCompany", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -216,12 +371,12 @@ func TestAllConceptsByDirectType(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(respObject["concepts"], concepts))
 }
 
-func TestAllConceptsByDirectTypeIncludeAllAuthorities(t *testing.T) {
+func TestAllConceptsByTypeMatchedOnDirectTypeIncludeAllAuthorities(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPublicCompany&searchAllAuthorities=true", nil)
 
 	concepts := dummyAllAutoritiesConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", "http://www.ft.com/ontology/company/PublicCompany", true, mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/company/PublicCompany", true, mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -234,66 +389,90 @@ func TestAllConceptsByDirectTypeIncludeAllAuthorities(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(respObject["concepts"], concepts))
 }
 
-func TestAllConceptsByDirectTypeIncorrectParam(t *testing.T) {
-	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2FPublicCompany", nil)
+func TestAllConceptsByTypeIncludingSubtypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FCompany&includeSubtypes=true", nil)
+
+	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, expectedInputErr)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/company/Company", false, false, true, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
-	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
-	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	respObject := unmarshallResponse(t, actual)
+	assert.Len(t, respObject["concepts"], 2, "concepts")
+	svc.AssertExpectations(t)
+}
 
-	respObject := unmarshallResponseMessage(t, actual)
+func TestConceptSearchIncludingSubtypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FCompany&mode=search&q=pippo&includeSubtypes=true", nil)
 
-	assert.Equal(t, expectedInputErr.Error(), respObject["message"], "error message")
+	svc := &mockConceptSearchService{}
+	svc.On("SearchConceptByTextAndTypes", "pippo", []string{"http://www.ft.com/ontology/company/Company"}, false, false, true, []string(nil)).Return(dummyConcepts(), nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
 }
 
-func TestAllConceptsByDirectTypeNoElasticsearchError(t *testing.T) {
-	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2FPublicCompany", nil)
+func TestAllConceptsByTypeWithDirectType(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Forganisation%2FOrganisation&directType=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPrivateCompany", nil)
+
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, elastic.ErrNoClient)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/organisation/Organisation", false, false, false, []string{"http://www.ft.com/ontology/company/PrivateCompany"}).Return(dummyConcepts(), nil)
 
 	actual := doHttpCall(svc, req)
 
-	assert.Equal(t, http.StatusServiceUnavailable, actual.StatusCode, "http status")
-	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
+}
 
-	respObject := unmarshallResponseMessage(t, actual)
+func TestConceptSearchInTextModeWithDirectTypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Forganisation%2FOrganisation&mode=text&q=pippo&directType=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPrivateCompany&directType=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPublicCompany", nil)
 
-	assert.Equal(t, elastic.ErrNoClient.Error(), respObject["message"], "error message")
+	svc := &mockConceptSearchService{}
+	svc.On("SearchConceptByTextAndTypesInTextMode", "pippo", []string{"http://www.ft.com/ontology/organisation/Organisation"}, false, false, false, []string{"http://www.ft.com/ontology/company/PrivateCompany", "http://www.ft.com/ontology/company/PublicCompany"}).Return(dummyConcepts(), nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
 }
 
-func TestAllConceptsByDirectTypeNoElasticsearchClientError(t *testing.T) {
-	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2FPublicCompany", nil)
+func TestConceptSearchWithDirectTypeNotInIndex(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Forganisation%2FOrganisation&mode=search&q=pippo&directType=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FFoo", nil)
+
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, util.ErrNoElasticClient)
+	svc.On("SearchConceptByTextAndTypes", "pippo", []string{"http://www.ft.com/ontology/organisation/Organisation"}, false, false, false, []string{"http://www.ft.com/ontology/company/Foo"}).
+		Return([]service.Concept{}, util.NewInputError(util.ErrCodeInvalidConceptType, "directType", "invalid direct type"))
 
 	actual := doHttpCall(svc, req)
 
-	assert.Equal(t, http.StatusServiceUnavailable, actual.StatusCode, "http status")
-	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
-
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
 	respObject := unmarshallResponseMessage(t, actual)
-
-	assert.Equal(t, util.ErrNoElasticClient.Error(), respObject["message"], "error message")
+	assert.Equal(t, "directType", respObject["parameter"], "error parameter")
+	svc.AssertExpectations(t)
 }
 
-func TestAllConceptsByDirectTypeServerError(t *testing.T) {
-	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2FPublicCompany", nil)
+func TestConceptsByIdWithDirectType(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?ids=1&directType=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FPrivateCompany", nil)
 
-	expectedError := errors.New("Test error")
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByDirectType", mock.AnythingOfType("string"), mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, expectedError)
-
 	actual := doHttpCall(svc, req)
 
-	assert.Equal(t, http.StatusInternalServerError, actual.StatusCode, "http status")
-	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
+}
 
-	respObject := unmarshallResponseMessage(t, actual)
+func TestInvalidIncludeSubtypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fcompany%2FCompany&includeSubtypes=maybe", nil)
 
-	assert.Equal(t, expectedError.Error(), respObject["message"], "error message")
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
 }
 
 func TestConceptSearchNoParams(t *testing.T) {
@@ -311,21 +490,98 @@ func TestConceptSearchNoParams(t *testing.T) {
 	svc.AssertExpectations(t)
 }
 
+func dummyConceptGroups() []service.ConceptGroup {
+	genres := dummyConcepts()
+	return []service.ConceptGroup{
+		{Type: "http://www.ft.com/ontology/person/Person", Total: 1, Concepts: []service.Concept{{
+			Id:          "http://api.ft.com/things/1",
+			ApiUrl:      "http://api.ft.com/things/1",
+			PrefLabel:   "Test Person",
+			ConceptType: "http://www.ft.com/ontology/person/Person",
+		}}},
+		{Type: "http://www.ft.com/ontology/Genre", Total: 12, Concepts: genres, Next: "genre-cursor"},
+	}
+}
+
 func TestAllConceptsByTypeMultipleTypes(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre", nil)
 	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByTypes", []string{"http://www.ft.com/ontology/person/Person", "http://www.ft.com/ontology/Genre"}, false, false, false, []string(nil), []string(nil)).Return(dummyConceptGroups(), nil)
 
 	actual := doHttpCall(svc, req)
 
-	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
 	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
 
-	respObject := unmarshallResponseMessage(t, actual)
+	var body struct {
+		Types []service.ConceptGroup `json:"types"`
+	}
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	require.Len(t, body.Types, 2)
+	assert.Equal(t, "http://www.ft.com/ontology/person/Person", body.Types[0].Type)
+	assert.Len(t, body.Types[0].Concepts, 1)
+	assert.Equal(t, "http://www.ft.com/ontology/Genre", body.Types[1].Type)
+	assert.Equal(t, int64(12), body.Types[1].Total)
+	assert.Len(t, body.Types[1].Concepts, 2)
+	assert.Equal(t, "genre-cursor", body.Types[1].Next)
+	svc.AssertExpectations(t)
+}
+
+func TestAllConceptsByTypeMultipleTypesAsCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&format=csv", nil)
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByTypes", mock.Anything, false, false, false, []string(nil), []string(nil)).Return(dummyConceptGroups(), nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "text/csv", actual.Header.Get("Content-Type"), "content-type")
+	body, _ := ioutil.ReadAll(actual.Body)
+	rows := strings.Split(strings.TrimSpace(string(body)), "\n")
+	require.Len(t, rows, 4, "header and concept rows")
+	assert.Contains(t, rows[1], "Test Person", "the concepts should be in the order of the groups")
+}
+
+func TestAllConceptsByTypeMultipleTypesError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&type=http%3A%2F%2Fwww.ft.com%2Fontology%2FFoo", nil)
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByTypes", mock.Anything, false, false, false, []string(nil), []string(nil)).Return([]service.ConceptGroup(nil), expectedInputErr)
 
-	assert.Equal(t, "only a single type is supported by this kind of request", respObject["message"], "error message")
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
 	svc.AssertExpectations(t)
 }
 
+func TestAllConceptsByTypeMultipleTypesWithCursors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&cursor=person-cursor&cursor=genre-cursor", nil)
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByTypes", mock.Anything, false, false, false, []string(nil), []string{"person-cursor", "genre-cursor"}).Return(dummyConceptGroups(), nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
+}
+
+func TestCursorRequiresSeveralTypes(t *testing.T) {
+	tests := map[string]string{
+		"single type": "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&cursor=genre-cursor",
+		"search mode": "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&mode=search&q=fast&cursor=genre-cursor",
+		"ids":         "/concepts?ids=1&cursor=genre-cursor",
+	}
+	for name, url := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &mockConceptSearchService{}
+
+			actual := doHttpCall(svc, httptest.NewRequest("GET", url, nil))
+
+			assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+			svc.AssertExpectations(t)
+		})
+	}
+}
+
 func TestConceptSeachByTypeAndValue(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&q=fast", nil)
 
@@ -354,6 +610,8 @@ func TestTypeaheadConceptSearchErrorInvalidMode(t *testing.T) {
 	respObject := unmarshallResponseMessage(t, actual)
 
 	assert.Equal(t, "'autocomplete' is not a valid value for parameter 'mode'", respObject["message"], "error message")
+	assert.Equal(t, util.ErrCodeInvalidParameter, respObject["code"], "error code")
+	assert.Equal(t, "mode", respObject["parameter"], "error parameter")
 	svc.AssertExpectations(t)
 }
 
@@ -398,7 +656,7 @@ func TestConceptSearchTextModeInvalidConceptType(t *testing.T) {
 
 	respObject := unmarshallResponseMessage(t, actual)
 
-	assert.Equal(t, "invalid or missing parameters for concept search (text mode but no organisation or public company type)", respObject["message"], "error message")
+	assert.Equal(t, "invalid or missing parameters for concept search (text mode but no type supporting it)", respObject["message"], "error message")
 	svc.AssertExpectations(t)
 }
 
@@ -407,7 +665,7 @@ func TestConceptSearchTextMode(t *testing.T) {
 
 	svc := &mockConceptSearchService{}
 	concepts := dummyConcepts()
-	svc.On("SearchConceptByTextAndTypesInTextMode", "test", []string{"http://www.ft.com/ontology/organisation/Organisation"}, mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("SearchConceptByTextAndTypesInTextMode", "test", []string{"http://www.ft.com/ontology/organisation/Organisation"}, mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -441,7 +699,7 @@ func TestConceptSearchForAuthors(t *testing.T) {
 	svc := &mockConceptSearchService{}
 
 	concepts := dummyConcepts()
-	svc.On("SearchConceptByTextAndTypesWithBoost", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, "authors", mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("SearchConceptByTextAndTypesWithBoost", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, "authors", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -459,7 +717,7 @@ func TestConceptSearchInvalidBoost(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2Fperson%2FPerson&q=pippo&mode=search&boost=somethingThatWeDontSupport", nil)
 
 	svc := &mockConceptSearchService{}
-	svc.On("SearchConceptByTextAndTypesWithBoost", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, "somethingThatWeDontSupport", mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return([]service.Concept{}, expectedInputErr)
+	svc.On("SearchConceptByTextAndTypesWithBoost", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, "somethingThatWeDontSupport", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return([]service.Concept{}, expectedInputErr)
 
 	actual := doHttpCall(svc, req)
 
@@ -492,7 +750,7 @@ func TestSearchMode(t *testing.T) {
 	svc := &mockConceptSearchService{}
 
 	concepts := dummyConcepts()
-	svc.On("SearchConceptByTextAndTypes", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("SearchConceptByTextAndTypes", "pippo", []string{"http://www.ft.com/ontology/person/Person"}, mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -526,7 +784,7 @@ func TestConceptsById(t *testing.T) {
 
 	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{"1", "2"}).Return(concepts, nil)
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -539,11 +797,117 @@ func TestConceptsById(t *testing.T) {
 	assert.True(t, reflect.DeepEqual(respObject["concepts"], concepts))
 }
 
+func TestConceptsByIdFollowingReplacements(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2&followReplacements=true", nil)
+
+	concepts := dummyConcepts()
+	svc := &mockConceptSearchService{}
+	svc.On("FindConceptsById", []string{"1", "2"}, true).Return(concepts, nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	respObject := unmarshallResponse(t, actual)
+	assert.Len(t, respObject["concepts"], 2, "concepts")
+	svc.AssertExpectations(t)
+}
+
+func TestFollowReplacementsWithoutIds(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&followReplacements=true", nil)
+
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	respObject := unmarshallResponseMessage(t, actual)
+	assert.Equal(t, util.ErrCodeInvalidParameter, respObject["code"], "error code")
+	assert.Equal(t, "followReplacements", respObject["parameter"], "error parameter")
+	svc.AssertExpectations(t)
+}
+
+func TestInvalidFollowReplacements(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?ids=1&followReplacements=maybe", nil)
+
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+	svc.AssertExpectations(t)
+}
+
+func TestConceptsByIdAsCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2", nil)
+	req.Header.Add("Accept", "text/csv")
+
+	concepts := dummyConcepts()
+	concepts[0].UUID = "1"
+	concepts[0].IsDeprecated = true
+	concepts[0].ReplacedBy = "http://api.ft.com/things/3"
+	concepts[1].ScopeNote = "Genre, with \"quotes\""
+	svc := &mockConceptSearchService{}
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return(concepts, nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "text/csv", actual.Header.Get("Content-Type"), "content-type")
+
+	body, _ := ioutil.ReadAll(actual.Body)
+	expected := "id,uuid,prefLabel,type,isDeprecated,scopeNote,countryCode,countryOfIncorporation,replacedBy\n" +
+		"http://api.ft.com/things/1,1,Test Genre 1,http://www.ft.com/ontology/Genre,true,,,,http://api.ft.com/things/3\n" +
+		"http://api.ft.com/things/2,,Test Genre 2,http://www.ft.com/ontology/Genre,false,\"Genre, with \"\"quotes\"\"\",,,\n"
+	assert.Equal(t, expected, string(body))
+}
+
+func TestAllConceptsByTypeWithCSVFormatParameter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&format=csv", nil)
+
+	svc := &mockConceptSearchService{}
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(dummyConcepts(), nil)
+
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "text/csv", actual.Header.Get("Content-Type"), "content-type")
+
+	body, _ := ioutil.ReadAll(actual.Body)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 3, "header and concept rows")
+}
+
+func TestSearchModeAsCSVIsNotAcceptable(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&mode=search&q=test&format=csv", nil)
+
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusNotAcceptable, actual.StatusCode, "http status")
+	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+
+	respObject := unmarshallResponseMessage(t, actual)
+
+	assert.Equal(t, "csv output is only supported for type listings and ids lookups", respObject["message"], "error message")
+	svc.AssertExpectations(t)
+}
+
+func TestInvalidFormatParameter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts?type=http%3A%2F%2Fwww.ft.com%2Fontology%2FGenre&format=xlsx", nil)
+
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusBadRequest, actual.StatusCode, "http status")
+
+	respObject := unmarshallResponseMessage(t, actual)
+
+	assert.Equal(t, "'xlsx' is not a valid value for parameter 'format'", respObject["message"], "error message")
+	svc.AssertExpectations(t)
+}
+
 func TestConceptsByIdInputError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?ids=", nil)
 
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{""}).Return([]service.Concept{}, expectedInputErr)
+	svc.On("FindConceptsById", []string{""}, false).Return([]service.Concept{}, expectedInputErr)
 
 	actual := doHttpCall(svc, req)
 
@@ -574,7 +938,7 @@ func TestConceptsByIdParameterCombinationError(t *testing.T) {
 func TestConceptsByIdMaxIdsLimitError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{"1", "2"}).Return([]service.Concept{}, util.NewInputErrorf(util.ErrMaxIdsLimitFormat, 2, 1))
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return([]service.Concept{}, util.NewInputErrorf(util.ErrCodeIdsLimitExceeded, "ids", util.ErrMaxIdsLimitFormat, 2, 1))
 
 	actual := doHttpCall(svc, req)
 
@@ -584,13 +948,14 @@ func TestConceptsByIdMaxIdsLimitError(t *testing.T) {
 	respObject := unmarshallResponseMessage(t, actual)
 
 	assert.Equal(t, fmt.Sprintf(util.ErrMaxIdsLimitFormat, 2, 1), respObject["message"])
+	assert.Equal(t, util.ErrCodeIdsLimitExceeded, respObject["code"], "error code")
 	svc.AssertExpectations(t)
 }
 
 func TestConceptsByIdNoElasticsearchError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{"1", "2"}).Return([]service.Concept{}, elastic.ErrNoClient)
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return([]service.Concept{}, elastic.ErrNoClient)
 
 	actual := doHttpCall(svc, req)
 
@@ -605,7 +970,7 @@ func TestConceptsByIdNoElasticsearchError(t *testing.T) {
 func TestConceptsByIdNoElasticsearchClientError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2", nil)
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{"1", "2"}).Return([]service.Concept{}, util.ErrNoElasticClient)
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return([]service.Concept{}, util.ErrNoElasticClient)
 
 	actual := doHttpCall(svc, req)
 
@@ -621,7 +986,7 @@ func TestConceptsByIdServerError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/concepts?ids=1&ids=2", nil)
 	expectedError := errors.New("Test error")
 	svc := &mockConceptSearchService{}
-	svc.On("FindConceptsById", []string{"1", "2"}).Return([]service.Concept{}, expectedError)
+	svc.On("FindConceptsById", []string{"1", "2"}, false).Return([]service.Concept{}, expectedError)
 
 	actual := doHttpCall(svc, req)
 
@@ -638,7 +1003,7 @@ func TestDeprecatedTypes(t *testing.T) {
 
 	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), true).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), true, false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -656,7 +1021,7 @@ func TestWrongDeprecatedFlagVal(t *testing.T) {
 
 	concepts := dummyConcepts()
 	svc := &mockConceptSearchService{}
-	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool")).Return(concepts, nil)
+	svc.On("FindAllConceptsByType", "http://www.ft.com/ontology/Genre", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), false, []string(nil)).Return(concepts, nil)
 
 	actual := doHttpCall(svc, req)
 
@@ -669,6 +1034,8 @@ func doHttpCall(svc *mockConceptSearchService, req *http.Request) *http.Response
 
 	router := vestigo.NewRouter()
 	router.Get("/concepts", endpoint.ConceptSearch)
+	router.Get("/concepts/types", endpoint.ConceptTypes)
+	router.Post("/concepts/annotate", endpoint.Annotate)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 	return w.Result()
@@ -0,0 +1,113 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Financial-Times/concept-search-api/service"
+)
+
+const skosNamespace = "http://www.w3.org/2004/02/skos/core#"
+
+var jsonLDContext = map[string]string{
+	"skos":      skosNamespace,
+	"prefLabel": "skos:prefLabel",
+	"altLabel":  "skos:altLabel",
+	"scopeNote": "skos:scopeNote",
+}
+
+type jsonLDDocument struct {
+	Context map[string]string `json:"@context"`
+	Graph   []jsonLDConcept   `json:"@graph"`
+}
+
+type jsonLDConcept struct {
+	ID        string   `json:"@id"`
+	Types     []string `json:"@type"`
+	PrefLabel string   `json:"prefLabel"`
+	AltLabels []string `json:"altLabel,omitempty"`
+	ScopeNote string   `json:"scopeNote,omitempty"`
+}
+
+// writeJSONLD writes the concepts as a JSON-LD graph, where every concept is a skos:Concept of its ontology class
+func writeJSONLD(w io.Writer, concepts []service.Concept) error {
+	doc := jsonLDDocument{Context: jsonLDContext, Graph: []jsonLDConcept{}}
+	for _, c := range concepts {
+		doc.Graph = append(doc.Graph, jsonLDConcept{
+			ID:        c.Id,
+			Types:     conceptClasses(c),
+			PrefLabel: c.PrefLabel,
+			AltLabels: altLabels(c),
+			ScopeNote: c.ScopeNote,
+		})
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// writeTurtle writes the same graph as writeJSONLD in the Turtle syntax
+func writeTurtle(w io.Writer, concepts []service.Concept) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@prefix skos: <%s> .\n", skosNamespace)
+	for _, c := range concepts {
+		classes := []string{"skos:Concept"}
+		for _, class := range conceptClasses(c)[1:] {
+			classes = append(classes, turtleIRI(class))
+		}
+		fmt.Fprintf(&b, "\n%s a %s ;\n", turtleIRI(c.Id), strings.Join(classes, ", "))
+
+		statements := []string{"skos:prefLabel " + turtleLiteral(c.PrefLabel)}
+		if labels := altLabels(c); len(labels) > 0 {
+			literals := make([]string, len(labels))
+			for i, label := range labels {
+				literals[i] = turtleLiteral(label)
+			}
+			statements = append(statements, "skos:altLabel "+strings.Join(literals, ", "))
+		}
+		if c.ScopeNote != "" {
+			statements = append(statements, "skos:scopeNote "+turtleLiteral(c.ScopeNote))
+		}
+		fmt.Fprintf(&b, "\t%s .\n", strings.Join(statements, " ;\n\t"))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func conceptClasses(c service.Concept) []string {
+	classes := []string{"skos:Concept"}
+	if c.ConceptType != "" {
+		classes = append(classes, c.ConceptType)
+	}
+	return classes
+}
+
+// altLabels returns the aliases of the concept, except the one repeating its prefLabel
+func altLabels(c service.Concept) []string {
+	var labels []string
+	for _, alias := range c.Aliases {
+		if alias != c.PrefLabel {
+			labels = append(labels, alias)
+		}
+	}
+	return labels
+}
+
+var turtleStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func turtleLiteral(s string) string {
+	return `"` + turtleStringEscaper.Replace(s) + `"`
+}
+
+// turtleIRI percent-encodes the characters which are not allowed in an IRIREF
+func turtleIRI(iri string) string {
+	var b strings.Builder
+	for _, r := range iri {
+		if r <= 0x20 || strings.ContainsRune("<>\"{}|^`\\", r) {
+			fmt.Fprintf(&b, "%%%02X", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return "<" + b.String() + ">"
+}
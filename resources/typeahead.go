@@ -0,0 +1,263 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/google/uuid"
+	"github.com/husobee/vestigo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	typeaheadSessionTTL       = 5 * time.Minute
+	typeaheadKeepAliveTimeout = 15 * time.Second
+)
+
+var (
+	errUnknownTypeaheadSession = NewValidationError(util.ErrCodeNotFound, "session", "unknown typeahead session")
+	errTypeaheadSessionInUse   = NewValidationError(util.ErrCodeConflict, "session", "typeahead session already has an open stream")
+)
+
+// TypeaheadHandler serves search results over server-sent events. A client opens a session, streams its results
+// and posts every query update to it; only the results of the latest update are pushed back, and the ES query of a
+// superseded update is cancelled.
+type TypeaheadHandler struct {
+	service  service.ConceptSearchService
+	sessions map[string]*typeaheadSession
+	lock     *sync.Mutex
+}
+
+type typeaheadQuery struct {
+	Q                    string   `json:"q"`
+	ConceptTypes         []string `json:"type"`
+	BoostType            string   `json:"boost,omitempty"`
+	SearchAllAuthorities bool     `json:"searchAllAuthorities,omitempty"`
+	IncludeDeprecated    bool     `json:"include_deprecated,omitempty"`
+	IncludeSubtypes      bool     `json:"includeSubtypes,omitempty"`
+	DirectTypes          []string `json:"directType,omitempty"`
+}
+
+type typeaheadResult struct {
+	seq      int
+	query    typeaheadQuery
+	concepts []service.Concept
+	err      error
+}
+
+type typeaheadSession struct {
+	id        string
+	created   time.Time
+	streaming bool
+	seq       int
+	latest    typeaheadQuery
+	updated   chan struct{}
+	lock      *sync.Mutex
+}
+
+func NewTypeaheadHandler(service service.ConceptSearchService) *TypeaheadHandler {
+	return &TypeaheadHandler{
+		service:  service,
+		sessions: make(map[string]*typeaheadSession),
+		lock:     &sync.Mutex{},
+	}
+}
+
+// CreateSession registers a new typeahead session and returns its id.
+func (h *TypeaheadHandler) CreateSession(w http.ResponseWriter, req *http.Request) {
+	h.lock.Lock()
+	h.expireSessions()
+	session := &typeaheadSession{
+		id:      uuid.New().String(),
+		created: time.Now(),
+		updated: make(chan struct{}, 1),
+		lock:    &sync.Mutex{},
+	}
+	h.sessions[session.id] = session
+	h.lock.Unlock()
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"session": session.id})
+}
+
+// UpdateQuery replaces the query of a session, superseding any query that is still in flight.
+func (h *TypeaheadHandler) UpdateQuery(w http.ResponseWriter, req *http.Request) {
+	session, found := h.session(vestigo.Param(req, "session"))
+	if !found {
+		writeHTTPError(w, req, http.StatusNotFound, errUnknownTypeaheadSession)
+		return
+	}
+
+	var query typeaheadQuery
+	if err := json.NewDecoder(req.Body).Decode(&query); err != nil {
+		writeHTTPError(w, req, http.StatusBadRequest, NewValidationError(util.ErrCodeInvalidRequestBody, "", fmt.Sprintf("invalid typeahead query: %v", err)))
+		return
+	}
+	defer req.Body.Close()
+
+	if query.Q == "" || len(query.ConceptTypes) == 0 {
+		writeHTTPError(w, req, http.StatusBadRequest, NewValidationError(util.ErrCodeMissingParameter, "", "invalid or missing parameters for typeahead query (require q and type)"))
+		return
+	}
+
+	session.update(query)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Stream pushes the results of the latest query of a session as server-sent events until the client disconnects.
+func (h *TypeaheadHandler) Stream(w http.ResponseWriter, req *http.Request) {
+	id := vestigo.Param(req, "session")
+	session, found := h.session(id)
+	if !found {
+		writeHTTPError(w, req, http.StatusNotFound, errUnknownTypeaheadSession)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, req, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	if !session.startStreaming() {
+		writeHTTPError(w, req, http.StatusConflict, errTypeaheadSessionInUse)
+		return
+	}
+	defer h.closeSession(id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := req.Context()
+	results := make(chan typeaheadResult)
+	keepAlive := time.NewTicker(typeaheadKeepAliveTimeout)
+	defer keepAlive.Stop()
+
+	cancelInFlight := func() {}
+	defer func() { cancelInFlight() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-session.updated:
+			seq, query := session.current()
+			cancelInFlight()
+			queryCtx, cancel := context.WithCancel(ctx)
+			cancelInFlight = cancel
+			go h.search(queryCtx, ctx, seq, query, results)
+		case result := <-results:
+			if seq, _ := session.current(); result.seq != seq {
+				continue // superseded while in flight
+			}
+			if err := writeTypeaheadEvent(w, result); err != nil {
+				log.WithError(err).WithField("session", id).Warn("failed to write typeahead event")
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *TypeaheadHandler) search(queryCtx context.Context, streamCtx context.Context, seq int, query typeaheadQuery, results chan<- typeaheadResult) {
+	var concepts []service.Concept
+	var err error
+	if query.BoostType != "" {
+		concepts, err = h.service.SearchConceptByTextAndTypesWithBoost(queryCtx, query.Q, query.ConceptTypes, query.BoostType, query.SearchAllAuthorities, query.IncludeDeprecated, query.IncludeSubtypes, query.DirectTypes)
+	} else {
+		concepts, err = h.service.SearchConceptByTextAndTypes(queryCtx, query.Q, query.ConceptTypes, query.SearchAllAuthorities, query.IncludeDeprecated, query.IncludeSubtypes, query.DirectTypes)
+	}
+	if queryCtx.Err() != nil {
+		return // cancelled by a newer query or by the client going away
+	}
+
+	select {
+	case results <- typeaheadResult{seq: seq, query: query, concepts: concepts, err: err}:
+	case <-streamCtx.Done():
+	}
+}
+
+func writeTypeaheadEvent(w http.ResponseWriter, result typeaheadResult) error {
+	event := "results"
+	data := map[string]interface{}{"q": result.query.Q}
+	if result.err != nil {
+		event = "error"
+		data["message"] = result.err.Error()
+	} else {
+		data["concepts"] = result.concepts
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func (h *TypeaheadHandler) session(id string) (*typeaheadSession, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	session, found := h.sessions[id]
+	return session, found
+}
+
+func (h *TypeaheadHandler) closeSession(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.sessions, id)
+}
+
+// expireSessions drops the sessions which were never streamed within the TTL. The caller must hold the lock.
+func (h *TypeaheadHandler) expireSessions() {
+	for id, session := range h.sessions {
+		if session.isStale(time.Now()) {
+			delete(h.sessions, id)
+		}
+	}
+}
+
+func (s *typeaheadSession) startStreaming() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.streaming {
+		return false
+	}
+	s.streaming = true
+	return true
+}
+
+func (s *typeaheadSession) isStale(now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.streaming && now.Sub(s.created) > typeaheadSessionTTL
+}
+
+func (s *typeaheadSession) update(query typeaheadQuery) {
+	s.lock.Lock()
+	s.seq++
+	s.latest = query
+	s.lock.Unlock()
+
+	select {
+	case s.updated <- struct{}{}:
+	default: // the stream has not picked up the previous update yet and will read the latest query anyway
+	}
+}
+
+func (s *typeaheadSession) current() (int, typeaheadQuery) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.seq, s.latest
+}
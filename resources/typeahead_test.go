@@ -0,0 +1,146 @@
+package resources
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/service"
+	"github.com/husobee/vestigo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slowQuerySearchService struct {
+	*mockConceptSearchService
+	started   chan string
+	cancelled chan string
+}
+
+func (s *slowQuerySearchService) SearchConceptByTextAndTypes(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]service.Concept, error) {
+	if textQuery == "slow" {
+		s.started <- textQuery
+		<-ctx.Done()
+		s.cancelled <- textQuery
+		return nil, ctx.Err()
+	}
+	return dummyConcepts(), nil
+}
+
+func newTypeaheadTestServer(svc service.ConceptSearchService) *httptest.Server {
+	h := NewTypeaheadHandler(svc)
+	r := vestigo.NewRouter()
+	r.Post("/concepts/typeahead", h.CreateSession)
+	r.Get("/concepts/typeahead/:session", h.Stream)
+	r.Post("/concepts/typeahead/:session", h.UpdateQuery)
+	return httptest.NewServer(r)
+}
+
+func createTypeaheadSession(t *testing.T, serverURL string) string {
+	resp, err := http.Post(serverURL+"/concepts/typeahead", "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode, "http status")
+
+	var body map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotEmpty(t, body["session"], "session id")
+	return body["session"]
+}
+
+func postTypeaheadQuery(t *testing.T, sessionURL string, body string) *http.Response {
+	resp, err := http.Post(sessionURL, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func TestTypeaheadPushesOnlyLatestResults(t *testing.T) {
+	svc := &slowQuerySearchService{
+		mockConceptSearchService: &mockConceptSearchService{},
+		started:                  make(chan string, 1),
+		cancelled:                make(chan string, 1),
+	}
+	server := newTypeaheadTestServer(svc)
+	defer server.Close()
+
+	sessionURL := server.URL + "/concepts/typeahead/" + createTypeaheadSession(t, server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", sessionURL, nil)
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"), "content-type")
+
+	resp := postTypeaheadQuery(t, sessionURL, `{"q":"slow","type":["http://www.ft.com/ontology/Genre"]}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "http status")
+	select {
+	case <-svc.started:
+	case <-time.After(time.Second):
+		t.Fatal("the first query was never executed")
+	}
+
+	resp = postTypeaheadQuery(t, sessionURL, `{"q":"fast","type":["http://www.ft.com/ontology/Genre"]}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "http status")
+	select {
+	case q := <-svc.cancelled:
+		assert.Equal(t, "slow", q, "cancelled query")
+	case <-time.After(time.Second):
+		t.Fatal("the superseded query was not cancelled")
+	}
+
+	scanner := bufio.NewScanner(stream.Body)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+			break
+		}
+	}
+
+	assert.Equal(t, "results", event, "event type")
+	var result struct {
+		Q        string            `json:"q"`
+		Concepts []service.Concept `json:"concepts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(data), &result))
+	assert.Equal(t, "fast", result.Q, "query of the pushed results")
+	assert.Equal(t, dummyConcepts(), result.Concepts, "concepts")
+}
+
+func TestTypeaheadUnknownSession(t *testing.T) {
+	server := newTypeaheadTestServer(&mockConceptSearchService{})
+	defer server.Close()
+
+	resp := postTypeaheadQuery(t, server.URL+"/concepts/typeahead/unknown", `{"q":"fast","type":["http://www.ft.com/ontology/Genre"]}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "http status")
+
+	resp, err := http.Get(server.URL + "/concepts/typeahead/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "http status")
+}
+
+func TestTypeaheadInvalidQuery(t *testing.T) {
+	server := newTypeaheadTestServer(&mockConceptSearchService{})
+	defer server.Close()
+
+	sessionURL := server.URL + "/concepts/typeahead/" + createTypeaheadSession(t, server.URL)
+
+	resp := postTypeaheadQuery(t, sessionURL, `{"q":"fast"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "http status")
+
+	resp = postTypeaheadQuery(t, sessionURL, `{"q":"fast"`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "http status")
+}
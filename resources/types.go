@@ -0,0 +1,14 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Financial-Times/concept-search-api/util"
+)
+
+// ConceptTypes lists the concept types which can be searched, along with the modes they support and their boosts.
+func (h *Handler) ConceptTypes(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", mediaTypeJSON)
+	json.NewEncoder(w).Encode(util.GetTypeRegistry())
+}
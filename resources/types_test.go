@@ -0,0 +1,33 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConceptTypes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/concepts/types", nil)
+
+	svc := &mockConceptSearchService{}
+	actual := doHttpCall(svc, req)
+
+	assert.Equal(t, http.StatusOK, actual.StatusCode, "http status")
+	assert.Equal(t, "application/json", actual.Header.Get("Content-Type"), "content-type")
+
+	var body struct {
+		Types []util.ConceptType `json:"types"`
+	}
+	require.NoError(t, json.NewDecoder(actual.Body).Decode(&body))
+	assert.Equal(t, util.GetTypeRegistry().Types, body.Types)
+
+	organisation, found := util.GetTypeRegistry().Lookup("http://www.ft.com/ontology/organisation/Organisation")
+	require.True(t, found)
+	assert.Contains(t, body.Types, organisation)
+	svc.AssertExpectations(t)
+}
@@ -2,66 +2,53 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 
+	"github.com/Financial-Times/concept-search-api/service"
 	"github.com/Financial-Times/concept-search-api/util"
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
-	"github.com/olivere/elastic/v7"
 	log "github.com/sirupsen/logrus"
 )
 
-type conceptFinder interface {
-	FindConcept(writer http.ResponseWriter, request *http.Request)
-	SetElasticClient(client *elastic.Client)
-}
-
-type esConceptFinder struct {
-	client              esClient
-	defaultIndex        string
-	extendedSearchIndex string
+var (
+	errMissingSearchTerm     = util.NewInputError(util.ErrCodeMissingParameter, "term", "one of 'term' or 'bestMatchTerms' must be provided")
+	errBothSearchTerms       = util.NewInputError(util.ErrCodeInvalidParameter, "bestMatchTerms", "only one of 'term' or 'bestMatchTerms' may be provided")
+	errNoConceptsFound       = util.NewInputError(util.ErrCodeNotFound, "", "no concepts found")
+	errInvalidBestMatchLimit = util.NewInputError(util.ErrCodeInvalidParameter, "bestMatchLimit", "bestMatchLimit must be a positive number")
+)
 
-	searchResultLimit int
-	lockClient        *sync.RWMutex
+// conceptFinder serves the POST /concept/search endpoint on top of the concept search service
+type conceptFinder struct {
+	search service.ConceptSearchService
 }
 
-func newConceptFinder(defaultIndex string, extendedSearchIndex string, resultLimit int) conceptFinder {
-	return &esConceptFinder{
-		defaultIndex:        defaultIndex,
-		extendedSearchIndex: extendedSearchIndex,
-		searchResultLimit:   resultLimit,
-		lockClient:          &sync.RWMutex{},
-	}
+func newConceptFinder(search service.ConceptSearchService) *conceptFinder {
+	return &conceptFinder{search: search}
 }
 
-func (service *esConceptFinder) FindConcept(writer http.ResponseWriter, request *http.Request) {
-	if service.esClient() == nil {
-		log.Errorf("Elasticsearch client is not created.")
-		writer.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
+func (finder *conceptFinder) FindConcept(writer http.ResponseWriter, request *http.Request) {
 	var criteria searchCriteria
 	decoder := json.NewDecoder(request.Body)
 	err := decoder.Decode(&criteria)
 
 	if err != nil {
 		log.Errorf("There was an error parsing the search request: %s", err.Error())
-		writer.WriteHeader(http.StatusBadRequest)
+		util.WriteHTTPError(writer, request, http.StatusBadRequest, util.NewInputErrorf(util.ErrCodeInvalidRequestBody, "", "invalid search request: %s", err.Error()))
 		return
 	}
 
 	if criteria.Term == nil && len(criteria.BestMatchTerms) == 0 {
 		log.Error("The required data not provided. Check that the JSON contains the 'term' field that is used to provide " +
 			"the search criteria, or the 'bestMatchTerms' value(s) for providing best match results")
-		writer.WriteHeader(http.StatusBadRequest)
+		util.WriteHTTPError(writer, request, http.StatusBadRequest, errMissingSearchTerm)
 		return
 	}
 	if criteria.Term != nil && len(criteria.BestMatchTerms) > 0 {
 		log.Error("Both, 'term' and 'bestMatchTerms' provided. Just one of them should be provided")
-		writer.WriteHeader(http.StatusBadRequest)
+		util.WriteHTTPError(writer, request, http.StatusBadRequest, errBothSearchTerms)
 		return
 	}
 
@@ -70,101 +57,87 @@ func (service *esConceptFinder) FindConcept(writer http.ResponseWriter, request
 	transactionID := transactionidutils.GetTransactionIDFromRequest(request)
 
 	if criteria.Term != nil {
-		service.findConceptsWithTerm(writer, request, &criteria, transactionID)
+		finder.findConceptsWithTerm(writer, request, &criteria, transactionID)
 	} else if len(criteria.BestMatchTerms) > 0 {
-		service.findConceptsWithBestMatch(writer, request, &criteria, transactionID)
+		finder.findConceptsWithBestMatch(writer, request, &criteria, transactionID)
 	}
 }
 
-func (service *esConceptFinder) findConceptsWithTerm(writer http.ResponseWriter, request *http.Request, criteria *searchCriteria, transactionID string) {
+func (finder *conceptFinder) findConceptsWithTerm(writer http.ResponseWriter, request *http.Request, criteria *searchCriteria, transactionID string) {
 	log.Infof("Performing concept search for term=%v, transaction_id=%v", *criteria.Term, transactionID)
 
-	multiMatchQuery := elastic.NewMultiMatchQuery(criteria.Term, "prefLabel", "aliases").Type("most_fields")
-	termQueryForPreflabelExactMatches := elastic.NewTermQuery("prefLabel.raw", criteria.Term).Boost(2)
-	termQueryForAliasesExactMatches := elastic.NewTermQuery("aliases.raw", criteria.Term).Boost(2)
-
-	finalQuery := elastic.NewBoolQuery().Should(multiMatchQuery, termQueryForPreflabelExactMatches, termQueryForAliasesExactMatches)
-
-	// by default {include_deprecated in (nil, false)} the deprecated entities are excluded
-	if !isDeprecatedIncluded(request) {
-		finalQuery = finalQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+	concepts, err := finder.search.SearchConceptsByTerm(request.Context(), *criteria.Term, isSearchAllAuthorities(request), isDeprecatedIncluded(request))
+	if err != nil {
+		writeSearchError(writer, request, err)
+		return
 	}
 
-	index := service.defaultIndex
-	if isSearchAllAuthorities(request) {
-		index = service.extendedSearchIndex
+	if len(concepts) == 0 {
+		util.WriteHTTPError(writer, request, http.StatusNotFound, errNoConceptsFound)
+		return
 	}
 
-	searchResult, err := service.esClient().query(index, finalQuery, service.searchResultLimit)
-
-	if err != nil {
-		log.Errorf("There was an error executing the query on ES: %s", err.Error())
+	writer.Header().Add("Content-Type", "application/json")
+	foundConcepts := searchResult{Results: toConcepts(concepts, isScoreIncluded(request), isFTAuthorIncluded(request))}
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(&foundConcepts); err != nil {
+		log.Errorf("Cannot encode result: %s", err.Error())
 		writer.WriteHeader(http.StatusInternalServerError)
-		return
 	}
+}
 
-	defer func() {
-		// searchResult.Hits.TotalHits call panics if the result from ES is not a valid JSON, this handles it
-		if r := recover(); r != nil {
-			log.WithField("Recover", r).Error("Recovered in findConcept")
-			writer.WriteHeader(http.StatusInternalServerError)
-		}
-	}()
-
-	if searchResult.Hits.TotalHits.Value > 0 {
-		writer.Header().Add("Content-Type", "application/json")
-		foundConcepts := getFoundConcepts(searchResult, isScoreIncluded(request), isFTAuthorIncluded(request))
-		encoder := json.NewEncoder(writer)
-		if err := encoder.Encode(&foundConcepts); err != nil {
-			log.Errorf("Cannot encode result: %s", err.Error())
-			writer.WriteHeader(http.StatusInternalServerError)
+func (finder *conceptFinder) findConceptsWithBestMatch(writer http.ResponseWriter, request *http.Request, criteria *searchCriteria, transactionID string) {
+	log.Infof("Performing concept search for bestMatchTerms=%v, transaction_id=%v", strings.Join(criteria.BestMatchTerms, ", "), transactionID)
+
+	limit := 0
+	if criteria.BestMatchLimit != nil {
+		if *criteria.BestMatchLimit < 1 {
+			util.WriteHTTPError(writer, request, http.StatusBadRequest, errInvalidBestMatchLimit)
+			return
 		}
-	} else {
-		writer.WriteHeader(http.StatusNotFound)
+		limit = *criteria.BestMatchLimit
 	}
-}
 
-func (service *esConceptFinder) findConceptsWithBestMatch(writer http.ResponseWriter, request *http.Request, criteria *searchCriteria, transactionID string) {
-	searchWrappers, statusCode, err := createSearchRequestsForBestMatch(request, criteria, transactionID, service.searchResultLimit)
+	matches, err := finder.search.FindBestMatchingConcepts(request.Context(), service.BestMatchCriteria{
+		Terms:                criteria.BestMatchTerms,
+		ConceptTypes:         criteria.ConceptTypes,
+		BoostType:            criteria.BoostType,
+		FilterType:           criteria.FilterType,
+		Limit:                limit,
+		MinScore:             criteria.MinScore,
+		SearchAllAuthorities: isSearchAllAuthorities(request),
+		IncludeDeprecated:    isDeprecatedIncluded(request),
+	})
 	if err != nil {
 		log.WithError(err).Error("Error during query for best matching")
-		writer.WriteHeader(statusCode)
+		writeSearchError(writer, request, err)
 		return
 	}
 
-	searchRequests := []*elastic.SearchRequest{}
-	for _, searchWrapper := range searchWrappers {
-		searchRequests = append(searchRequests, searchWrapper.searchRequest)
-	}
-
-	index := service.defaultIndex
-	if isSearchAllAuthorities(request) {
-		index = service.extendedSearchIndex
-	}
+	// the candidates can only be told apart by their scores, which are always returned along with them
+	includeScore := isScoreIncluded(request) || criteria.BestMatchLimit != nil
 
-	res, err := service.esClient().multiSearchQuery(index, searchRequests...)
-	if err != nil {
-		log.Errorf("There was an error executing the query on ES: %s", err.Error())
-		writer.WriteHeader(http.StatusInternalServerError)
+	if isStatusIncluded(request) {
+		writeBestMatchesWithStatus(writer, matches, includeScore, isFTAuthorIncluded(request))
 		return
 	}
 
 	noResultsCounter := 0
-	currentRespIdx := 0
 	finalResults := make(map[string][]concept)
-	for _, searchRequestRes := range res.Responses {
-		if searchRequestRes.Hits.TotalHits.Value > 0 {
-			foundConcepts := getFoundConcepts(searchRequestRes, isScoreIncluded(request), isFTAuthorIncluded(request))
-			finalResults[searchWrappers[currentRespIdx].term] = foundConcepts.Results[:1]
-		} else {
-			finalResults[searchWrappers[currentRespIdx].term] = []concept{}
+	for term, bestMatch := range matches {
+		if bestMatch.Status == service.BestMatchError {
+			// the response has no room for the status of the terms, so one failed term fails them all
+			writeSearchError(writer, request, bestMatch.Err)
+			return
+		}
+		if bestMatch.Status == service.BestMatchNotFound {
 			noResultsCounter++
 		}
-		currentRespIdx++
+		finalResults[term] = toConcepts(bestMatch.Concepts, includeScore, isFTAuthorIncluded(request))
 	}
 
-	if noResultsCounter == len(searchWrappers) {
-		writer.WriteHeader(http.StatusNotFound)
+	if noResultsCounter == len(matches) {
+		util.WriteHTTPError(writer, request, http.StatusNotFound, errNoConceptsFound)
 		return
 	}
 
@@ -176,30 +149,81 @@ func (service *esConceptFinder) findConceptsWithBestMatch(writer http.ResponseWr
 	}
 }
 
-func getFoundConcepts(elasticResult *elastic.SearchResult, isScoreIncluded bool, isFTAuthorIncluded bool) searchResult {
-	var foundConcepts []concept
-	for _, hit := range elasticResult.Hits.Hits {
-		var foundConcept concept
-		err := json.Unmarshal(hit.Source, &foundConcept)
+// writeBestMatchesWithStatus writes the outcome of every term along with its concepts, so that batch callers can retry
+// only the failed terms. The response is 200 if no term failed, 207 if some of them failed and 500 if all of them did.
+func writeBestMatchesWithStatus(writer http.ResponseWriter, matches map[string]service.BestMatch, includeScore bool, includeFTAuthor bool) {
+	failed := 0
+	finalResults := make(map[string]bestMatchResult)
+	for term, bestMatch := range matches {
+		result := bestMatchResult{
+			Status:   bestMatch.Status,
+			Concepts: toConcepts(bestMatch.Concepts, includeScore, includeFTAuthor),
+		}
+		if bestMatch.Err != nil {
+			failed++
+			result.Error = bestMatch.Err.Error()
+		}
+		finalResults[term] = result
+	}
+
+	status := http.StatusOK
+	if failed == len(matches) {
+		status = http.StatusInternalServerError
+	} else if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	writer.Header().Add("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(finalResults); err != nil {
+		log.Errorf("Cannot encode result: %s", err.Error())
+	}
+}
+
+func writeSearchError(writer http.ResponseWriter, request *http.Request, err error) {
+	var inputErr util.InputError
+	if errors.As(err, &inputErr) {
+		util.WriteHTTPError(writer, request, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, util.ErrCircuitOpen) {
+		util.WriteHTTPError(writer, request, http.StatusServiceUnavailable, err)
+		return
+	}
+	log.Errorf("There was an error executing the query on ES: %s", err.Error())
+	util.WriteHTTPError(writer, request, http.StatusInternalServerError, err)
+}
+
+func toConcepts(scoredConcepts []service.ScoredConcept, isScoreIncluded bool, isFTAuthorIncluded bool) []concept {
+	concepts := make([]concept, 0, len(scoredConcepts))
+	for _, c := range scoredConcepts {
+		foundConcept := concept{
+			ID:                     c.Id,
+			APIUrl:                 c.ApiUrl,
+			PrefLabel:              c.PrefLabel,
+			Types:                  c.Types,
+			DirectType:             c.DirectType,
+			Aliases:                c.Aliases,
+			ScopeNote:              c.ScopeNote,
+			IsDeprecated:           c.IsDeprecated,
+			CountryCode:            c.CountryCode,
+			CountryOfIncorporation: c.CountryOfIncorporation,
+			ReplacedBy:             c.ReplacedBy,
+		}
+		if isScoreIncluded {
+			foundConcept.Score = c.Score
+		}
+		if isFTAuthorIncluded && c.IsFTAuthor != nil {
+			foundConcept.IsFTAuthor = *c.IsFTAuthor
+		}
+		uuid, err := util.ExtractUUID(c.Id)
 		if err != nil {
-			log.Errorf("Unable to unmarshall concept, error=[%s]\n", err)
-		} else {
-			if isScoreIncluded {
-				score := *hit.Score
-				foundConcept.Score = score
-			}
-			if !isFTAuthorIncluded {
-				foundConcept.IsFTAuthor = ""
-			}
-			uuid, err := util.ExtractUUID(foundConcept.ID)
-			if err != nil {
-				log.Error(err)
-			}
-			foundConcept.UUID = uuid
-			foundConcepts = append(foundConcepts, foundConcept)
+			log.Error(err)
 		}
+		foundConcept.UUID = uuid
+		concepts = append(concepts, foundConcept)
 	}
-	return searchResult{Results: foundConcepts}
+	return concepts
 }
 
 func isDeprecatedIncluded(request *http.Request) bool {
@@ -233,106 +257,20 @@ func isFieldIncluded(request *http.Request, fieldValue string) bool {
 	return false
 }
 
-func isScoreIncluded(request *http.Request) bool {
-	queryParam := request.URL.Query().Get("include_score")
-	includeScore, err := strconv.ParseBool(queryParam)
+func isStatusIncluded(request *http.Request) bool {
+	includeStatus, _, err := util.GetBoolQueryParameter(request, "include_status", false)
 	if err != nil {
 		return false
 	}
-	return includeScore
-}
-
-func (service *esConceptFinder) SetElasticClient(client *elastic.Client) {
-	service.lockClient.Lock()
-	defer service.lockClient.Unlock()
-	service.client = &esClientWrapper{elasticClient: client}
-}
-
-func (service *esConceptFinder) esClient() esClient {
-	service.lockClient.RLock()
-	defer service.lockClient.RUnlock()
-	return service.client
-}
-
-func createSearchRequestsForBestMatch(request *http.Request, criteria *searchCriteria, transactionID string, size int) ([]*multiSearchWrapper, int, error) {
-	log.Infof("Performing concept search for bestMatchTerms=%v, transaction_id=%v", strings.Join(criteria.BestMatchTerms, ", "), transactionID)
-
-	requests := []*multiSearchWrapper{}
-	for _, searchingTerm := range criteria.BestMatchTerms {
-		finalQuery := elastic.NewBoolQuery()
-
-		// prepare best match query
-		bestMatchQ := elastic.NewMatchQuery("aliases", searchingTerm).Operator("and")
-		finalQuery = finalQuery.Must(bestMatchQ)
-
-		// add boost if it is requested
-		if len(criteria.BoostType) > 0 {
-			boostQ, err := getBoostQuery(criteria.BoostType, criteria.ConceptTypes)
-			if err != nil {
-				return nil, http.StatusBadRequest, err
-			}
-			finalQuery = finalQuery.Should(boostQ)
-		}
-
-		// add extra filter if it is requested
-		if len(criteria.FilterType) > 0 {
-			extraFilterQ, err := getExtraFilterQuery(criteria.FilterType, criteria.ConceptTypes)
-			if err != nil {
-				return nil, http.StatusBadRequest, err
-			}
-			finalQuery = finalQuery.Filter(extraFilterQ)
-		}
-
-		// filter for given concept types
-		if len(criteria.ConceptTypes) > 0 {
-			esTypes, _, err := util.ValidateAndConvertToEsTypes(criteria.ConceptTypes)
-			if err != nil {
-				return nil, http.StatusBadRequest, err
-			}
-			typeFilter := elastic.NewTermsQuery("type", util.ToTerms(esTypes)...) // filter by type
-			finalQuery = finalQuery.Filter(typeFilter)
-		}
-
-		// filter the deprecated concepts out
-		if !isDeprecatedIncluded(request) {
-			finalQuery = finalQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
-		}
-
-		// requests
-		ss := elastic.NewSearchSource().Size(size).Query(finalQuery)
-		sq := elastic.NewSearchRequest().Source(ss)
-		requests = append(requests, &multiSearchWrapper{
-			term:          searchingTerm,
-			searchRequest: sq,
-		})
-	}
 
-	return requests, http.StatusOK, nil
+	return includeStatus
 }
 
-func getBoostQuery(boostType string, conceptTypes []string) (elastic.Query, error) {
-	switch boostType {
-	case "authors":
-		err := util.ValidateForAuthorsSearch(conceptTypes, boostType)
-		if err != nil {
-			return nil, err
-		}
-		// got from search.go#searchConceptsForMultipleTypes - not random 1.8 value. It was tunned in there
-		return elastic.NewTermQuery("isFTAuthor", "true").Boost(1.8), nil
-	default:
-		return nil, util.ErrInvalidBoostTypeParameter
-	}
-}
-
-func getExtraFilterQuery(extraFilterType string, conceptTypes []string) (elastic.Query, error) {
-	switch extraFilterType {
-	case "authors":
-		err := util.ValidateForAuthorsSearch(conceptTypes, extraFilterType)
-		if err != nil {
-			return nil, err
-		}
-		return elastic.NewTermQuery("isFTAuthor", "true"), nil
-	default:
-		return nil, util.ErrInvalidBoostTypeParameter
+func isScoreIncluded(request *http.Request) bool {
+	queryParam := request.URL.Query().Get("include_score")
+	includeScore, err := strconv.ParseBool(queryParam)
+	if err != nil {
+		return false
 	}
+	return includeScore
 }
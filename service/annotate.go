@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Financial-Times/concept-search-api/util"
+)
+
+const (
+	maxAnnotateTextLength = 2000 // in characters, about a paragraph
+	maxNGramLength        = 4    // in words
+	maxAnnotateTerms      = 500  // distinct n-grams of a text, so that it takes no more than 10 multi search requests
+	annotateBatchSize     = 50   // terms resolved by a single multi search request
+	annotateCandidates    = 3    // candidates checked for an exact label match for every n-gram
+)
+
+var (
+	errEmptyAnnotateText = util.NewInputError(util.ErrCodeMissingParameter, "text", "empty text to annotate")
+
+	// n-grams never start or end with one of these words
+	stopWords = map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true, "by": true,
+		"for": true, "from": true, "has": true, "have": true, "he": true, "her": true, "his": true, "in": true,
+		"into": true, "is": true, "it": true, "its": true, "of": true, "on": true, "or": true, "she": true,
+		"that": true, "the": true, "their": true, "they": true, "this": true, "to": true, "was": true, "were": true,
+		"will": true, "with": true,
+	}
+)
+
+// AnnotateText finds the concepts mentioned in the text. Every n-gram of the text is resolved through the best match
+// search, and annotated with the best candidate having it as its prefLabel or as one of its aliases. Overlapping
+// mentions are resolved in favour of the longest one. The mentions are restricted to mentionTypes if no concept types
+// are given.
+func (s *esConceptSearchService) AnnotateText(ctx context.Context, text string, conceptTypes []string) ([]Annotation, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, errEmptyAnnotateText
+	}
+	if len([]rune(text)) > maxAnnotateTextLength {
+		return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "text", "the text to annotate exceeds the limit of %d characters", maxAnnotateTextLength)
+	}
+	if len(conceptTypes) == 0 {
+		conceptTypes = mentionTypes
+	}
+
+	nGrams := candidateNGrams(text)
+	var terms []string
+	seen := make(map[string]bool)
+	for _, n := range nGrams {
+		if !seen[n.text] {
+			seen[n.text] = true
+			terms = append(terms, n.text)
+		}
+	}
+	if len(terms) > maxAnnotateTerms {
+		return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "text", "the text to annotate has more than %d distinct phrases to look up", maxAnnotateTerms)
+	}
+
+	limit := annotateCandidates
+	if limit > s.maxSearchResults {
+		limit = s.maxSearchResults
+	}
+	matches := make(map[string][]ScoredConcept, len(terms))
+	for start := 0; start < len(terms); start += annotateBatchSize {
+		end := start + annotateBatchSize
+		if end > len(terms) {
+			end = len(terms)
+		}
+		batch, err := s.FindBestMatchingConcepts(ctx, BestMatchCriteria{Terms: terms[start:end], ConceptTypes: conceptTypes, Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		for term, bestMatch := range batch {
+			if bestMatch.Status == BestMatchError {
+				return nil, bestMatch.Err
+			}
+			matches[term] = bestMatch.Concepts
+		}
+	}
+
+	var annotations []Annotation
+	for _, n := range nGrams {
+		for _, candidate := range matches[n.text] {
+			if hasLabel(candidate.EsConceptModel, n.text) {
+				annotations = append(annotations, Annotation{
+					Start:   n.start,
+					End:     n.end,
+					Text:    n.text,
+					Concept: ConvertToSimpleConcept(candidate.EsConceptModel),
+					Score:   candidate.Score,
+				})
+				break
+			}
+		}
+	}
+	return longestMentions(annotations), nil
+}
+
+type token struct {
+	start, end int // rune offsets in the text, end is exclusive
+}
+
+type nGram struct {
+	start, end int
+	text       string
+}
+
+// candidateNGrams returns the n-grams of up to maxNGramLength words of the text which do not cross a punctuation mark
+// and neither start nor end with a stop word
+func candidateNGrams(text string) []nGram {
+	runes := []rune(text)
+	tokens := tokenize(runes)
+
+	var nGrams []nGram
+	for i := range tokens {
+		for j := i; j < len(tokens) && j-i < maxNGramLength; j++ {
+			if j > i && breaksNGram(runes[tokens[j-1].end:tokens[j].start]) {
+				break
+			}
+			first := string(runes[tokens[i].start:tokens[i].end])
+			last := string(runes[tokens[j].start:tokens[j].end])
+			if isStopWord(first) || isStopWord(last) || (i == j && !isMentionWord(first)) {
+				continue
+			}
+			nGrams = append(nGrams, nGram{
+				start: tokens[i].start,
+				end:   tokens[j].end,
+				text:  string(runes[tokens[i].start:tokens[j].end]),
+			})
+		}
+	}
+	return nGrams
+}
+
+// tokenize splits the text into words made of letters and digits, which may be joined by apostrophes, hyphens and dots
+func tokenize(runes []rune) []token {
+	var tokens []token
+	start := -1
+	for i, r := range runes {
+		switch {
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		case start >= 0 && strings.ContainsRune("'’-.", r) && i+1 < len(runes) && isWordRune(runes[i+1]):
+			// joiner inside a word, e.g. O'Neill, Rolls-Royce or U.S
+		default:
+			if start >= 0 {
+				tokens = append(tokens, token{start: start, end: i})
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start: start, end: len(runes)})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// breaksNGram tells whether the separator between two words ends a phrase
+func breaksNGram(separator []rune) bool {
+	for _, r := range separator {
+		if r == '\n' || (unicode.IsPunct(r) && r != '&' && r != '-') {
+			return true
+		}
+	}
+	return false
+}
+
+func isStopWord(word string) bool {
+	return stopWords[strings.ToLower(word)]
+}
+
+// isMentionWord leaves out the single words which are too short or only made of digits to be a mention on their own
+func isMentionWord(word string) bool {
+	if len([]rune(word)) < 2 {
+		return false
+	}
+	return strings.IndexFunc(word, unicode.IsLetter) >= 0
+}
+
+func hasLabel(c EsConceptModel, text string) bool {
+	normalised := normaliseLabel(text)
+	if normaliseLabel(c.PrefLabel) == normalised {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if normaliseLabel(alias) == normalised {
+			return true
+		}
+	}
+	return false
+}
+
+func normaliseLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// longestMentions drops the mentions overlapping a longer (or, for the same length, a better scoring) one, and returns
+// the remaining ones in the order of the text
+func longestMentions(annotations []Annotation) []Annotation {
+	byLength := append([]Annotation(nil), annotations...)
+	sort.SliceStable(byLength, func(i, j int) bool {
+		li, lj := byLength[i].End-byLength[i].Start, byLength[j].End-byLength[j].Start
+		if li != lj {
+			return li > lj
+		}
+		return byLength[i].Score > byLength[j].Score
+	})
+
+	selected := []Annotation{}
+	for _, a := range byLength {
+		overlaps := false
+		for _, s := range selected {
+			if a.Start < s.End && s.Start < a.End {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			selected = append(selected, a)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Start < selected[j].Start
+	})
+	return selected
+}
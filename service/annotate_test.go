@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nGramTexts(nGrams []nGram) []string {
+	var texts []string
+	for _, n := range nGrams {
+		texts = append(texts, n.text)
+	}
+	return texts
+}
+
+func TestCandidateNGrams(t *testing.T) {
+	nGrams := candidateNGrams("The Bank of England raised rates. Rolls-Royce fell")
+
+	assert.Equal(t, []string{
+		"Bank", "Bank of England", "Bank of England raised", "England", "England raised", "England raised rates", "raised", "raised rates", "rates",
+		"Rolls-Royce", "Rolls-Royce fell", "fell",
+	}, nGramTexts(nGrams))
+}
+
+func TestCandidateNGramsCharacterOffsets(t *testing.T) {
+	nGrams := candidateNGrams("Über Zürich")
+
+	require.Len(t, nGrams, 3)
+	assert.Equal(t, nGram{start: 0, end: 11, text: "Über Zürich"}, nGrams[1])
+	assert.Equal(t, nGram{start: 5, end: 11, text: "Zürich"}, nGrams[2])
+}
+
+func TestCandidateNGramsSkipsShortAndNumericWords(t *testing.T) {
+	nGrams := candidateNGrams("a, 2019, X")
+
+	assert.Empty(t, nGrams)
+}
+
+func TestLongestMentions(t *testing.T) {
+	annotations := []Annotation{
+		{Start: 4, End: 8, Text: "Bank", Score: 3},
+		{Start: 4, End: 19, Text: "Bank of England", Score: 1},
+		{Start: 12, End: 19, Text: "England", Score: 5},
+		{Start: 20, End: 26, Text: "London", Score: 2},
+	}
+
+	assert.Equal(t, []Annotation{annotations[1], annotations[3]}, longestMentions(annotations))
+}
+
+// newBestMatchESStub answers the multi search requests of the best match search with the concepts of the given labels
+func newBestMatchESStub(t *testing.T, concepts map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasSuffix(r.URL.Path, "/_msearch"), "unexpected request %v", r.URL.Path)
+
+		var responses []string
+		scanner := bufio.NewScanner(r.Body)
+		for line := 0; scanner.Scan(); line++ {
+			if line%2 == 0 {
+				continue // header
+			}
+			var body struct {
+				Query struct {
+					Bool struct {
+						Must struct {
+							Match map[string]struct {
+								Query string `json:"query"`
+							} `json:"match"`
+						} `json:"must"`
+					} `json:"bool"`
+				} `json:"query"`
+			}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &body))
+			term := body.Query.Bool.Must.Match["aliases"].Query
+
+			hits := ""
+			if id, found := concepts[strings.ToLower(term)]; found {
+				hits = fmt.Sprintf(`{"_id":"%[1]s","_score":7.5,"_source":{"id":"http://api.ft.com/things/%[1]s","prefLabel":"%[2]s","directType":"http://www.ft.com/ontology/organisation/Organisation","aliases":["%[2]s"]}}`, id, term)
+			}
+			responses = append(responses, fmt.Sprintf(`{"hits":{"total":{"value":1,"relation":"eq"},"hits":[%s]},"status":200}`, hits))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"responses":[%s]}`, strings.Join(responses, ","))
+	})
+}
+
+func TestAnnotateText(t *testing.T) {
+	s := newStubbedService(t, newBestMatchESStub(t, map[string]string{
+		"bank of england": "e6b1d1a4-5ff8-3c1f-8ca6-2b0ab4e4e0a1",
+		"england":         "6a6e4a1c-0e87-3f3a-96c9-2c0b1c4e1d9f",
+		"rolls-royce":     "2b7e8a4d-3c5f-3e8b-9e3c-8f7d1a2b3c4d",
+	}))
+
+	annotations, err := s.AnnotateText(context.Background(), "The Bank of England raised rates. Rolls-Royce fell", nil)
+
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	assert.Equal(t, 4, annotations[0].Start)
+	assert.Equal(t, 19, annotations[0].End)
+	assert.Equal(t, "Bank of England", annotations[0].Text)
+	assert.Equal(t, "e6b1d1a4-5ff8-3c1f-8ca6-2b0ab4e4e0a1", annotations[0].Concept.UUID)
+	assert.Equal(t, 7.5, annotations[0].Score)
+	assert.Equal(t, 34, annotations[1].Start)
+	assert.Equal(t, 45, annotations[1].End)
+	assert.Equal(t, "Rolls-Royce", annotations[1].Text)
+}
+
+func TestAnnotateTextInvalidInput(t *testing.T) {
+	s := NewEsConceptSearchService("concept", "all-concepts", 50, 10, 10)
+
+	_, err := s.AnnotateText(context.Background(), "  ", nil)
+	assert.Equal(t, errEmptyAnnotateText, err)
+
+	_, err = s.AnnotateText(context.Background(), strings.Repeat("a", maxAnnotateTextLength+1), nil)
+	assert.Error(t, err)
+}
+
+func TestAnnotateTextLimitsTheLookups(t *testing.T) {
+	s := NewEsConceptSearchService("concept", "all-concepts", 50, 10, 10)
+	var words []string
+	for i := 0; i < 200; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+	text := strings.Join(words, " ")
+	require.LessOrEqual(t, len(text), maxAnnotateTextLength)
+
+	_, err := s.AnnotateText(context.Background(), text, nil)
+
+	assert.EqualError(t, err, "the text to annotate has more than 500 distinct phrases to look up", "no search is sent")
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsSigner "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	awsSigningService = "es"
+	// credentialsExpiryWindow is how long before they expire the credentials are retrieved again, so that no request is
+	// signed with credentials about to expire
+	credentialsExpiryWindow = 5 * time.Minute
+)
+
+// NewAWSCredentials returns the credentials of the default chain: the environment variables, the web identity token of
+// IAM roles for service accounts, the shared credentials file, then the container or instance role. They are retrieved
+// again before they expire, or once Expire is called.
+func NewAWSCredentials() (*credentials.Credentials, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewCredentials(&credentials.ChainProvider{
+		VerboseErrors: true,
+		Providers:     awsCredentialProviders(sess),
+	}), nil
+}
+
+func awsCredentialProviders(sess *session.Session) []credentials.Provider {
+	providers := []credentials.Provider{&credentials.EnvProvider{}}
+	tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile != "" && roleARN != "" {
+		webIdentity := stscreds.NewWebIdentityRoleProviderWithToken(sts.New(sess), roleARN, os.Getenv("AWS_ROLE_SESSION_NAME"), stscreds.FetchTokenPath(tokenFile))
+		webIdentity.ExpiryWindow = credentialsExpiryWindow
+		providers = append(providers, webIdentity)
+	}
+	return append(providers,
+		&credentials.SharedCredentialsProvider{},
+		defaults.RemoteCredProvider(*sess.Config, sess.Handlers),
+	)
+}
+
+// awsSigningTransport signs the requests with AWS signature version 4 before sending them with the next transport.
+// The credentials are retrieved when they have expired, so that refreshed credentials are picked up.
+type awsSigningTransport struct {
+	credentials *credentials.Credentials
+	region      string
+	next        http.RoundTripper
+	now         func() time.Time
+}
+
+func newAWSSigningTransport(creds *credentials.Credentials, region string, next http.RoundTripper) awsSigningTransport {
+	return awsSigningTransport{credentials: creds, region: region, next: next, now: time.Now}
+}
+
+// RoundTrip implementation
+func (a awsSigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip should not modify the request
+	signed := req.Clone(req.Context())
+
+	var body io.ReadSeeker
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body with error: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	signer := awsSigner.NewSigner(a.credentials)
+	if _, err := signer.Sign(signed, body, awsSigningService, a.region, a.now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+	return a.next.RoundTrip(signed)
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsSigner "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var authorizationRegex = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/\d{8}/([^/]+)/([^/]+)/aws4_request, SignedHeaders=([^,]+), Signature=[0-9a-f]+$`)
+
+// signatureVerifyingStub is an ES stub which signs every request again with the secret of its access key, answering
+// 403 if the signatures differ. It records the access keys and the bodies of the verified requests.
+type signatureVerifyingStub struct {
+	sync.Mutex
+	secrets    map[string]string
+	region     string
+	accessKeys []string
+	bodies     []string
+}
+
+func (s *signatureVerifyingStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.verify(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"cluster_name":"signed","status":"green"}`)
+}
+
+func (s *signatureVerifyingStub) verify(r *http.Request) error {
+	authorization := r.Header.Get("Authorization")
+	match := authorizationRegex.FindStringSubmatch(authorization)
+	if match == nil {
+		return fmt.Errorf("invalid authorization %q", authorization)
+	}
+	accessKey, region, service, signedHeaders := match[1], match[2], match[3], match[4]
+	if region != s.region || service != "es" {
+		return fmt.Errorf("signed for %v in %v", service, region)
+	}
+	s.Lock()
+	defer s.Unlock()
+	secret, found := s.secrets[accessKey]
+	if !found {
+		return fmt.Errorf("unknown access key %v", accessKey)
+	}
+	signTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	expected, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for _, header := range strings.Split(signedHeaders, ";") {
+		if header != "host" {
+			expected.Header.Set(header, r.Header.Get(header))
+		}
+	}
+	signer := awsSigner.NewSigner(credentials.NewStaticCredentials(accessKey, secret, r.Header.Get("X-Amz-Security-Token")))
+	if _, err := signer.Sign(expected, bytes.NewReader(body), "es", region, signTime); err != nil {
+		return err
+	}
+	if expected.Header.Get("Authorization") != authorization {
+		return fmt.Errorf("signature mismatch")
+	}
+	s.accessKeys = append(s.accessKeys, accessKey)
+	s.bodies = append(s.bodies, string(body))
+	return nil
+}
+
+func newSignatureVerifyingStub(t *testing.T, secrets map[string]string) (*signatureVerifyingStub, string) {
+	stub := &signatureVerifyingStub{secrets: secrets, region: "eu-west-1"}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server.URL
+}
+
+// rotatingProvider hands out the next of its access keys every time the credentials are retrieved
+type rotatingProvider struct {
+	keys      []string
+	retrieved int
+	expired   bool
+}
+
+func (p *rotatingProvider) Retrieve() (credentials.Value, error) {
+	key := p.keys[p.retrieved%len(p.keys)]
+	p.retrieved++
+	p.expired = false
+	return credentials.Value{AccessKeyID: key, SecretAccessKey: "secret-" + key, ProviderName: "rotating"}, nil
+}
+
+func (p *rotatingProvider) IsExpired() bool {
+	return p.expired
+}
+
+func send(t *testing.T, transport http.RoundTripper, method string, url string, body string) int {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSigningTransportSignsRequests(t *testing.T) {
+	stub, url := newSignatureVerifyingStub(t, map[string]string{"AKID": "secret"})
+	transport := newAWSSigningTransport(credentials.NewStaticCredentials("AKID", "secret", "session-token"), "eu-west-1", http.DefaultTransport)
+
+	assert.Equal(t, http.StatusOK, send(t, transport, http.MethodGet, url+"/_cluster/health?local=true", ""))
+	assert.Equal(t, http.StatusOK, send(t, transport, http.MethodPost, url+"/concepts/_search", `{"query":{"match_all":{}}}`))
+	assert.Equal(t, []string{"", `{"query":{"match_all":{}}}`}, stub.bodies, "the body is sent along with its signature")
+}
+
+func TestSigningTransportWithWrongSecret(t *testing.T) {
+	_, url := newSignatureVerifyingStub(t, map[string]string{"AKID": "secret"})
+	transport := newAWSSigningTransport(credentials.NewStaticCredentials("AKID", "not-the-secret", ""), "eu-west-1", http.DefaultTransport)
+
+	assert.Equal(t, http.StatusForbidden, send(t, transport, http.MethodGet, url+"/_cluster/health", ""))
+}
+
+func TestSigningTransportDoesNotModifyTheRequest(t *testing.T) {
+	_, url := newSignatureVerifyingStub(t, map[string]string{"AKID": "secret"})
+	transport := newAWSSigningTransport(credentials.NewStaticCredentials("AKID", "secret", ""), "eu-west-1", http.DefaultTransport)
+	req, err := http.NewRequest(http.MethodGet, url+"/_cluster/health", nil)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestSigningTransportPicksUpRefreshedCredentials(t *testing.T) {
+	stub, url := newSignatureVerifyingStub(t, map[string]string{"AKID1": "secret-AKID1", "AKID2": "secret-AKID2"})
+	provider := &rotatingProvider{keys: []string{"AKID1", "AKID2"}}
+	creds := credentials.NewCredentials(provider)
+	transport := newAWSSigningTransport(creds, "eu-west-1", http.DefaultTransport)
+
+	assert.Equal(t, http.StatusOK, send(t, transport, http.MethodGet, url+"/", ""))
+	assert.Equal(t, http.StatusOK, send(t, transport, http.MethodGet, url+"/", ""))
+	provider.expired = true
+	assert.Equal(t, http.StatusOK, send(t, transport, http.MethodGet, url+"/", ""))
+
+	assert.Equal(t, []string{"AKID1", "AKID1", "AKID2"}, stub.accessKeys)
+}
+
+func TestAWSClientSignsRequests(t *testing.T) {
+	stub, url := newSignatureVerifyingStub(t, map[string]string{"AKID": "secret"})
+
+	ec, err := NewAWSClient(newAWSAccessConfig(credentials.NewStaticCredentials("AKID", "secret", ""), url, "eu-west-1"), DefaultHTTPConfig(), false)
+	require.NoError(t, err)
+	health, err := ec.ClusterHealth().Do(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, "signed", health.ClusterName)
+	assert.NotEmpty(t, stub.accessKeys)
+}
+
+func TestAWSClustersSignRequestsForTheRegionOfTheirEndpoint(t *testing.T) {
+	stub, url := newSignatureVerifyingStub(t, map[string]string{"AKID": "secret"})
+	stub.region = "eu-central-1"
+	endpoints, err := ParseEndpoints([]string{url + ";region=eu-central-1"}, "http")
+	require.NoError(t, err)
+
+	clusters := NewAWSClusters(endpoints, credentials.NewStaticCredentials("AKID", "secret", ""), "eu-west-1", DefaultHTTPConfig(), time.Second)
+
+	assert.True(t, clusters.CheckCluster(context.Background(), 0).Healthy)
+}
+
+func TestAWSCredentialsFromTheEnvironment(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	creds, err := NewAWSCredentials()
+	require.NoError(t, err)
+	value, err := creds.Get()
+
+	require.NoError(t, err)
+	assert.Equal(t, "AKID", value.AccessKeyID)
+	assert.Equal(t, credentials.EnvProviderName, value.ProviderName)
+}
+
+func TestAWSCredentialsFromWebIdentity(t *testing.T) {
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/concept-search-api")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	sess, err := session.NewSession()
+	require.NoError(t, err)
+
+	providers := awsCredentialProviders(sess)
+	require.Len(t, providers, 4)
+	webIdentity, ok := providers[1].(*stscreds.WebIdentityRoleProvider)
+	require.True(t, ok, "the web identity token is used after the environment variables")
+	assert.Equal(t, credentialsExpiryWindow, webIdentity.ExpiryWindow, "the credentials are refreshed before they expire")
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// BackendKind is the search engine the cluster runs, which selects the backend the services query it with
+type BackendKind string
+
+const (
+	Elasticsearch BackendKind = "elasticsearch"
+	OpenSearch    BackendKind = "opensearch"
+
+	openSearchDistribution = "opensearch"
+)
+
+func ParseBackendKind(kind string) (BackendKind, error) {
+	switch BackendKind(kind) {
+	case Elasticsearch, OpenSearch:
+		return BackendKind(kind), nil
+	}
+	return "", fmt.Errorf("unknown search backend %q", kind)
+}
+
+// New returns the backend querying the cluster through the client, which holds the connection to the cluster
+func (k BackendKind) New(client *elastic.Client) Backend {
+	if k == OpenSearch {
+		return &openSearchBackend{client: client}
+	}
+	return &elasticsearchBackend{client: client}
+}
+
+// SearchRequest is a search of an index, its source written in the query DSL which both Elasticsearch and OpenSearch
+// understand
+type SearchRequest struct {
+	Index      string
+	Source     *elastic.SearchSource
+	SearchType string // e.g. dfs_query_then_fetch, query_then_fetch if not set
+}
+
+// Backend runs the requests of the services on the cluster
+type Backend interface {
+	Search(ctx context.Context, request SearchRequest) (*elastic.SearchResult, error)
+	// MultiSearch runs the searches in a single request, their responses coming in the order of the searches
+	MultiSearch(ctx context.Context, requests []SearchRequest) (*elastic.MultiSearchResult, error)
+	IndexExists(ctx context.Context, index string) (bool, error)
+	Count(ctx context.Context, index string) (int64, error)
+	// FieldMappings returns the mappings of the fields in every index behind the index, which may be an alias
+	FieldMappings(ctx context.Context, index string, fields []string) (FieldMappings, error)
+	ClusterHealth(ctx context.Context) (*elastic.ClusterHealthResponse, error)
+	// Version returns the version of the search engine, failing if the cluster does not run the one of the backend
+	Version(ctx context.Context) (string, error)
+}
+
+// elasticsearchBackend queries Elasticsearch with the services of the elastic client
+type elasticsearchBackend struct {
+	client *elastic.Client
+}
+
+func (b *elasticsearchBackend) Search(ctx context.Context, request SearchRequest) (*elastic.SearchResult, error) {
+	search := b.client.Search(request.Index).SearchSource(request.Source)
+	if request.SearchType != "" {
+		search = search.SearchType(request.SearchType)
+	}
+	return search.Do(ctx)
+}
+
+func (b *elasticsearchBackend) MultiSearch(ctx context.Context, requests []SearchRequest) (*elastic.MultiSearchResult, error) {
+	search := b.client.MultiSearch()
+	for _, request := range requests {
+		r := elastic.NewSearchRequest().Index(request.Index).SearchSource(request.Source)
+		if request.SearchType != "" {
+			r = r.SearchType(request.SearchType)
+		}
+		search = search.Add(r)
+	}
+	return search.Do(ctx)
+}
+
+func (b *elasticsearchBackend) IndexExists(ctx context.Context, index string) (bool, error) {
+	return b.client.IndexExists(index).Do(ctx)
+}
+
+func (b *elasticsearchBackend) Count(ctx context.Context, index string) (int64, error) {
+	return b.client.Count(index).Do(ctx)
+}
+
+func (b *elasticsearchBackend) FieldMappings(ctx context.Context, index string, fields []string) (FieldMappings, error) {
+	return getFieldMappings(ctx, b.client, index, fields)
+}
+
+func (b *elasticsearchBackend) ClusterHealth(ctx context.Context) (*elastic.ClusterHealthResponse, error) {
+	return b.client.ClusterHealth().Do(ctx)
+}
+
+func (b *elasticsearchBackend) Version(ctx context.Context) (string, error) {
+	info, err := getClusterInfo(ctx, b.client)
+	if err != nil {
+		return "", err
+	}
+	if info.Version.Distribution == openSearchDistribution {
+		return "", fmt.Errorf("the cluster runs OpenSearch %v, not Elasticsearch", info.Version.Number)
+	}
+	return info.Version.Number, nil
+}
+
+// openSearchBackend queries OpenSearch with requests of its own sent through the connection of the elastic client, so
+// that the responses are not parsed by the services of the client which expect them from Elasticsearch
+type openSearchBackend struct {
+	client *elastic.Client
+}
+
+func (b *openSearchBackend) Search(ctx context.Context, request SearchRequest) (*elastic.SearchResult, error) {
+	source, err := request.Source.Source()
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	if request.SearchType != "" {
+		params.Set("search_type", request.SearchType)
+	}
+	result := new(elastic.SearchResult)
+	err = b.perform(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/%v/_search", url.PathEscape(request.Index)),
+		Params: params,
+		Body:   source,
+	}, result)
+	return result, err
+}
+
+func (b *openSearchBackend) MultiSearch(ctx context.Context, requests []SearchRequest) (*elastic.MultiSearchResult, error) {
+	var body strings.Builder
+	for _, request := range requests {
+		header := map[string]string{"index": request.Index}
+		if request.SearchType != "" {
+			header["search_type"] = request.SearchType
+		}
+		source, err := request.Source.Source()
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range []interface{}{header, source} {
+			encoded, err := json.Marshal(line)
+			if err != nil {
+				return nil, err
+			}
+			body.Write(encoded)
+			body.WriteByte('\n')
+		}
+	}
+	result := new(elastic.MultiSearchResult)
+	err := b.perform(ctx, elastic.PerformRequestOptions{
+		Method:      http.MethodPost,
+		Path:        "/_msearch",
+		Body:        body.String(),
+		ContentType: "application/x-ndjson",
+	}, result)
+	return result, err
+}
+
+func (b *openSearchBackend) IndexExists(ctx context.Context, index string) (bool, error) {
+	response, err := b.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       http.MethodHead,
+		Path:         "/" + url.PathEscape(index),
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return false, err
+	}
+	return response.StatusCode == http.StatusOK, nil
+}
+
+func (b *openSearchBackend) Count(ctx context.Context, index string) (int64, error) {
+	var result struct {
+		Count int64 `json:"count"`
+	}
+	err := b.perform(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/%v/_count", url.PathEscape(index)),
+	}, &result)
+	return result.Count, err
+}
+
+func (b *openSearchBackend) FieldMappings(ctx context.Context, index string, fields []string) (FieldMappings, error) {
+	return getFieldMappings(ctx, b.client, index, fields)
+}
+
+func (b *openSearchBackend) ClusterHealth(ctx context.Context) (*elastic.ClusterHealthResponse, error) {
+	health := new(elastic.ClusterHealthResponse)
+	err := b.perform(ctx, elastic.PerformRequestOptions{Method: http.MethodGet, Path: "/_cluster/health"}, health)
+	return health, err
+}
+
+func (b *openSearchBackend) Version(ctx context.Context) (string, error) {
+	info, err := getClusterInfo(ctx, b.client)
+	if err != nil {
+		return "", err
+	}
+	if info.Version.Distribution != openSearchDistribution {
+		return "", fmt.Errorf("the cluster runs Elasticsearch %v, not OpenSearch", info.Version.Number)
+	}
+	return info.Version.Number, nil
+}
+
+func (b *openSearchBackend) perform(ctx context.Context, options elastic.PerformRequestOptions, result interface{}) error {
+	response, err := b.client.PerformRequest(ctx, options)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(response.Body, result)
+}
+
+// clusterInfo is the response of the root endpoint, its version distribution being only set by OpenSearch
+type clusterInfo struct {
+	Version struct {
+		Distribution string `json:"distribution"`
+		Number       string `json:"number"`
+	} `json:"version"`
+}
+
+func getClusterInfo(ctx context.Context, client *elastic.Client) (*clusterInfo, error) {
+	response, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{Method: http.MethodGet, Path: "/"})
+	if err != nil {
+		return nil, err
+	}
+	info := new(clusterInfo)
+	if err := json.Unmarshal(response.Body, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// getFieldMappings calls the typeless get field mapping API of ES 7 and OpenSearch, the client only knows of the one
+// with a mapping type
+func getFieldMappings(ctx context.Context, client *elastic.Client, index string, fields []string) (FieldMappings, error) {
+	response, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   fmt.Sprintf("/%v/_mapping/field/%v", url.PathEscape(index), strings.Join(fields, ",")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var mappings FieldMappings
+	if err := json.Unmarshal(response.Body, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
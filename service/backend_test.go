@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	openSearchInfo    = `{"name":"node-1","version":{"distribution":"opensearch","number":"2.11.0","minimum_wire_compatibility_version":"7.10.0"},"tagline":"The OpenSearch Project: https://opensearch.org/"}`
+	elasticsearchInfo = `{"name":"node-1","version":{"number":"7.10.2","build_flavor":"default"},"tagline":"You Know, for Search"}`
+)
+
+// backendStub is a cluster stub answering the requests of the backends, recording them along with their bodies
+type backendStub struct {
+	sync.Mutex
+	info     string
+	requests []string
+	bodies   []string
+	types    []string
+}
+
+func (b *backendStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	b.Lock()
+	b.requests = append(b.requests, r.Method+" "+r.URL.RequestURI())
+	b.bodies = append(b.bodies, string(body))
+	b.types = append(b.types, r.Header.Get("Content-Type"))
+	b.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/":
+		fmt.Fprint(w, b.info)
+	case r.URL.Path == "/_cluster/health":
+		fmt.Fprint(w, `{"cluster_name":"search","status":"yellow","number_of_nodes":3}`)
+	case strings.HasSuffix(r.URL.Path, "/_count"):
+		fmt.Fprint(w, `{"count":1234,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0}}`)
+	case r.URL.Path == "/_msearch":
+		fmt.Fprint(w, `{"responses":[{"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"concepts","_id":"1","_score":1,"_source":{"prefLabel":"first"}}]}},{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}]}`)
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		fmt.Fprint(w, `{"took":3,"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"concepts","_id":"1","_score":1,"_source":{"prefLabel":"first"}}]}}`)
+	case r.Method == http.MethodHead && r.URL.Path == "/concepts":
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`)
+	}
+}
+
+func (b *backendStub) last() (string, string, string) {
+	b.Lock()
+	defer b.Unlock()
+	i := len(b.requests) - 1
+	return b.requests[i], b.bodies[i], b.types[i]
+}
+
+func newBackendStub(t *testing.T, kind BackendKind, info string) (*backendStub, Backend) {
+	stub := &backendStub{info: info}
+	return stub, kind.New(newStubbedClient(t, stub))
+}
+
+func TestParseBackendKind(t *testing.T) {
+	kind, err := ParseBackendKind("opensearch")
+	assert.NoError(t, err)
+	assert.Equal(t, OpenSearch, kind)
+
+	_, err = ParseBackendKind("solr")
+	assert.EqualError(t, err, `unknown search backend "solr"`)
+}
+
+func TestBackendsSearch(t *testing.T) {
+	for _, kind := range []BackendKind{Elasticsearch, OpenSearch} {
+		t.Run(string(kind), func(t *testing.T) {
+			stub, backend := newBackendStub(t, kind, "")
+
+			result, err := backend.Search(context.Background(), SearchRequest{
+				Index:      "concepts",
+				Source:     elastic.NewSearchSource().Size(5).Query(elastic.NewTermQuery("type", "people")),
+				SearchType: "dfs_query_then_fetch",
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), result.TotalHits())
+			assert.Equal(t, "1", result.Hits.Hits[0].Id)
+			request, body, _ := stub.last()
+			assert.Equal(t, "POST /concepts/_search?search_type=dfs_query_then_fetch", request)
+			assert.JSONEq(t, `{"size":5,"query":{"term":{"type":"people"}}}`, body)
+		})
+	}
+}
+
+func TestBackendsMultiSearch(t *testing.T) {
+	for _, kind := range []BackendKind{Elasticsearch, OpenSearch} {
+		t.Run(string(kind), func(t *testing.T) {
+			stub, backend := newBackendStub(t, kind, "")
+
+			result, err := backend.MultiSearch(context.Background(), []SearchRequest{
+				{Index: "concepts", Source: elastic.NewSearchSource().Size(1).Query(elastic.NewMatchQuery("aliases", "first"))},
+				{Index: "concepts", Source: elastic.NewSearchSource().Size(1).Query(elastic.NewMatchQuery("aliases", "second"))},
+			})
+
+			require.NoError(t, err)
+			require.Len(t, result.Responses, 2)
+			assert.Equal(t, int64(1), result.Responses[0].TotalHits())
+			assert.Equal(t, int64(0), result.Responses[1].TotalHits())
+			_, body, _ := stub.last()
+			lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+			require.Len(t, lines, 4)
+			assert.JSONEq(t, `{"index":"concepts"}`, lines[0])
+			assert.JSONEq(t, `{"size":1,"query":{"match":{"aliases":{"query":"first"}}}}`, lines[1])
+			assert.JSONEq(t, `{"index":"concepts"}`, lines[2])
+		})
+	}
+}
+
+func TestOpenSearchMultiSearchIsNDJSON(t *testing.T) {
+	stub, backend := newBackendStub(t, OpenSearch, "")
+
+	_, err := backend.MultiSearch(context.Background(), []SearchRequest{{Index: "concepts", Source: elastic.NewSearchSource()}})
+
+	require.NoError(t, err)
+	request, _, contentType := stub.last()
+	assert.Equal(t, "POST /_msearch", request)
+	assert.Equal(t, "application/x-ndjson", contentType)
+}
+
+func TestBackendsIndexExists(t *testing.T) {
+	for _, kind := range []BackendKind{Elasticsearch, OpenSearch} {
+		t.Run(string(kind), func(t *testing.T) {
+			_, backend := newBackendStub(t, kind, "")
+
+			exists, err := backend.IndexExists(context.Background(), "concepts")
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			exists, err = backend.IndexExists(context.Background(), "missing")
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestBackendsCount(t *testing.T) {
+	for _, kind := range []BackendKind{Elasticsearch, OpenSearch} {
+		t.Run(string(kind), func(t *testing.T) {
+			stub, backend := newBackendStub(t, kind, "")
+
+			count, err := backend.Count(context.Background(), "concepts")
+
+			require.NoError(t, err)
+			assert.Equal(t, int64(1234), count)
+			request, _, _ := stub.last()
+			assert.Equal(t, "POST /concepts/_count", request)
+		})
+	}
+}
+
+func TestBackendsClusterHealth(t *testing.T) {
+	for _, kind := range []BackendKind{Elasticsearch, OpenSearch} {
+		t.Run(string(kind), func(t *testing.T) {
+			_, backend := newBackendStub(t, kind, "")
+
+			health, err := backend.ClusterHealth(context.Background())
+
+			require.NoError(t, err)
+			assert.Equal(t, "yellow", health.Status)
+			assert.Equal(t, 3, health.NumberOfNodes)
+		})
+	}
+}
+
+func TestBackendsVersion(t *testing.T) {
+	tests := []struct {
+		kind            BackendKind
+		info            string
+		expectedVersion string
+		expectedError   string
+	}{
+		{kind: Elasticsearch, info: elasticsearchInfo, expectedVersion: "7.10.2"},
+		{kind: Elasticsearch, info: openSearchInfo, expectedError: "the cluster runs OpenSearch 2.11.0, not Elasticsearch"},
+		{kind: OpenSearch, info: openSearchInfo, expectedVersion: "2.11.0"},
+		{kind: OpenSearch, info: elasticsearchInfo, expectedError: "the cluster runs Elasticsearch 7.10.2, not OpenSearch"},
+	}
+	for _, test := range tests {
+		_, backend := newBackendStub(t, test.kind, test.info)
+
+		version, err := backend.Version(context.Background())
+
+		if test.expectedError != "" {
+			assert.EqualError(t, err, test.expectedError)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedVersion, version)
+	}
+}
+
+func TestSearchServiceWithOpenSearchBackend(t *testing.T) {
+	stub := &backendStub{info: openSearchInfo}
+	s := newStubbedService(t, stub, func(s *esConceptSearchService) { s.SetBackend(OpenSearch) })
+
+	concepts, err := s.SearchConceptByTextAndTypes(context.Background(), "first", []string{"http://www.ft.com/ontology/person/Person"}, false, false, false, nil)
+
+	require.NoError(t, err)
+	require.Len(t, concepts, 1)
+	assert.Equal(t, "first", concepts[0].PrefLabel)
+	request, _, _ := stub.last()
+	assert.Equal(t, "POST /concepts/_search?search_type=dfs_query_then_fetch", request)
+}
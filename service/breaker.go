@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // the calls go through
+	BreakerOpen     BreakerState = "open"      // the calls fail fast with util.ErrCircuitOpen
+	BreakerHalfOpen BreakerState = "half-open" // a few probe calls go through to find whether the cluster has recovered
+)
+
+// BreakerStatus is the state of the circuit breaker, with the consecutive failures which opened it
+type BreakerStatus struct {
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures"`
+	LastError string       `json:"lastError,omitempty"`
+	OpenedAt  *time.Time   `json:"openedAt,omitempty"`
+}
+
+// CircuitBreaker stops the calls to ES for a while once enough of them have failed in a row, so that the requests fail
+// fast rather than each waiting for a degraded cluster. A nil breaker lets every call through.
+type CircuitBreaker struct {
+	lock           *sync.Mutex
+	maxFailures    int           // consecutive failures which open the breaker
+	openFor        time.Duration // how long the breaker stays open before letting probes through
+	probes         int           // successful probes which close the breaker again
+	state          BreakerState
+	failures       int
+	lastErr        error
+	openedAt       time.Time
+	probesInFlight int
+	probesPassed   int
+	now            func() time.Time
+}
+
+func NewCircuitBreaker(maxFailures int, openFor time.Duration, probes int) *CircuitBreaker {
+	if probes < 1 {
+		probes = 1
+	}
+	return &CircuitBreaker{
+		lock:        &sync.Mutex{},
+		maxFailures: maxFailures,
+		openFor:     openFor,
+		probes:      probes,
+		state:       BreakerClosed,
+		now:         time.Now,
+	}
+}
+
+// Allow tells whether a call can be made, returning util.ErrCircuitOpen if not. Otherwise the returned func must be
+// called with the outcome of the call.
+func (b *CircuitBreaker) Allow() (func(err error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.halfOpenIfDue()
+	switch b.state {
+	case BreakerOpen:
+		return nil, util.ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probesInFlight+b.probesPassed >= b.probes {
+			return nil, util.ErrCircuitOpen
+		}
+		b.probesInFlight++
+		return b.record(true), nil
+	}
+	return b.record(false), nil
+}
+
+// AllowCheck tells whether a health check can be made, returning util.ErrCircuitOpen while the breaker is open. The
+// outcome of a check is not recorded and a check never takes the place of a probe, so that only the calls of the
+// requests tell whether the cluster has recovered.
+func (b *CircuitBreaker) AllowCheck() error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.halfOpenIfDue()
+	if b.state == BreakerOpen {
+		return util.ErrCircuitOpen
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) record(probe bool) func(err error) {
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			if probe {
+				b.probesInFlight--
+			}
+			// a call cancelled by its caller, e.g. the losing attempt of a hedged search, tells nothing of the cluster
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			if isBreakerFailure(err) {
+				b.failed(err, probe)
+			} else {
+				b.succeeded(probe)
+			}
+		})
+	}
+}
+
+func (b *CircuitBreaker) failed(err error, probe bool) {
+	b.failures++
+	b.lastErr = err
+	if probe && b.state == BreakerHalfOpen {
+		log.WithError(err).Warn("elasticsearch circuit breaker probe failed, opening the breaker again")
+		b.open()
+	} else if b.state == BreakerClosed && b.failures >= b.maxFailures {
+		log.WithError(err).Warnf("opening the elasticsearch circuit breaker after %d failures in a row", b.failures)
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) succeeded(probe bool) {
+	if !probe {
+		if b.state == BreakerClosed {
+			b.failures = 0
+		}
+		return
+	}
+	if b.state != BreakerHalfOpen {
+		return
+	}
+	b.probesPassed++
+	if b.probesPassed >= b.probes {
+		log.Info("elasticsearch circuit breaker closed, the cluster has recovered")
+		b.state = BreakerClosed
+		b.failures = 0
+		b.lastErr = nil
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.probesInFlight = 0
+	b.probesPassed = 0
+}
+
+func (b *CircuitBreaker) halfOpenIfDue() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openFor {
+		b.state = BreakerHalfOpen
+		b.probesInFlight = 0
+		b.probesPassed = 0
+	}
+}
+
+// Status returns the current state of the breaker
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.halfOpenIfDue()
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// isBreakerFailure tells whether the error is down to the cluster, rather than to the request or to its caller
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var esErr *elastic.Error
+	if errors.As(err, &esErr) {
+		return esErr.Status >= 500
+	}
+	return true
+}
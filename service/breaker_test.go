@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errClusterDown = errors.New("cluster down")
+
+// newTestBreaker returns a breaker whose clock is moved forward by the returned func
+func newTestBreaker(maxFailures int, probes int) (*CircuitBreaker, func(d time.Duration)) {
+	now := time.Date(2024, 1, 16, 10, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker(maxFailures, 30*time.Second, probes)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func call(b *CircuitBreaker, err error) error {
+	done, allowErr := b.Allow()
+	if allowErr != nil {
+		return allowErr
+	}
+	done(err)
+	return nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(3, 1)
+
+	assert.NoError(t, call(b, errClusterDown))
+	assert.NoError(t, call(b, errClusterDown))
+	assert.NoError(t, call(b, nil), "a success resets the failures")
+	assert.Equal(t, 0, b.Status().Failures)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, call(b, errClusterDown))
+	}
+
+	status := b.Status()
+	assert.Equal(t, BreakerOpen, status.State)
+	assert.Equal(t, 3, status.Failures)
+	assert.Equal(t, errClusterDown.Error(), status.LastError)
+	assert.NotNil(t, status.OpenedAt)
+	assert.Equal(t, util.ErrCircuitOpen, call(b, nil), "the calls fail fast")
+}
+
+func TestBreakerIgnoresRequestErrors(t *testing.T) {
+	b, _ := newTestBreaker(1, 1)
+
+	assert.NoError(t, call(b, &elastic.Error{Status: http.StatusBadRequest}))
+	assert.NoError(t, call(b, &elastic.Error{Status: http.StatusNotFound}))
+	assert.NoError(t, call(b, context.Canceled))
+	assert.Equal(t, BreakerClosed, b.Status().State)
+
+	assert.NoError(t, call(b, &elastic.Error{Status: http.StatusServiceUnavailable}))
+	assert.Equal(t, BreakerOpen, b.Status().State)
+}
+
+func TestBreakerLimitsProbes(t *testing.T) {
+	b, wait := newTestBreaker(1, 2)
+	assert.NoError(t, call(b, errClusterDown))
+
+	wait(29 * time.Second)
+	assert.Equal(t, util.ErrCircuitOpen, call(b, nil))
+
+	wait(time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+	done, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	require.NoError(t, err, "a second probe is let through")
+	_, err = b.Allow()
+	assert.Equal(t, util.ErrCircuitOpen, err, "no more than the probes are let through")
+
+	done(nil)
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+}
+
+func TestBreakerClosesOnceAllProbesSucceed(t *testing.T) {
+	b, wait := newTestBreaker(1, 2)
+	assert.NoError(t, call(b, errClusterDown))
+	wait(30 * time.Second)
+
+	assert.NoError(t, call(b, nil))
+	assert.NoError(t, call(b, nil))
+
+	status := b.Status()
+	assert.Equal(t, BreakerClosed, status.State)
+	assert.Equal(t, 0, status.Failures)
+	assert.Nil(t, status.OpenedAt)
+}
+
+func TestBreakerOpensAgainOnFailedProbe(t *testing.T) {
+	b, wait := newTestBreaker(1, 1)
+	assert.NoError(t, call(b, errClusterDown))
+	wait(30 * time.Second)
+
+	assert.NoError(t, call(b, errClusterDown))
+
+	assert.Equal(t, BreakerOpen, b.Status().State)
+	assert.Equal(t, util.ErrCircuitOpen, call(b, nil))
+	wait(30 * time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+}
+
+func TestBreakerIgnoresCancelledProbe(t *testing.T) {
+	b, wait := newTestBreaker(1, 1)
+	assert.NoError(t, call(b, errClusterDown))
+	wait(30 * time.Second)
+
+	assert.NoError(t, call(b, context.Canceled))
+
+	assert.Equal(t, BreakerHalfOpen, b.Status().State, "a cancelled probe does not close the breaker")
+	assert.NoError(t, call(b, nil), "the probe slot is released")
+	assert.Equal(t, BreakerClosed, b.Status().State)
+}
+
+func TestBreakerCancelledCallsDoNotResetFailures(t *testing.T) {
+	b, _ := newTestBreaker(3, 1)
+
+	assert.NoError(t, call(b, errClusterDown))
+	assert.NoError(t, call(b, errClusterDown))
+	assert.NoError(t, call(b, context.Canceled))
+	assert.Equal(t, 2, b.Status().Failures)
+
+	assert.NoError(t, call(b, errClusterDown))
+	assert.Equal(t, BreakerOpen, b.Status().State)
+}
+
+func TestBreakerChecksDoNotProbe(t *testing.T) {
+	b, wait := newTestBreaker(1, 1)
+	assert.NoError(t, call(b, errClusterDown))
+	assert.Equal(t, util.ErrCircuitOpen, b.AllowCheck(), "the checks fail fast while the breaker is open")
+
+	wait(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.AllowCheck())
+	}
+
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+	assert.NoError(t, call(b, nil), "the probe is still available to the requests")
+	assert.Equal(t, BreakerClosed, b.Status().State)
+}
+
+func TestNilBreakerAllowsEveryCall(t *testing.T) {
+	var b *CircuitBreaker
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, call(b, errClusterDown))
+	}
+}
+
+func TestSearchFailsFastWithOpenBreaker(t *testing.T) {
+	var requests int32
+	s := newStubbedService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, "cluster unavailable", http.StatusServiceUnavailable)
+	}), func(s *esConceptSearchService) { s.SetCircuitBreaker(NewCircuitBreaker(2, time.Minute, 1)) })
+
+	for i := 0; i < 2; i++ {
+		_, err := s.FindConceptsById(context.Background(), []string{"8f8b0aa8-1d3f-4b1c-9d0a-5f2b6f3b0c11"}, false)
+		assert.Error(t, err)
+		assert.NotEqual(t, util.ErrCircuitOpen, err)
+	}
+	sent := atomic.LoadInt32(&requests)
+
+	_, err := s.FindConceptsById(context.Background(), []string{"8f8b0aa8-1d3f-4b1c-9d0a-5f2b6f3b0c11"}, false)
+	assert.Equal(t, util.ErrCircuitOpen, err)
+	assert.Equal(t, sent, atomic.LoadInt32(&requests), "no request is sent to ES")
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxConnectWait         = 5 * time.Minute  // cap of the backoff between two connection attempts
+	clientCheckEvery       = 30 * time.Second // how often the health of the client is checked once connected
+	clientCheckTimeout     = 10 * time.Second
+	maxClientCheckFailures = 3 // consecutive failed checks after which the client is rebuilt
+)
+
+// ClientSupervisor connects to the cluster, sets the client of the services, and rebuilds the client once it has failed
+// its health checks several times in a row, e.g. because the cluster endpoint now resolves to other nodes
+type ClientSupervisor struct {
+	newClient    func() (*elastic.Client, error)
+	beforeRetry  func() // called before rebuilding a client, e.g. to refresh its credentials
+	services     []ESService
+	tryEvery     time.Duration
+	maxWait      time.Duration
+	checkEvery   time.Duration
+	maxFailures  int
+	checkCluster func(ctx context.Context, client *elastic.Client) error
+}
+
+func NewSimpleClientSupervisor(endpoint string, httpConfig HTTPConfig, auth ESAuth, traceLogging bool, tryEvery time.Duration, services ...ESService) *ClientSupervisor {
+	return newClientSupervisor(func() (*elastic.Client, error) {
+		return NewSimpleClient(endpoint, httpConfig, auth, traceLogging)
+	}, tryEvery, services)
+}
+
+func NewAWSClientSupervisor(awsCreds *credentials.Credentials, endpoint string, region string, httpConfig HTTPConfig, traceLogging bool, tryEvery time.Duration, services ...ESService) *ClientSupervisor {
+	accessConfig := newAWSAccessConfig(awsCreds, endpoint, region)
+	supervisor := newClientSupervisor(func() (*elastic.Client, error) {
+		return NewAWSClient(accessConfig, httpConfig, traceLogging)
+	}, tryEvery, services)
+	// the credentials are retrieved again, in case the failures are down to them being revoked
+	supervisor.beforeRetry = awsCreds.Expire
+	return supervisor
+}
+
+func newClientSupervisor(newClient func() (*elastic.Client, error), tryEvery time.Duration, services []ESService) *ClientSupervisor {
+	return &ClientSupervisor{
+		newClient:    newClient,
+		beforeRetry:  func() {},
+		services:     services,
+		tryEvery:     tryEvery,
+		maxWait:      maxConnectWait,
+		checkEvery:   clientCheckEvery,
+		maxFailures:  maxClientCheckFailures,
+		checkCluster: checkClusterHealth,
+	}
+}
+
+// Run connects to the cluster then watches the health of the client until the context is done
+func (s *ClientSupervisor) Run(ctx context.Context) {
+	client := s.connect(ctx)
+	if client == nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.checkEvery)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, clientCheckTimeout)
+		err := s.checkCluster(checkCtx, client)
+		cancel()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		log.WithError(err).WithField("failures", failures).Warn("the elasticsearch client failed its health check")
+		if failures < s.maxFailures {
+			continue
+		}
+
+		log.Warnf("rebuilding the elasticsearch client after %d failed health checks", failures)
+		s.beforeRetry()
+		rebuilt := s.connect(ctx)
+		if rebuilt == nil {
+			return
+		}
+		client.Stop()
+		client = rebuilt
+		failures = 0
+	}
+}
+
+// connect builds a client, retrying with a jittered exponential backoff until it succeeds, and sets it on the services.
+// It returns nil if the context is done first.
+func (s *ClientSupervisor) connect(ctx context.Context) *elastic.Client {
+	for attempt := 0; ; attempt++ {
+		ec, err := s.newClient()
+		if err == nil {
+			for _, service := range s.services {
+				service.SetElasticClient(ec)
+			}
+			return ec
+		}
+
+		wait := backoff(s.tryEvery, s.maxWait, attempt)
+		log.WithError(err).Errorf("could not connect to ElasticSearch cluster, retrying in %v...", wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		s.beforeRetry()
+	}
+}
+
+// backoff is the wait before the retry following the failed attempt, doubling from the base up to the max, plus a
+// random jitter of up to half of it so that instances do not retry in lockstep
+func backoff(base time.Duration, max time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 0; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	if jitter := int64(wait / 2); jitter > 0 {
+		wait += time.Duration(rand.Int63n(jitter))
+	}
+	return wait
+}
+
+func checkClusterHealth(ctx context.Context, client *elastic.Client) error {
+	_, err := client.ClusterHealth().Do(ctx)
+	return err
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingESService records the clients it is given
+type recordingESService struct {
+	sync.Mutex
+	clients []*elastic.Client
+}
+
+func (s *recordingESService) SetElasticClient(client *elastic.Client) {
+	s.Lock()
+	defer s.Unlock()
+	s.clients = append(s.clients, client)
+}
+
+func (s *recordingESService) received() []*elastic.Client {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*elastic.Client(nil), s.clients...)
+}
+
+func TestBackoff(t *testing.T) {
+	base := time.Second
+	max := time.Minute
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}
+
+	for attempt, e := range expected {
+		wait := backoff(base, max, attempt)
+		assert.GreaterOrEqual(t, int64(wait), int64(e), "attempt %d", attempt)
+		assert.Less(t, int64(wait), int64(e+e/2), "attempt %d", attempt)
+	}
+}
+
+func TestClientSupervisorRebuildsUnhealthyClient(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer es.Close()
+
+	service := &recordingESService{}
+	var failing, retries int32
+	supervisor := newClientSupervisor(func() (*elastic.Client, error) {
+		return NewSimpleClient(es.URL, DefaultHTTPConfig(), ESAuth{}, false)
+	}, 10*time.Millisecond, []ESService{service})
+	supervisor.checkEvery = 10 * time.Millisecond
+	supervisor.maxFailures = 2
+	supervisor.beforeRetry = func() { atomic.AddInt32(&retries, 1) }
+	supervisor.checkCluster = func(ctx context.Context, client *elastic.Client) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errors.New("cluster unreachable")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go supervisor.Run(ctx)
+
+	assert.Eventually(t, func() bool { return len(service.received()) == 1 }, time.Second, 10*time.Millisecond, "the client is set once connected")
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, service.received(), 1, "a healthy client is kept")
+
+	atomic.StoreInt32(&failing, 1)
+	assert.Eventually(t, func() bool { return len(service.received()) >= 2 }, time.Second, 10*time.Millisecond, "the client is rebuilt")
+	atomic.StoreInt32(&failing, 0)
+
+	clients := service.received()
+	assert.NotSame(t, clients[0], clients[1])
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&retries), int32(1))
+}
+
+func TestClientSupervisorRetriesUntilConnected(t *testing.T) {
+	service := &recordingESService{}
+	var attempts int32
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer es.Close()
+	supervisor := newClientSupervisor(func() (*elastic.Client, error) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return nil, errors.New("no cluster yet")
+		}
+		return NewSimpleClient(es.URL, DefaultHTTPConfig(), ESAuth{}, false)
+	}, 10*time.Millisecond, []ESService{service})
+
+	client := supervisor.connect(context.Background())
+
+	assert.NotNil(t, client)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, []*elastic.Client{client}, service.received())
+}
+
+func TestClientSupervisorStopsWithContext(t *testing.T) {
+	service := &recordingESService{}
+	supervisor := newClientSupervisor(func() (*elastic.Client, error) {
+		return nil, errors.New("no cluster")
+	}, 10*time.Millisecond, []ESService{service})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		supervisor.Run(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the supervisor did not stop")
+	}
+	assert.Empty(t, service.received())
+}
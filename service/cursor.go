@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/Financial-Times/concept-search-api/util"
+)
+
+// typeListingCursor is the position of a page of a multi-type listing: the sort values of the last concept listed of
+// the type, to search after
+type typeListingCursor struct {
+	Type  string        `json:"type"`
+	After []interface{} `json:"after"`
+}
+
+// encodeCursor returns the opaque cursor of the concepts of the type after the given sort values
+func encodeCursor(conceptType string, after []interface{}) string {
+	b, _ := json.Marshal(typeListingCursor{Type: conceptType, After: after})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursors returns the sort values to search after by type. Every cursor must have been returned by a listing of
+// one of the types, and a type can only be given one cursor.
+func decodeCursors(cursors []string, conceptTypes []string) (map[string][]interface{}, error) {
+	listed := make(map[string]bool)
+	for _, t := range conceptTypes {
+		listed[t] = true
+	}
+
+	after := make(map[string][]interface{})
+	for _, cursor := range cursors {
+		var c typeListingCursor
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err == nil {
+			err = json.Unmarshal(b, &c)
+		}
+		if err != nil || !validSortValues(c.After) {
+			return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "cursor", "invalid cursor %v", cursor)
+		}
+		if !listed[c.Type] {
+			return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "cursor", "the cursor %v is for the type %v, which is not listed", cursor, c.Type)
+		}
+		if _, found := after[c.Type]; found {
+			return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "cursor", "more than one cursor for the type %v", c.Type)
+		}
+		after[c.Type] = c.After
+	}
+	return after, nil
+}
+
+// validSortValues checks the values are those of the type listing sort, on prefLabel.raw then _id
+func validSortValues(values []interface{}) bool {
+	if len(values) != 2 {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
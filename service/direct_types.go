@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	directTypesAggregation = "directTypes"
+	maxDirectTypes         = 1000             // buckets of the directType terms aggregation
+	directTypesCacheTTL    = 10 * time.Minute // how long the direct types present in an index are cached for
+	directTypesTimeout     = 10 * time.Second // how long the aggregation shared by the requests of an index may take
+)
+
+// directTypesCache holds the direct types present in every index, as found by a terms aggregation. The lock only
+// guards the maps, the aggregations are run without it.
+type directTypesCache struct {
+	lock     *sync.Mutex
+	entries  map[string]directTypesEntry
+	fetching map[string]*directTypesFetch // the aggregations in flight, shared by the requests for the same index
+}
+
+type directTypesEntry struct {
+	types   map[string]bool
+	fetched time.Time
+}
+
+// directTypesFetch is an aggregation in flight, its result set once done is closed
+type directTypesFetch struct {
+	done  chan struct{}
+	types map[string]bool
+	err   error
+}
+
+func newDirectTypesCache() *directTypesCache {
+	return &directTypesCache{lock: &sync.Mutex{}, entries: make(map[string]directTypesEntry), fetching: make(map[string]*directTypesFetch)}
+}
+
+// validateDirectTypes checks that concepts of every direct type are present in the index
+func (s *esConceptSearchService) validateDirectTypes(ctx context.Context, index string, directTypes []string) error {
+	if len(directTypes) == 0 {
+		return nil
+	}
+	present, err := s.directTypesInIndex(ctx, index)
+	if err != nil {
+		return err
+	}
+	for _, t := range directTypes {
+		if !present[t] {
+			return util.NewInputErrorf(util.ErrCodeInvalidConceptType, "directType", "invalid direct type %v, there are no concepts of this direct type", t)
+		}
+	}
+	return nil
+}
+
+// directTypesInIndex returns the cached direct types of the index, or else waits for their aggregation, which is shared
+// by the requests for the same index. The aggregation is not cancelled with the request which started it, as it is
+// the one of the other requests too.
+func (s *esConceptSearchService) directTypesInIndex(ctx context.Context, index string) (map[string]bool, error) {
+	cache := s.directTypes
+	cache.lock.Lock()
+	if entry, found := cache.entries[index]; found && time.Since(entry.fetched) < directTypesCacheTTL {
+		cache.lock.Unlock()
+		return entry.types, nil
+	}
+	fetch, found := cache.fetching[index]
+	if !found {
+		fetch = &directTypesFetch{done: make(chan struct{})}
+		cache.fetching[index] = fetch
+		go s.fetchDirectTypes(context.WithoutCancel(ctx), index, fetch)
+	}
+	cache.lock.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.types, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *esConceptSearchService) fetchDirectTypes(ctx context.Context, index string, fetch *directTypesFetch) {
+	ctx, cancel := context.WithTimeout(ctx, directTypesTimeout)
+	defer cancel()
+	fetch.types, fetch.err = s.aggregateDirectTypes(ctx, index)
+
+	cache := s.directTypes
+	cache.lock.Lock()
+	if fetch.err == nil {
+		cache.entries[index] = directTypesEntry{types: fetch.types, fetched: time.Now()}
+	}
+	delete(cache.fetching, index)
+	cache.lock.Unlock()
+	close(fetch.done)
+}
+
+func (s *esConceptSearchService) aggregateDirectTypes(ctx context.Context, index string) (map[string]bool, error) {
+	agg := elastic.NewTermsAggregation().Field("directType").Size(maxDirectTypes)
+	result, err := s.doSearch(ctx, SearchRequest{Index: index, Source: elastic.NewSearchSource().Size(0).Aggregation(directTypesAggregation, agg)})
+	if err != nil {
+		log.WithError(err).WithField("index", index).Error("failed to aggregate the direct types")
+		return nil, err
+	}
+
+	types := make(map[string]bool)
+	if terms, found := result.Aggregations.Terms(directTypesAggregation); found {
+		for _, bucket := range terms.Buckets {
+			if t, ok := bucket.Key.(string); ok {
+				types[t] = true
+			}
+		}
+	}
+	return types, nil
+}
+
+// directTypeFilters restricts the concepts to the direct types, if any
+func directTypeFilters(directTypes []string) []elastic.Query {
+	if len(directTypes) == 0 {
+		return nil
+	}
+	return []elastic.Query{elastic.NewTermsQuery("directType", util.ToTerms(directTypes)...)}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const directTypesAggregationResponse = `{"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},"aggregations":{"directTypes":{"buckets":[` +
+	`{"key":"http://www.ft.com/ontology/organisation/Organisation","doc_count":2},` +
+	`{"key":"http://www.ft.com/ontology/company/PrivateCompany","doc_count":1}]}}}`
+
+// directTypesESStub answers the direct types aggregation, and the searches with a single private company, recording
+// the bodies of the searches
+type directTypesESStub struct {
+	aggregations int
+	searches     []map[string]interface{}
+}
+
+func (s *directTypesESStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, found := body["aggregations"]; found {
+		s.aggregations++
+		fmt.Fprint(w, directTypesAggregationResponse)
+		return
+	}
+	s.searches = append(s.searches, body)
+	fmt.Fprint(w, `{"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_id":"1","_source":{"id":"http://api.ft.com/things/2b7e8a4d-3c5f-3e8b-9e3c-8f7d1a2b3c4d","prefLabel":"Private Co","directType":"http://www.ft.com/ontology/company/PrivateCompany"}}]}}`)
+}
+
+func TestFindAllConceptsByTypeWithDirectType(t *testing.T) {
+	stub := &directTypesESStub{}
+	s := newStubbedService(t, stub)
+
+	concepts, err := s.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/organisation/Organisation", false, false, false, []string{"http://www.ft.com/ontology/company/PrivateCompany"})
+
+	require.NoError(t, err)
+	require.Len(t, concepts, 1)
+	assert.Equal(t, "Private Co", concepts[0].PrefLabel)
+	require.Len(t, stub.searches, 1)
+	query, _ := json.Marshal(stub.searches[0]["query"])
+	assert.Contains(t, string(query), `"terms":{"directType":["http://www.ft.com/ontology/company/PrivateCompany"]}`)
+}
+
+func TestSearchWithDirectTypeNotInIndex(t *testing.T) {
+	stub := &directTypesESStub{}
+	s := newStubbedService(t, stub)
+
+	_, err := s.SearchConceptByTextAndTypes(context.Background(), "foo", []string{"http://www.ft.com/ontology/organisation/Organisation"}, false, false, false, []string{"http://www.ft.com/ontology/company/PublicCompany"})
+
+	require.Error(t, err)
+	inputErr, ok := err.(util.InputError)
+	require.True(t, ok, "expected an input error")
+	assert.Equal(t, "directType", inputErr.Parameter())
+	assert.Contains(t, err.Error(), "PublicCompany")
+	assert.Empty(t, stub.searches, "the search should not be sent")
+}
+
+func TestDirectTypesOfTheIndexAreCached(t *testing.T) {
+	stub := &directTypesESStub{}
+	s := newStubbedService(t, stub)
+	directTypes := []string{"http://www.ft.com/ontology/company/PrivateCompany"}
+
+	for i := 0; i < 3; i++ {
+		_, err := s.SearchConceptByTextAndTypesInTextMode(context.Background(), "foo", []string{"http://www.ft.com/ontology/organisation/Organisation"}, false, false, false, directTypes)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, stub.aggregations)
+	assert.Len(t, stub.searches, 3)
+}
+
+func TestNoDirectTypesAggregationWithoutDirectTypes(t *testing.T) {
+	stub := &directTypesESStub{}
+	s := newStubbedService(t, stub)
+
+	_, err := s.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/organisation/Organisation", false, false, false, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, stub.aggregations)
+}
+
+func TestDirectTypesAggregationIsSharedAndDoesNotBlockOtherIndices(t *testing.T) {
+	release := make(chan struct{})
+	var aggregations int32
+	s := newStubbedService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&aggregations, 1)
+		if strings.HasPrefix(r.URL.Path, "/concepts/") {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, directTypesAggregationResponse)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			types, err := s.directTypesInIndex(context.Background(), "concepts")
+			assert.NoError(t, err)
+			assert.True(t, types["http://www.ft.com/ontology/company/PrivateCompany"])
+		}()
+	}
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&aggregations) == 1 }, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := s.directTypesInIndex(ctx, "all-concepts")
+	require.NoError(t, err, "the aggregation of another index should not wait for the one in flight")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&aggregations), "one aggregation per index")
+}
+
+func TestDirectTypesAggregationOutlivesTheRequestWhichStartedIt(t *testing.T) {
+	release := make(chan struct{})
+	var aggregations int32
+	s := newStubbedService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&aggregations, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, directTypesAggregationResponse)
+	}))
+
+	superseded, cancel := context.WithCancel(context.Background())
+	started := make(chan error)
+	go func() {
+		_, err := s.directTypesInIndex(superseded, "concepts")
+		started <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&aggregations) == 1 }, time.Second, time.Millisecond)
+
+	waiting := make(chan error)
+	go func() {
+		types, err := s.directTypesInIndex(context.Background(), "concepts")
+		assert.True(t, types["http://www.ft.com/ontology/company/PrivateCompany"])
+		waiting <- err
+	}()
+	cancel()
+	assert.Equal(t, context.Canceled, <-started)
+
+	close(release)
+	assert.NoError(t, <-waiting, "the aggregation is not cancelled with the request which started it")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&aggregations))
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	AuthNone   = "none"
+	AuthBasic  = "basic"
+	AuthAPIKey = "apikey"
+	AuthMTLS   = "mtls"
+)
+
+// Secret is read from its file if it has one, e.g. mounted from a secret store, or else taken as it is
+type Secret struct {
+	Value string
+	File  string
+}
+
+func (s Secret) read() (string, error) {
+	if s.File == "" {
+		return s.Value, nil
+	}
+	b, err := os.ReadFile(s.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ESAuth authenticates the requests to a self-managed cluster. Its secrets and certificates are read whenever a client
+// is built, so that rotated ones are picked up once the client is rebuilt.
+type ESAuth struct {
+	Mode       string // none, basic, apikey or mtls
+	Username   string
+	Password   Secret
+	APIKey     Secret // encoded, as returned by the create API key API
+	ClientCert string // PEM file of the client certificate of mtls
+	ClientKey  string // PEM file of the private key of the client certificate
+	CABundle   string // PEM file of the CAs trusted instead of the system ones to sign the certificates of the cluster
+}
+
+// Validate checks the auth has everything it needs, reading its secrets and certificates
+func (a ESAuth) Validate() error {
+	_, err := a.transport(&http.Transport{})
+	return err
+}
+
+// transport sets the TLS configuration of the next transport, and returns the transport authenticating the requests
+// before sending them with it
+func (a ESAuth) transport(next *http.Transport) (http.RoundTripper, error) {
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		next.TLSClientConfig = tlsConfig
+	}
+
+	switch a.Mode {
+	case "", AuthNone, AuthMTLS:
+		return next, nil
+	case AuthBasic:
+		password, err := a.Password.read()
+		if err != nil {
+			return nil, err
+		}
+		if a.Username == "" || password == "" {
+			return nil, errors.New("basic auth needs a username and a password")
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + password))
+		return authorizingTransport{authorization: "Basic " + credentials, next: next}, nil
+	case AuthAPIKey:
+		key, err := a.APIKey.read()
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, errors.New("apikey auth needs an API key")
+		}
+		return authorizingTransport{authorization: "ApiKey " + key, next: next}, nil
+	default:
+		return nil, fmt.Errorf("unknown ES auth %q", a.Mode)
+	}
+}
+
+func (a ESAuth) tlsConfig() (*tls.Config, error) {
+	if a.Mode != AuthMTLS && a.CABundle == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if a.CABundle != "" {
+		bundle, err := os.ReadFile(a.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", a.CABundle)
+		}
+	}
+	if a.Mode == AuthMTLS {
+		if a.ClientCert == "" || a.ClientKey == "" {
+			return nil, errors.New("mtls auth needs a client certificate and its key")
+		}
+		cert, err := tls.LoadX509KeyPair(a.ClientCert, a.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// authorizingTransport sets the Authorization header of the requests before sending them with the next transport
+type authorizingTransport struct {
+	authorization string
+	next          http.RoundTripper
+}
+
+// RoundTrip implementation
+func (a authorizingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip should not modify the request
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", a.authorization)
+	return a.next.RoundTrip(authorized)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorizationStub is an ES stub answering 401 to the requests without the expected Authorization header
+func authorizationStub(t *testing.T, authorization string) string {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"cluster_name":"self-managed","status":"green"}`)
+	}))
+	t.Cleanup(es.Close)
+	return es.URL
+}
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+// writeClientCert writes a self-signed client certificate and its key, returning their files and the certificate
+func writeClientCert(t *testing.T) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "concept-search-api"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := writeFile(t, "client.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeFile(t, "client.key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile, cert
+}
+
+// newTLSStub returns an ES stub served over TLS, requiring a client certificate signed by the client CA if any, and
+// the file of the CA bundle trusting its certificate
+func newTLSStub(t *testing.T, clientCA *x509.Certificate) (string, string) {
+	es := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"cluster_name":"self-managed","status":"green"}`)
+	}))
+	if clientCA != nil {
+		es.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+		es.TLS.ClientCAs.AddCert(clientCA)
+	}
+	es.StartTLS()
+	t.Cleanup(es.Close)
+	caBundle := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: es.Certificate().Raw}))
+	return es.URL, caBundle
+}
+
+func clusterName(endpoint string, auth ESAuth) (string, error) {
+	ec, err := NewSimpleClient(endpoint, DefaultHTTPConfig(), auth, false)
+	if err != nil {
+		return "", err
+	}
+	health, err := ec.ClusterHealth().Do(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return health.ClusterName, nil
+}
+
+// get sends a request with the transport of the auth, without the retries of the startup health check of the client
+func get(t *testing.T, url string, auth ESAuth) error {
+	transport, err := auth.transport(DefaultHTTPConfig().transport())
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestBasicAuth(t *testing.T) {
+	url := authorizationStub(t, "Basic dXNlcjpwYXNzd29yZA==")
+
+	name, err := clusterName(url, ESAuth{Mode: AuthBasic, Username: "user", Password: Secret{Value: "password"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "self-managed", name)
+}
+
+func TestBasicAuthPasswordFromFile(t *testing.T) {
+	url := authorizationStub(t, "Basic dXNlcjpwYXNzd29yZA==")
+	passwordFile := writeFile(t, "password", []byte("password\n"))
+
+	name, err := clusterName(url, ESAuth{Mode: AuthBasic, Username: "user", Password: Secret{Value: "ignored", File: passwordFile}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "self-managed", name)
+}
+
+func TestBasicAuthWithoutPassword(t *testing.T) {
+	_, err := clusterName("http://localhost:9200", ESAuth{Mode: AuthBasic, Username: "user"})
+
+	assert.EqualError(t, err, "basic auth needs a username and a password")
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	url := authorizationStub(t, "ApiKey a2V5LWlkOmtleQ==")
+	keyFile := writeFile(t, "api-key", []byte("a2V5LWlkOmtleQ=="))
+
+	name, err := clusterName(url, ESAuth{Mode: AuthAPIKey, APIKey: Secret{File: keyFile}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "self-managed", name)
+}
+
+func TestAPIKeyAuthWithMissingFile(t *testing.T) {
+	_, err := clusterName("http://localhost:9200", ESAuth{Mode: AuthAPIKey, APIKey: Secret{File: filepath.Join(t.TempDir(), "missing")}})
+
+	assert.Error(t, err)
+}
+
+func TestUnknownAuth(t *testing.T) {
+	_, err := clusterName("http://localhost:9200", ESAuth{Mode: "kerberos"})
+
+	assert.EqualError(t, err, `unknown ES auth "kerberos"`)
+}
+
+func TestCABundle(t *testing.T) {
+	url, caBundle := newTLSStub(t, nil)
+
+	err := get(t, url, ESAuth{Mode: AuthNone})
+	assert.Error(t, err, "the certificate of the stub is not signed by a system CA")
+
+	name, err := clusterName(url, ESAuth{Mode: AuthNone, CABundle: caBundle})
+	require.NoError(t, err)
+	assert.Equal(t, "self-managed", name)
+}
+
+func TestCABundleWithoutCertificates(t *testing.T) {
+	caBundle := writeFile(t, "ca.pem", []byte("not a certificate"))
+
+	_, err := clusterName("https://localhost:9200", ESAuth{Mode: AuthNone, CABundle: caBundle})
+
+	assert.EqualError(t, err, "no certificate found in CA bundle "+caBundle)
+}
+
+func TestMTLSAuth(t *testing.T) {
+	certFile, keyFile, cert := writeClientCert(t)
+	url, caBundle := newTLSStub(t, cert)
+
+	err := get(t, url, ESAuth{Mode: AuthNone, CABundle: caBundle})
+	assert.Error(t, err, "the client certificate is required")
+
+	name, err := clusterName(url, ESAuth{Mode: AuthMTLS, ClientCert: certFile, ClientKey: keyFile, CABundle: caBundle})
+	require.NoError(t, err)
+	assert.Equal(t, "self-managed", name)
+}
+
+func TestMTLSAuthWithoutClientCert(t *testing.T) {
+	_, err := clusterName("https://localhost:9200", ESAuth{Mode: AuthMTLS})
+
+	assert.EqualError(t, err, "mtls auth needs a client certificate and its key")
+}
+
+func TestClustersAreAuthenticated(t *testing.T) {
+	url := authorizationStub(t, "ApiKey a2V5LWlkOmtleQ==")
+	endpoints, err := ParseEndpoints([]string{url}, "https")
+	require.NoError(t, err)
+
+	clusters, err := NewClusters(endpoints, DefaultHTTPConfig(), ESAuth{Mode: AuthAPIKey, APIKey: Secret{Value: "a2V5LWlkOmtleQ=="}}, time.Second)
+
+	require.NoError(t, err)
+	assert.True(t, clusters.CheckCluster(context.Background(), 0).Healthy)
+}
+
+func TestValidateAuth(t *testing.T) {
+	assert.NoError(t, ESAuth{Mode: AuthBasic, Username: "user", Password: Secret{Value: "password"}}.Validate())
+	assert.EqualError(t, ESAuth{Mode: AuthBasic, Password: Secret{Value: "password"}}.Validate(), "basic auth needs a username and a password")
+	assert.Error(t, ESAuth{Mode: AuthAPIKey, APIKey: Secret{File: filepath.Join(t.TempDir(), "missing")}}.Validate())
+	assert.Error(t, ESAuth{Mode: AuthMTLS, ClientCert: "missing.crt", ClientKey: "missing.key"}.Validate())
+}
+
+func TestClustersPickUpRotatedSecrets(t *testing.T) {
+	url := authorizationStub(t, "ApiKey cm90YXRlZA==")
+	keyFile := writeFile(t, "api-key", []byte("b2xk"))
+	endpoints, err := ParseEndpoints([]string{url}, "https")
+	require.NoError(t, err)
+	clusters, err := NewClusters(endpoints, DefaultHTTPConfig(), ESAuth{Mode: AuthAPIKey, APIKey: Secret{File: keyFile}}, time.Second)
+	require.NoError(t, err)
+	assert.False(t, clusters.CheckCluster(context.Background(), 0).Healthy)
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("cm90YXRlZA=="), 0600))
+	clusters.refresh()
+
+	assert.True(t, clusters.CheckCluster(context.Background(), 0).Healthy)
+}
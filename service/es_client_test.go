@@ -28,7 +28,7 @@ func TestHappyAWSClientSetup(t *testing.T) {
 	esInternalServices := newESServiceMock(3)
 	es := newHappyAWSESMock(t)
 	defer es.Close()
-	go AWSClientSetup(credentials.NewStaticCredentials("test", "test", ""), es.URL, "", false, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
+	go AWSClientSetup(credentials.NewStaticCredentials("test", "test", ""), es.URL, "", DefaultHTTPConfig(), false, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
 	time.Sleep(1000 * time.Millisecond)
 	for _, s := range esInternalServices {
 		s.AssertExpectations(t)
@@ -42,14 +42,16 @@ func TestUnhappyAWSClientSetup(t *testing.T) {
 	esInternalServices := newESServiceMock(3)
 	es := newUnhappyAWSESMockForNAttempts(t, 10)
 	defer es.Close()
-	go AWSClientSetup(credentials.NewStaticCredentials("test", "test", ""), es.URL, "", true, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
-	for i := 0; i < 12; i++ { // NB elastic.Client retries by default 5 times every second by itself.
+	go AWSClientSetup(credentials.NewStaticCredentials("test", "test", ""), es.URL, "", DefaultHTTPConfig(), true, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
+	// NB elastic.Client retries by default 5 times every second by itself, so the 10 failures take two attempts,
+	// followed by retries after a backoff of 1s then 2s, each with a jitter of up to half of it
+	for i := 0; i < 13; i++ {
 		for _, s := range esInternalServices {
 			s.AssertNotCalled(t, "SetElasticClient", mock.AnythingOfType("*elastic.Client"))
 		}
 		time.Sleep(time.Second)
 	}
-	time.Sleep(100 * time.Millisecond)
+	time.Sleep(2 * time.Second)
 	for _, s := range esInternalServices {
 		s.AssertExpectations(t)
 	}
@@ -59,7 +61,7 @@ func TestHappySimpleClientSetup(t *testing.T) {
 	esInternalServices := newESServiceMock(3)
 	es := newHappySimpleESMock(t)
 	defer es.Close()
-	go SimpleClientSetup(es.URL, true, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
+	go SimpleClientSetup(es.URL, DefaultHTTPConfig(), ESAuth{}, true, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
 	time.Sleep(100 * time.Millisecond)
 	for _, s := range esInternalServices {
 		s.AssertExpectations(t)
@@ -73,14 +75,16 @@ func TestUnhappySimpleClientSetup(t *testing.T) {
 	esInternalServices := newESServiceMock(3)
 	es := newUnhappySimpleESMockForNAttempts(t, 10)
 	defer es.Close()
-	go SimpleClientSetup(es.URL, false, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
-	for i := 0; i < 12; i++ { // NB elastic.Client retries by default 5 times every second by itself.
+	go SimpleClientSetup(es.URL, DefaultHTTPConfig(), ESAuth{}, false, time.Second, esInternalServices[0], esInternalServices[1], esInternalServices[2])
+	// NB elastic.Client retries by default 5 times every second by itself, so the 10 failures take two attempts,
+	// followed by retries after a backoff of 1s then 2s, each with a jitter of up to half of it
+	for i := 0; i < 13; i++ {
 		for _, s := range esInternalServices {
 			s.AssertNotCalled(t, "SetElasticClient", mock.AnythingOfType("*elastic.Client"))
 		}
 		time.Sleep(time.Second)
 	}
-	time.Sleep(100 * time.Millisecond)
+	time.Sleep(2 * time.Second)
 	for _, s := range esInternalServices {
 		s.AssertExpectations(t)
 	}
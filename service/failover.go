@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const clusterCheckTimeout = 10 * time.Second
+
+// Endpoint is the endpoint of an ES cluster, the lower its priority the more it is preferred
+type Endpoint struct {
+	URL      *url.URL
+	Priority int
+	// Region is the AWS region of the cluster, the default region is used if empty
+	Region string
+}
+
+// ParseEndpoints parses endpoints given as URLs optionally followed by ;priority=N and ;region=R, e.g.
+// https://dr.example.com;priority=2;region=eu-central-1. Endpoints without a priority are prioritised in their order,
+// and URLs without a scheme get the default scheme.
+func ParseEndpoints(specs []string, defaultScheme string) ([]Endpoint, error) {
+	endpoints := make([]Endpoint, 0, len(specs))
+	for i, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), ";")
+		rawURL := parts[0]
+		if !strings.Contains(rawURL, "://") {
+			rawURL = defaultScheme + "://" + rawURL
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %v", spec)
+		}
+		endpoint := Endpoint{URL: u, Priority: i}
+		for _, option := range parts[1:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid option %v of endpoint %v", option, spec)
+			}
+			switch strings.TrimSpace(kv[0]) {
+			case "priority":
+				priority, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid priority of endpoint %v", spec)
+				}
+				endpoint.Priority = priority
+			case "region":
+				endpoint.Region = strings.TrimSpace(kv[1])
+			default:
+				return nil, fmt.Errorf("unknown option %v of endpoint %v", kv[0], spec)
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoint")
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool { return endpoints[i].Priority < endpoints[j].Priority })
+	return endpoints, nil
+}
+
+// ClusterState is the last known state of a cluster
+type ClusterState struct {
+	Endpoint string `json:"endpoint"`
+	Priority int    `json:"priority"`
+	Healthy  bool   `json:"healthy"`
+	// Active tells whether the reads are currently sent to the cluster
+	Active  bool      `json:"active"`
+	Status  string    `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked,omitempty"`
+}
+
+type cluster struct {
+	endpoint  Endpoint
+	transport http.RoundTripper
+	lock      *sync.RWMutex
+	healthy   bool
+	status    string
+	lastErr   error
+	checked   time.Time
+}
+
+func (c *cluster) roundTripper() http.RoundTripper {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.transport
+}
+
+func (c *cluster) isHealthy() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.healthy
+}
+
+func (c *cluster) markFailed(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.healthy {
+		log.WithError(err).WithField("endpoint", c.endpoint.URL.Host).Warn("the elasticsearch cluster failed, failing over its reads")
+	}
+	c.healthy = false
+	c.lastErr = err
+}
+
+func (c *cluster) markChecked(status string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	healthy := err == nil
+	if healthy && !c.healthy {
+		log.WithField("endpoint", c.endpoint.URL.Host).Info("the elasticsearch cluster is healthy, failing back its reads")
+	}
+	c.healthy = healthy
+	c.status = status
+	c.lastErr = err
+	c.checked = time.Now()
+}
+
+// Clusters sends the requests of the elastic client to the healthy cluster with the highest priority, failing over to the
+// next cluster when one errors or does not answer within the attempt timeout. A failed cluster gets requests again,
+// i.e. fails back, once a check finds it healthy.
+type Clusters struct {
+	clusters       []*cluster
+	attemptTimeout time.Duration
+	httpConfig     HTTPConfig
+	refresh        func() // called before the client is rebuilt
+}
+
+// NewClusters builds the clusters of the endpoints, sending the requests to them with a transport of the HTTP config
+// authenticating them with the auth. The transports are built again before the client is rebuilt, so that rotated
+// secrets and certificates are picked up.
+func NewClusters(endpoints []Endpoint, httpConfig HTTPConfig, auth ESAuth, attemptTimeout time.Duration) (*Clusters, error) {
+	var err error
+	clusters := newClusters(endpoints, httpConfig, attemptTimeout, func(Endpoint) http.RoundTripper {
+		transport, authErr := auth.transport(httpConfig.transport())
+		if authErr != nil {
+			err = authErr
+		}
+		return transport
+	})
+	if err != nil {
+		return nil, err
+	}
+	clusters.refresh = func() {
+		for _, cl := range clusters.clusters {
+			transport, err := auth.transport(httpConfig.transport())
+			if err != nil {
+				log.WithError(err).WithField("endpoint", cl.endpoint.URL.Host).Error("could not rebuild the authenticated transport, keeping the previous one")
+				continue
+			}
+			cl.lock.Lock()
+			cl.transport = transport
+			cl.lock.Unlock()
+		}
+	}
+	return clusters, nil
+}
+
+// NewAWSClusters builds the clusters of the endpoints, signing the requests to them with the AWS credentials
+func NewAWSClusters(endpoints []Endpoint, awsCreds *credentials.Credentials, region string, httpConfig HTTPConfig, attemptTimeout time.Duration) *Clusters {
+	clusters := newClusters(endpoints, httpConfig, attemptTimeout, func(endpoint Endpoint) http.RoundTripper {
+		r := region
+		if endpoint.Region != "" {
+			r = endpoint.Region
+		}
+		return newAWSSigningTransport(awsCreds, r, httpConfig.transport())
+	})
+	clusters.refresh = awsCreds.Expire
+	return clusters
+}
+
+func newClusters(endpoints []Endpoint, httpConfig HTTPConfig, attemptTimeout time.Duration, transportFor func(Endpoint) http.RoundTripper) *Clusters {
+	clusters := &Clusters{attemptTimeout: attemptTimeout, httpConfig: httpConfig, refresh: func() {}}
+	for _, endpoint := range endpoints {
+		clusters.clusters = append(clusters.clusters, &cluster{
+			endpoint:  endpoint,
+			transport: transportFor(endpoint),
+			lock:      &sync.RWMutex{},
+			healthy:   true,
+		})
+	}
+	return clusters
+}
+
+// URL is the URL the elastic client is given, the one of the cluster with the highest priority
+func (c *Clusters) URL() string {
+	return c.clusters[0].endpoint.URL.String()
+}
+
+// RoundTrip sends the request to the clusters in order of preference, until one of them answers
+func (c *Clusters) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body with error: %w", err)
+		}
+		body = b
+	}
+
+	candidates := c.candidates()
+	var resp *http.Response
+	var err error
+	for i, cl := range candidates {
+		last := i == len(candidates)-1
+		resp, err = c.attempt(req, body, cl, !last)
+		if err == nil && !isClusterFailure(resp.StatusCode) {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			// the caller gave up, which tells nothing of the health of the cluster
+			break
+		}
+		if err != nil {
+			cl.markFailed(err)
+		} else {
+			cl.markFailed(fmt.Errorf("status %v", resp.StatusCode))
+		}
+		if last {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// candidates are the healthy clusters in order of priority, followed by the failed ones as a last resort
+func (c *Clusters) candidates() []*cluster {
+	candidates := make([]*cluster, 0, len(c.clusters))
+	var failed []*cluster
+	for _, cl := range c.clusters {
+		if cl.isHealthy() {
+			candidates = append(candidates, cl)
+		} else {
+			failed = append(failed, cl)
+		}
+	}
+	return append(candidates, failed...)
+}
+
+func (c *Clusters) attempt(req *http.Request, body []byte, cl *cluster, withTimeout bool) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if withTimeout && c.attemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.attemptTimeout)
+	}
+
+	attempt := req.Clone(ctx)
+	attempt.URL.Scheme = cl.endpoint.URL.Scheme
+	attempt.URL.Host = cl.endpoint.URL.Host
+	attempt.URL.Path = strings.TrimSuffix(cl.endpoint.URL.Path, "/") + strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(c.clusters[0].endpoint.URL.Path, "/"))
+	attempt.Host = cl.endpoint.URL.Host
+	if body != nil {
+		attempt.Body = io.NopCloser(bytes.NewReader(body))
+		attempt.ContentLength = int64(len(body))
+	}
+
+	resp, err := cl.roundTripper().RoundTrip(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the attempt context lives as long as the response body is read
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func isClusterFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// Check checks the health of every cluster, failing back to the clusters found healthy. It fails if no cluster is healthy.
+func (c *Clusters) Check(ctx context.Context) error {
+	states := make([]ClusterState, len(c.clusters))
+	wg := sync.WaitGroup{}
+	for i := range c.clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			states[i] = c.CheckCluster(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	var errs []string
+	for _, state := range states {
+		if !state.Healthy {
+			errs = append(errs, fmt.Sprintf("%v: %v", state.Endpoint, state.Error))
+		}
+	}
+	if len(errs) == len(c.clusters) {
+		return fmt.Errorf("no elasticsearch cluster is healthy: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// CheckCluster checks the health of the cluster at the index, in order of priority, and returns its state. A cluster
+// answering with a red status is not healthy, as some of its primary shards are missing.
+func (c *Clusters) CheckCluster(ctx context.Context, i int) ClusterState {
+	cl := c.clusters[i]
+	ctx, cancel := context.WithTimeout(ctx, clusterCheckTimeout)
+	defer cancel()
+
+	status, err := clusterStatus(ctx, cl)
+	if err == nil && status == "red" {
+		err = errors.New("cluster is red")
+	}
+	cl.markChecked(status, err)
+	return c.States()[i]
+}
+
+func clusterStatus(ctx context.Context, cl *cluster) (string, error) {
+	u := *cl.endpoint.URL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/_cluster/health"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := cl.roundTripper().RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cluster health returned status %v", resp.StatusCode)
+	}
+	var health elastic.ClusterHealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "", err
+	}
+	return health.Status, nil
+}
+
+// States returns the last known state of every cluster, in order of priority
+func (c *Clusters) States() []ClusterState {
+	states := make([]ClusterState, 0, len(c.clusters))
+	active := c.candidates()[0]
+	for _, cl := range c.clusters {
+		cl.lock.RLock()
+		state := ClusterState{
+			Endpoint: cl.endpoint.URL.Host,
+			Priority: cl.endpoint.Priority,
+			Healthy:  cl.healthy,
+			Active:   cl == active,
+			Status:   cl.status,
+			Checked:  cl.checked,
+		}
+		if cl.lastErr != nil {
+			state.Error = cl.lastErr.Error()
+		}
+		cl.lock.RUnlock()
+		states = append(states, state)
+	}
+	return states
+}
+
+// NewFailoverClient connects to the clusters with failover between them
+func NewFailoverClient(clusters *Clusters, traceLogging bool) (*elastic.Client, error) {
+	log.Infof("connecting with failover to %d clusters, %s first", len(clusters.clusters), clusters.URL())
+	return newClient(clusters.URL(), clusters.httpConfig, clusters, traceLogging)
+}
+
+// NewFailoverClientSupervisor supervises a client which fails over between the clusters, checking the health of
+// every cluster so that the reads fail back once a cluster is healthy again
+func NewFailoverClientSupervisor(clusters *Clusters, traceLogging bool, tryEvery time.Duration, services ...ESService) *ClientSupervisor {
+	supervisor := newClientSupervisor(func() (*elastic.Client, error) {
+		return NewFailoverClient(clusters, traceLogging)
+	}, tryEvery, services)
+	supervisor.beforeRetry = clusters.refresh
+	supervisor.checkCluster = func(ctx context.Context, _ *elastic.Client) error {
+		return clusters.Check(ctx)
+	}
+	return supervisor
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterStub is an ES cluster which can be made to fail, or to answer slowly, recording the requests it answers
+type clusterStub struct {
+	sync.Mutex
+	name     string
+	failing  bool
+	delay    time.Duration
+	requests []string
+	bodies   []string
+}
+
+func (c *clusterStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	failing, delay := c.failing, c.delay
+	body, _ := io.ReadAll(r.Body)
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	c.bodies = append(c.bodies, string(body))
+	c.Unlock()
+
+	time.Sleep(delay)
+	if failing {
+		http.Error(w, "cluster unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/_cluster/health" {
+		fmt.Fprint(w, `{"cluster_name":"`+c.name+`","status":"green"}`)
+		return
+	}
+	fmt.Fprint(w, `{"cluster":"`+c.name+`","hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`)
+}
+
+func (c *clusterStub) set(failing bool, delay time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.failing = failing
+	c.delay = delay
+}
+
+func (c *clusterStub) received() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+func newTestClusters(t *testing.T, attemptTimeout time.Duration) (*Clusters, *clusterStub, *clusterStub) {
+	primary := &clusterStub{name: "primary"}
+	secondary := &clusterStub{name: "secondary"}
+	primaryES := httptest.NewServer(primary)
+	t.Cleanup(primaryES.Close)
+	secondaryES := httptest.NewServer(secondary)
+	t.Cleanup(secondaryES.Close)
+
+	endpoints, err := ParseEndpoints([]string{secondaryES.URL + ";priority=2", primaryES.URL + ";priority=1"}, "http")
+	require.NoError(t, err)
+	clusters, err := NewClusters(endpoints, DefaultHTTPConfig(), ESAuth{}, attemptTimeout)
+	require.NoError(t, err)
+	return clusters, primary, secondary
+}
+
+func search(t *testing.T, clusters *Clusters, body string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, clusters.URL()+"/concepts/_search", strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: clusters}).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints([]string{"dr.example.com;priority=2;region=eu-central-1", "https://primary.example.com", "http://local:9200;priority=1"}, "https")
+
+	require.NoError(t, err)
+	require.Len(t, endpoints, 3)
+	assert.Equal(t, "https://primary.example.com", endpoints[0].URL.String())
+	assert.Equal(t, 1, endpoints[0].Priority, "priority of its position")
+	assert.Equal(t, "http://local:9200", endpoints[1].URL.String())
+	assert.Equal(t, "https://dr.example.com", endpoints[2].URL.String())
+	assert.Equal(t, "eu-central-1", endpoints[2].Region)
+}
+
+func TestParseInvalidEndpoints(t *testing.T) {
+	testCases := map[string][]string{
+		"no endpoint":      {},
+		"no host":          {"http://"},
+		"invalid priority": {"http://primary;priority=first"},
+		"unknown option":   {"http://primary;weight=2"},
+		"invalid option":   {"http://primary;priority"},
+	}
+
+	for name, specs := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseEndpoints(specs, "http")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReadsFromPrimary(t *testing.T) {
+	clusters, primary, secondary := newTestClusters(t, time.Second)
+
+	status, body := search(t, clusters, `{"query":{}}`)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"cluster":"primary"`)
+	assert.Len(t, primary.received(), 1)
+	assert.Empty(t, secondary.received())
+}
+
+func TestFailOverAndBack(t *testing.T) {
+	clusters, primary, secondary := newTestClusters(t, time.Second)
+	primary.set(true, 0)
+
+	status, body := search(t, clusters, `{"query":{"match_all":{}}}`)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"cluster":"secondary"`)
+	assert.Equal(t, []string{`{"query":{"match_all":{}}}`}, secondary.bodies, "the request body is sent again")
+	states := clusters.States()
+	assert.False(t, states[0].Healthy)
+	assert.True(t, states[1].Active)
+
+	_, body = search(t, clusters, `{}`)
+	assert.Contains(t, body, `"cluster":"secondary"`)
+	assert.Len(t, primary.received(), 1, "the failed primary is not tried again")
+
+	assert.NoError(t, clusters.Check(context.Background()), "the secondary is healthy")
+	assert.False(t, clusters.States()[0].Healthy)
+
+	primary.set(false, 0)
+	assert.NoError(t, clusters.Check(context.Background()))
+	states = clusters.States()
+	assert.True(t, states[0].Healthy)
+	assert.True(t, states[0].Active, "the reads fail back to the primary")
+	assert.Equal(t, "green", states[0].Status)
+
+	_, body = search(t, clusters, `{}`)
+	assert.Contains(t, body, `"cluster":"primary"`)
+}
+
+func TestFailOverOnTimeout(t *testing.T) {
+	clusters, primary, _ := newTestClusters(t, 50*time.Millisecond)
+	primary.set(false, 500*time.Millisecond)
+
+	status, body := search(t, clusters, `{}`)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"cluster":"secondary"`)
+	assert.Contains(t, clusters.States()[0].Error, "deadline exceeded")
+}
+
+func TestAllClustersFailing(t *testing.T) {
+	clusters, primary, secondary := newTestClusters(t, time.Second)
+	primary.set(true, 0)
+	secondary.set(true, 0)
+
+	status, _ := search(t, clusters, `{}`)
+
+	assert.Equal(t, http.StatusServiceUnavailable, status, "the last failure is returned")
+	assert.Error(t, clusters.Check(context.Background()))
+	for _, state := range clusters.States() {
+		assert.False(t, state.Healthy)
+	}
+}
+
+func TestFailoverClient(t *testing.T) {
+	clusters, primary, _ := newTestClusters(t, time.Second)
+	ec, err := NewFailoverClient(clusters, false)
+	require.NoError(t, err)
+	primary.set(true, 0)
+
+	s := NewEsConceptSearchService("concepts", "all-concepts", 50, 10, 10)
+	s.SetElasticClient(ec)
+	concepts, err := s.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/Genre", false, false, false, nil)
+
+	assert.NoError(t, err, "the search is failed over to the secondary")
+	assert.Empty(t, concepts)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	hedgeLatencyWindow = 1000 // recent search latencies the hedge delay is taken from
+	minHedgeSamples    = 50   // latencies needed before any search is hedged
+	hedgeDelayRefresh  = 100  // latencies recorded before the hedge delay is computed again
+	hedgeBudgetWindow  = 1000 // searches after which the hedged share is halved, so that it reflects the recent searches
+)
+
+// Hedger sends a search again when it has not returned within a percentile of the recent search latencies, taking the
+// first response, so that the occasional slow shard does not set the tail latency. At most a budgeted share of the
+// searches is hedged, so that a slow cluster is not overloaded by the duplicates. A nil hedger does not hedge.
+type Hedger struct {
+	lock       *sync.Mutex
+	percentile float64 // of the recent latencies after which a search is hedged, between 0 and 1
+	budget     float64 // maximum share of the searches which are hedged, between 0 and 1
+	latencies  []time.Duration
+	next       int // where the next latency goes in the window
+	delay      time.Duration
+	sinceDelay int // latencies recorded since the delay was computed
+	searches   float64
+	hedged     float64
+}
+
+func NewHedger(percentile float64, budget float64) *Hedger {
+	return &Hedger{
+		lock:       &sync.Mutex{},
+		percentile: percentile,
+		budget:     budget,
+		latencies:  make([]time.Duration, 0, hedgeLatencyWindow),
+	}
+}
+
+type searchResponse struct {
+	result *elastic.SearchResult
+	err    error
+}
+
+// Search runs the search, and once more if it has not returned after the hedge delay, returning the first successful
+// response. The search still in flight is then cancelled.
+func (h *Hedger) Search(ctx context.Context, search func(ctx context.Context) (*elastic.SearchResult, error)) (*elastic.SearchResult, error) {
+	if h == nil {
+		return search(ctx)
+	}
+
+	start := time.Now()
+	delay, hedge := h.startSearch()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make(chan searchResponse, 2)
+	run := func() {
+		result, err := search(ctx)
+		responses <- searchResponse{result: result, err: err}
+	}
+	go run()
+	inFlight := 1
+
+	var hedgeAfter <-chan time.Time
+	if hedge {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedgeAfter = timer.C
+	}
+
+	var firstErr error
+	for {
+		select {
+		case <-hedgeAfter:
+			hedgeAfter = nil
+			if h.spendBudget() {
+				go run()
+				inFlight++
+			}
+		case response := <-responses:
+			inFlight--
+			if response.err == nil {
+				h.record(time.Since(start))
+				return response.result, nil
+			}
+			if firstErr == nil {
+				firstErr = response.err
+			}
+			if inFlight == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// startSearch counts the search against the budget and returns the delay after which it is hedged, if it is
+func (h *Hedger) startSearch() (time.Duration, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.searches++
+	if h.searches >= hedgeBudgetWindow {
+		h.searches /= 2
+		h.hedged /= 2
+	}
+	return h.delay, len(h.latencies) >= minHedgeSamples && h.budget > 0
+}
+
+// spendBudget tells whether one more search can be hedged without exceeding the budget
+func (h *Hedger) spendBudget() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.hedged+1 > h.budget*h.searches {
+		return false
+	}
+	h.hedged++
+	return true
+}
+
+func (h *Hedger) record(latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.latencies) < hedgeLatencyWindow {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+	}
+	h.next = (h.next + 1) % hedgeLatencyWindow
+	h.sinceDelay++
+	if len(h.latencies) <= minHedgeSamples || h.sinceDelay >= hedgeDelayRefresh {
+		h.delay = percentileOf(h.latencies, h.percentile)
+		h.sinceDelay = 0
+	}
+}
+
+func percentileOf(latencies []time.Duration, percentile float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(percentile*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
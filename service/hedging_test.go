@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// warmHedger returns a hedger which has seen enough searches to hedge after the given delay
+func warmHedger(percentile float64, budget float64, delay time.Duration) *Hedger {
+	h := NewHedger(percentile, budget)
+	for i := 0; i < minHedgeSamples; i++ {
+		h.startSearch()
+		h.record(delay)
+	}
+	return h
+}
+
+// slowFirstSearch answers the first attempt after the given delay and the next ones at once, counting the attempts
+func slowFirstSearch(slow time.Duration, attempts *int32) func(ctx context.Context) (*elastic.SearchResult, error) {
+	return func(ctx context.Context) (*elastic.SearchResult, error) {
+		attempt := atomic.AddInt32(attempts, 1)
+		if attempt == 1 {
+			select {
+			case <-time.After(slow):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return &elastic.SearchResult{TookInMillis: int64(attempt)}, nil
+	}
+}
+
+func TestPercentileOf(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentileOf(latencies, 0.5))
+	assert.Equal(t, 95*time.Millisecond, percentileOf(latencies, 0.95))
+	assert.Equal(t, 100*time.Millisecond, percentileOf(latencies, 1))
+	assert.Equal(t, time.Millisecond, percentileOf(latencies, 0))
+	assert.Equal(t, time.Duration(0), percentileOf(nil, 0.95))
+}
+
+func TestHedgedSearchTakesTheFirstResponse(t *testing.T) {
+	h := warmHedger(0.95, 1, 10*time.Millisecond)
+	var attempts int32
+
+	start := time.Now()
+	result, err := h.Search(context.Background(), slowFirstSearch(time.Second, &attempts))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.TookInMillis, "the response of the hedged search")
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestSearchReturningWithinTheDelayIsNotHedged(t *testing.T) {
+	h := warmHedger(0.95, 1, 200*time.Millisecond)
+	var attempts int32
+
+	result, err := h.Search(context.Background(), slowFirstSearch(10*time.Millisecond, &attempts))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.TookInMillis)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestNoHedgingBeforeEnoughSamples(t *testing.T) {
+	h := NewHedger(0.95, 1)
+	h.record(time.Millisecond)
+	var attempts int32
+
+	result, err := h.Search(context.Background(), slowFirstSearch(50*time.Millisecond, &attempts))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.TookInMillis)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestHedgingBudget(t *testing.T) {
+	h := warmHedger(0.5, 0.1, time.Millisecond)
+	hedged := 0
+	for i := 0; i < 40; i++ {
+		var attempts int32
+		_, err := h.Search(context.Background(), slowFirstSearch(20*time.Millisecond, &attempts))
+		require.NoError(t, err)
+		if atomic.LoadInt32(&attempts) > 1 {
+			hedged++
+		}
+	}
+
+	assert.LessOrEqual(t, float64(hedged), 0.1*float64(minHedgeSamples+40), "the hedged searches are within the budget")
+	assert.Greater(t, hedged, 0)
+}
+
+func TestHedgedSearchFailingTwice(t *testing.T) {
+	h := warmHedger(0.95, 1, time.Millisecond)
+	var attempts int32
+
+	_, err := h.Search(context.Background(), func(ctx context.Context) (*elastic.SearchResult, error) {
+		attempt := atomic.AddInt32(&attempts, 1)
+		if attempt == 1 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil, fmt.Errorf("attempt %d failed", attempt)
+	})
+
+	assert.EqualError(t, err, "attempt 2 failed", "the first error")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestFailedSearchWaitsForTheHedgedSearch(t *testing.T) {
+	h := warmHedger(0.95, 1, time.Millisecond)
+	var attempts int32
+
+	result, err := h.Search(context.Background(), func(ctx context.Context) (*elastic.SearchResult, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			return nil, errors.New("shard failure")
+		}
+		time.Sleep(50 * time.Millisecond)
+		return &elastic.SearchResult{}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+}
+
+func TestNilHedgerDoesNotHedge(t *testing.T) {
+	var h *Hedger
+	var attempts int32
+
+	_, err := h.Search(context.Background(), slowFirstSearch(20*time.Millisecond, &attempts))
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestSearchModeIsHedged(t *testing.T) {
+	var searches int32
+	s := newStubbedService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		if atomic.AddInt32(&searches, 1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`)
+	}), func(s *esConceptSearchService) { s.SetHedger(warmHedger(0.95, 1, 20*time.Millisecond)) })
+
+	start := time.Now()
+	_, err := s.SearchConceptByTextAndTypes(context.Background(), "fast", []string{"http://www.ft.com/ontology/person/Person"}, false, false, false, nil)
+
+	assert.NoError(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "the slow search is hedged")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&searches))
+}
+
+func TestTextModeIsNotHedged(t *testing.T) {
+	var searches int32
+	var searchType atomic.Value
+	s := newStubbedService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		atomic.AddInt32(&searches, 1)
+		searchType.Store(r.URL.Query().Get("search_type"))
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`)
+	}), func(s *esConceptSearchService) { s.SetHedger(warmHedger(0.95, 1, 20*time.Millisecond)) })
+
+	_, err := s.SearchConceptByTextAndTypesInTextMode(context.Background(), "slow", []string{"http://www.ft.com/ontology/organisation/Organisation"}, false, false, false, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&searches))
+	assert.Equal(t, "dfs_query_then_fetch", searchType.Load())
+}
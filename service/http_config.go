@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	retryWait    = 100 * time.Millisecond // wait before the first retry of a failed request, doubling at every retry
+	maxRetryWait = 2 * time.Second
+)
+
+// HTTPConfig tunes the HTTP client of every ES client, and the transports of the clusters the reads fail over between
+type HTTPConfig struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration // of a whole request, including reading the response body
+	MaxIdleConnsPerHost   int
+	MaxRetries            int // of a request failing with a connection error
+}
+
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		DialTimeout:           5 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		Timeout:               60 * time.Second,
+		MaxIdleConnsPerHost:   30,
+	}
+}
+
+// transport returns a new transport with the timeouts and the pooling of the config
+func (c HTTPConfig) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	if transport.MaxIdleConns < c.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = c.MaxIdleConnsPerHost
+	}
+	return transport
+}
+
+func (c HTTPConfig) client(transport http.RoundTripper) *http.Client {
+	return &http.Client{Transport: transport, Timeout: c.Timeout}
+}
+
+// retrier retries the requests failing with a connection error up to MaxRetries times, with a jittered exponential
+// backoff
+func (c HTTPConfig) retrier() elastic.Retrier {
+	if c.MaxRetries <= 0 {
+		return elastic.NewStopRetrier()
+	}
+	return elastic.RetrierFunc(func(ctx context.Context, retry int, req *http.Request, resp *http.Response, err error) (time.Duration, bool, error) {
+		if retry > c.MaxRetries {
+			return 0, false, nil
+		}
+		return backoff(retryWait, maxRetryWait, retry-1), true, nil
+	})
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPConfigTransport(t *testing.T) {
+	config := HTTPConfig{
+		DialTimeout:           time.Second,
+		TLSHandshakeTimeout:   2 * time.Second,
+		ResponseHeaderTimeout: 3 * time.Second,
+		MaxIdleConnsPerHost:   200,
+	}
+
+	transport := config.transport()
+
+	assert.Equal(t, int64(2*time.Second), int64(transport.TLSHandshakeTimeout))
+	assert.Equal(t, int64(3*time.Second), int64(transport.ResponseHeaderTimeout))
+	assert.Equal(t, 200, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 200, transport.MaxIdleConns, "the idle connections of every host fit in the pool")
+	assert.NotSame(t, http.DefaultTransport, transport)
+}
+
+func TestHTTPConfigResponseHeaderTimeout(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer es.Close()
+	config := DefaultHTTPConfig()
+	config.ResponseHeaderTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := config.client(config.transport()).Get(es.URL)
+
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestHTTPConfigTimeoutIncludesTheResponseBody(t *testing.T) {
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer es.Close()
+	config := DefaultHTTPConfig()
+	config.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	resp, err := config.client(config.transport()).Get(es.URL)
+	if err == nil {
+		_, err = resp.Body.Read(make([]byte, 1))
+		resp.Body.Close()
+	}
+
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestClientRetriesConnectionErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var connections int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&connections, 1)
+			conn.Close()
+		}
+	}()
+	defer listener.Close()
+
+	config := DefaultHTTPConfig()
+	config.MaxRetries = 2
+	ec, err := newClient(fmt.Sprintf("http://%s", listener.Addr()), config, config.transport(), false, elastic.SetHealthcheck(false))
+	require.NoError(t, err)
+
+	_, err = ec.ClusterHealth().Do(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&connections), "the request and its 2 retries")
+}
+
+func TestClientDoesNotRetryByDefault(t *testing.T) {
+	var requests int32
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer es.Close()
+
+	config := DefaultHTTPConfig()
+	ec, err := newClient(es.URL, config, config.transport(), false, elastic.SetHealthcheck(false))
+	require.NoError(t, err)
+
+	_, err = ec.ClusterHealth().Do(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Financial-Times/concept-search-api/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// IndexTargets are the indices searched by the service, the extended one being used when searching all authorities
+type IndexTargets struct {
+	DefaultIndex        string `json:"defaultIndex"`
+	ExtendedSearchIndex string `json:"extendedSearchIndex"`
+}
+
+// IndexTargets returns the indices currently searched
+func (s *esConceptSearchService) IndexTargets() IndexTargets {
+	s.indicesLock.RLock()
+	defer s.indicesLock.RUnlock()
+	return s.indices
+}
+
+// SwitchIndices points the service at other indices, or aliases, once they are found to exist.
+// An empty index name keeps the current target, so that the indices can be switched one at a time.
+func (s *esConceptSearchService) SwitchIndices(ctx context.Context, targets IndexTargets) error {
+	if targets.DefaultIndex == "" && targets.ExtendedSearchIndex == "" {
+		return util.NewInputError(util.ErrCodeMissingParameter, "defaultIndex", "no index to switch to")
+	}
+	backend := s.searchBackend()
+	if backend == nil {
+		return util.ErrNoElasticClient
+	}
+
+	for _, target := range []struct{ param, index string }{
+		{"defaultIndex", targets.DefaultIndex},
+		{"extendedSearchIndex", targets.ExtendedSearchIndex},
+	} {
+		if target.index == "" {
+			continue
+		}
+		done, err := s.breaker.Allow()
+		if err != nil {
+			return err
+		}
+		exists, err := backend.IndexExists(ctx, target.index)
+		done(err)
+		if err != nil {
+			log.WithError(err).WithField("index", target.index).Error("failed to check whether the index exists")
+			return err
+		}
+		if !exists {
+			return util.NewInputErrorf(util.ErrCodeInvalidParameter, target.param, "index %v does not exist", target.index)
+		}
+	}
+
+	defer s.requestMappingRefresh()
+	s.indicesLock.Lock()
+	defer s.indicesLock.Unlock()
+	previous := s.indices
+	if targets.DefaultIndex != "" {
+		s.indices.DefaultIndex = targets.DefaultIndex
+	}
+	if targets.ExtendedSearchIndex != "" {
+		s.indices.ExtendedSearchIndex = targets.ExtendedSearchIndex
+	}
+	log.WithField("previous", previous).WithField("current", s.indices).Info("switched the searched indices")
+	return nil
+}
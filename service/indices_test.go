@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/concept-search-api/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// indicesESStub knows of a set of indices, answering the searches with no hits and recording the searched paths
+type indicesESStub struct {
+	indices  map[string]bool
+	searches []string
+}
+
+func (s *indicesESStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		if s.indices[strings.Trim(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	s.searches = append(s.searches, r.URL.Path)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`)
+}
+
+func newIndicesESStub() *indicesESStub {
+	return &indicesESStub{indices: map[string]bool{"concepts": true, "all-concepts": true, "concepts-v2": true, "all-concepts-v2": true}}
+}
+
+func TestSwitchIndices(t *testing.T) {
+	stub := newIndicesESStub()
+	s := newStubbedService(t, stub)
+
+	err := s.SwitchIndices(context.Background(), IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts-v2"})
+	require.NoError(t, err)
+	assert.Equal(t, IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts-v2"}, s.IndexTargets())
+
+	_, err = s.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/Genre", false, false, false, nil)
+	require.NoError(t, err)
+	_, err = s.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/Genre", true, false, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/concepts-v2/_search", "/all-concepts-v2/_search"}, stub.searches)
+}
+
+func TestSwitchOneIndexKeepsTheOther(t *testing.T) {
+	s := newStubbedService(t, newIndicesESStub())
+
+	err := s.SwitchIndices(context.Background(), IndexTargets{ExtendedSearchIndex: "all-concepts-v2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts-v2"}, s.IndexTargets())
+}
+
+func TestSwitchToMissingIndex(t *testing.T) {
+	s := newStubbedService(t, newIndicesESStub())
+
+	err := s.SwitchIndices(context.Background(), IndexTargets{DefaultIndex: "concepts-v2", ExtendedSearchIndex: "all-concepts-v3"})
+
+	require.Error(t, err)
+	inputErr, ok := err.(util.InputError)
+	require.True(t, ok, "input error")
+	assert.Equal(t, "extendedSearchIndex", inputErr.Parameter())
+	assert.Equal(t, IndexTargets{DefaultIndex: "concepts", ExtendedSearchIndex: "all-concepts"}, s.IndexTargets(), "no index is switched")
+}
+
+func TestSwitchIndicesWithoutIndex(t *testing.T) {
+	s := newStubbedService(t, newIndicesESStub())
+
+	err := s.SwitchIndices(context.Background(), IndexTargets{})
+
+	assert.IsType(t, util.InputError{}, err)
+}
+
+func TestSwitchIndicesWithoutElasticClient(t *testing.T) {
+	s := NewEsConceptSearchService("concepts", "all-concepts", 50, 10, 10)
+
+	err := s.SwitchIndices(context.Background(), IndexTargets{DefaultIndex: "concepts-v2"})
+
+	assert.Equal(t, util.ErrNoElasticClient, err)
+}
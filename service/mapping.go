@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const mappingCheckTimeout = 30 * time.Second
+
+var numericFieldTypes = []string{"long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float"}
+
+// queryFields are the fields the query builders depend on, with the ES types they can be mapped to
+var queryFields = map[string][]string{
+	"id":                               {"keyword"},
+	"type":                             {"keyword"},
+	"directType":                       {"keyword"},
+	"types":                            {"keyword"},
+	"isDeprecated":                     {"boolean"},
+	"isFTAuthor":                       {"boolean"},
+	"scopeNote":                        {"text", "keyword"},
+	"prefLabel":                        {"text"},
+	"prefLabel.raw":                    {"keyword"},
+	"prefLabel.edge_ngram":             {"text"},
+	"prefLabel.exact_match":            {"text"},
+	"aliases":                          {"text"},
+	"aliases.raw":                      {"keyword"},
+	"aliases.edge_ngram":               {"text"},
+	"aliases.exact_match":              {"text"},
+	"metrics.annotationsCount":         numericFieldTypes,
+	"metrics.prevWeekAnnotationsCount": numericFieldTypes,
+}
+
+// MappingStatus is the outcome of the last check of the mappings of the searched indices against the queryFields
+type MappingStatus struct {
+	Checked  time.Time      `json:"checked"`
+	Error    string         `json:"error,omitempty"`
+	Problems []FieldProblem `json:"problems,omitempty"`
+}
+
+// FieldProblem is a field the queries depend on which is missing from, or mistyped in, an index
+type FieldProblem struct {
+	Index   string `json:"index"`
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+func (p FieldProblem) String() string {
+	return fmt.Sprintf("%v in %v: %v", p.Field, p.Index, p.Problem)
+}
+
+// mappedFields tells which of the queryFields can be used in the queries of an index
+type mappedFields struct {
+	unusable map[string]bool
+}
+
+func (f mappedFields) usable(fields ...string) bool {
+	for _, field := range fields {
+		if f.unusable[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldOr returns the field if it is usable, or the fallback, e.g. prefLabel instead of its prefLabel.edge_ngram subfield
+func (f mappedFields) fieldOr(field string, fallback string) string {
+	if f.usable(field) {
+		return field
+	}
+	return fallback
+}
+
+// fieldClause is a query clause together with the fields it relies on
+type fieldClause struct {
+	query  elastic.Query
+	fields []string
+}
+
+func clause(query elastic.Query, fields ...string) fieldClause {
+	return fieldClause{query: query, fields: fields}
+}
+
+// clauses drops the clauses relying on unusable fields. It is only meant for scoring clauses, dropping a filter would
+// widen the results.
+func (f mappedFields) clauses(clauses ...fieldClause) []elastic.Query {
+	queries := make([]elastic.Query, 0, len(clauses))
+	for _, c := range clauses {
+		if f.usable(c.fields...) {
+			queries = append(queries, c.query)
+		}
+	}
+	return queries
+}
+
+// MappingStatus returns the outcome of the last check of the mappings
+func (s *esConceptSearchService) MappingStatus() MappingStatus {
+	s.mappingLock.RLock()
+	defer s.mappingLock.RUnlock()
+	return s.mappingStatus
+}
+
+// StartMappingRefresh checks the mappings of the searched indices every interval, as well as whenever the elastic
+// client is set or the indices are switched
+func (s *esConceptSearchService) StartMappingRefresh(interval time.Duration) {
+	s.mappingRefreshInterval = interval
+	s.mappingRefreshTicker = time.NewTicker(interval)
+	go func() {
+		s.refreshMappings()
+		for {
+			select {
+			case <-s.mappingRefreshTicker.C:
+			case <-s.mappingRefresh:
+			}
+			s.refreshMappings()
+		}
+	}()
+}
+
+// requestMappingRefresh triggers a check of the mappings without waiting for the next tick, if the refresh is started
+func (s *esConceptSearchService) requestMappingRefresh() {
+	select {
+	case s.mappingRefresh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *esConceptSearchService) mappedFields(index string) mappedFields {
+	s.mappingLock.RLock()
+	defer s.mappingLock.RUnlock()
+	return mappedFields{unusable: s.unusableFields[index]}
+}
+
+func (s *esConceptSearchService) refreshMappings() {
+	backend := s.searchBackend()
+	if backend == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mappingCheckTimeout)
+	defer cancel()
+
+	status := MappingStatus{Checked: time.Now()}
+	unusable := make(map[string]map[string]bool)
+	indices := s.IndexTargets()
+	for _, index := range []string{indices.DefaultIndex, indices.ExtendedSearchIndex} {
+		if _, checked := unusable[index]; checked || index == "" {
+			continue
+		}
+		problems, err := checkIndexMapping(ctx, backend, s.breaker, index)
+		if err != nil {
+			log.WithError(err).WithField("index", index).Error("failed to check the mapping of the index")
+			status.Error = err.Error()
+			// the fields found unusable by the previous check are still dropped from the queries
+			unusable[index] = s.mappedFields(index).unusable
+			continue
+		}
+		unusable[index] = make(map[string]bool)
+		for _, p := range problems {
+			unusable[index][p.Field] = true
+		}
+		status.Problems = append(status.Problems, problems...)
+	}
+	if len(status.Problems) > 0 {
+		log.WithField("problems", status.Problems).Warn("the queries are degraded as fields they depend on are missing from or mistyped in the indices")
+	}
+
+	s.mappingLock.Lock()
+	defer s.mappingLock.Unlock()
+	s.mappingStatus = status
+	s.unusableFields = unusable
+}
+
+// FieldMappings is the response of the get field mapping API, by concrete index and by field
+type FieldMappings map[string]struct {
+	Mappings map[string]FieldMapping `json:"mappings"`
+}
+
+// FieldMapping holds the mapping of a field keyed by the last part of its name
+type FieldMapping struct {
+	Mapping map[string]struct {
+		Type string `json:"type"`
+	} `json:"mapping"`
+}
+
+func (m FieldMapping) fieldType() string {
+	for _, leaf := range m.Mapping {
+		return leaf.Type
+	}
+	return ""
+}
+
+// checkIndexMapping finds the queryFields which are missing from or mistyped in any of the indices behind the index,
+// which may be an alias
+func checkIndexMapping(ctx context.Context, backend Backend, breaker *CircuitBreaker, index string) ([]FieldProblem, error) {
+	fields := make([]string, 0, len(queryFields))
+	for field := range queryFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	if err := breaker.AllowCheck(); err != nil {
+		return nil, err
+	}
+	mappings, err := backend.FieldMappings(ctx, index, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("no mapping found for index %v", index)
+	}
+
+	var problems []FieldProblem
+	for _, field := range fields {
+		for _, concreteIndex := range sortedKeys(mappings) {
+			mapping, found := mappings[concreteIndex].Mappings[field]
+			if !found {
+				problems = append(problems, FieldProblem{Index: index, Field: field, Problem: fmt.Sprintf("missing from %v", concreteIndex)})
+				break
+			}
+			if fieldType := mapping.fieldType(); !contains(queryFields[field], fieldType) {
+				problems = append(problems, FieldProblem{Index: index, Field: field, Problem: fmt.Sprintf("mapped as %v in %v, expected %v", fieldType, concreteIndex, strings.Join(queryFields[field], " or "))})
+				break
+			}
+		}
+	}
+	return problems, nil
+}
+
+func sortedKeys(mappings FieldMappings) []string {
+	keys := make([]string, 0, len(mappings))
+	for k := range mappings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
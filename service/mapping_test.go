@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mappingESStub answers the get field mapping requests with the field types of its mapping, and the searches with no
+// hits, recording the bodies of the searches
+type mappingESStub struct {
+	sync.Mutex
+	fieldTypes     map[string]string
+	mappingFetches int
+	searches       []string
+}
+
+func newMappingESStub() *mappingESStub {
+	fieldTypes := make(map[string]string)
+	for field, types := range queryFields {
+		fieldTypes[field] = types[0]
+	}
+	return &mappingESStub{fieldTypes: fieldTypes}
+}
+
+func (s *mappingESStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if strings.Contains(r.URL.Path, "/_mapping/field/") {
+		s.mappingFetches++
+		mappings := make(map[string]interface{})
+		for field, fieldType := range s.fieldTypes {
+			leaf := field[strings.LastIndex(field, ".")+1:]
+			mappings[field] = map[string]interface{}{"full_name": field, "mapping": map[string]interface{}{leaf: map[string]string{"type": fieldType}}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"concepts-000001": map[string]interface{}{"mappings": mappings}})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	s.searches = append(s.searches, string(body))
+	fmt.Fprint(w, `{"hits":{"total":{"value":0,"relation":"eq"},"hits":[]}}`)
+}
+
+func TestCompatibleMapping(t *testing.T) {
+	stub := newMappingESStub()
+	s := newStubbedService(t, stub)
+
+	s.refreshMappings()
+
+	status := s.MappingStatus()
+	assert.False(t, status.Checked.IsZero())
+	assert.Empty(t, status.Error)
+	assert.Empty(t, status.Problems)
+	assert.Equal(t, 2, stub.mappingFetches, "both indices are checked")
+}
+
+func TestIncompatibleMapping(t *testing.T) {
+	stub := newMappingESStub()
+	delete(stub.fieldTypes, "prefLabel.edge_ngram")
+	stub.fieldTypes["metrics.annotationsCount"] = "text"
+	s := newStubbedService(t, stub)
+
+	s.refreshMappings()
+
+	status := s.MappingStatus()
+	assert.Contains(t, status.Problems, FieldProblem{Index: "concepts", Field: "metrics.annotationsCount", Problem: "mapped as text in concepts-000001, expected long or integer or short or byte or double or float or half_float or scaled_float"})
+	assert.Contains(t, status.Problems, FieldProblem{Index: "all-concepts", Field: "prefLabel.edge_ngram", Problem: "missing from concepts-000001"})
+	assert.Len(t, status.Problems, 4)
+	assert.False(t, s.mappedFields("concepts").usable("prefLabel.edge_ngram"))
+	assert.True(t, s.mappedFields("concepts").usable("aliases.edge_ngram"))
+}
+
+func TestSearchDropsClausesOnUnusableFields(t *testing.T) {
+	stub := newMappingESStub()
+	delete(stub.fieldTypes, "prefLabel.edge_ngram")
+	delete(stub.fieldTypes, "metrics.prevWeekAnnotationsCount")
+	s := newStubbedService(t, stub)
+	s.refreshMappings()
+
+	_, err := s.SearchConceptByTextAndTypes(context.Background(), "fast", []string{"http://www.ft.com/ontology/person/Person"}, false, false, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, stub.searches, 1)
+	search := stub.searches[0]
+	assert.NotContains(t, search, "prefLabel.edge_ngram")
+	assert.NotContains(t, search, "metrics.prevWeekAnnotationsCount")
+	assert.Contains(t, search, `"prefLabel":{"query":"fast"}`, "the edge ngram match falls back on the prefLabel")
+	assert.Contains(t, search, "metrics.annotationsCount", "clauses on usable fields are kept")
+	assert.Contains(t, search, "aliases.edge_ngram")
+}
+
+func TestSearchKeepsClausesOnCompatibleMapping(t *testing.T) {
+	stub := newMappingESStub()
+	s := newStubbedService(t, stub)
+	s.refreshMappings()
+
+	_, err := s.SearchConceptByTextAndTypes(context.Background(), "fast", []string{"http://www.ft.com/ontology/person/Person"}, false, false, false, nil)
+	require.NoError(t, err)
+
+	require.Len(t, stub.searches, 1)
+	assert.Contains(t, stub.searches[0], "prefLabel.edge_ngram")
+	assert.Contains(t, stub.searches[0], "metrics.prevWeekAnnotationsCount")
+}
+
+func TestMappingRefreshedWhenClientIsSet(t *testing.T) {
+	ec := newStubbedClient(t, newMappingESStub())
+
+	s := NewEsConceptSearchService("concepts", "all-concepts", 50, 10, 10)
+	s.StartMappingRefresh(time.Hour)
+	assert.True(t, s.MappingStatus().Checked.IsZero(), "no mapping is checked without a client")
+
+	s.SetElasticClient(ec)
+
+	assert.Eventually(t, func() bool { return !s.MappingStatus().Checked.IsZero() }, time.Second, 10*time.Millisecond)
+}
@@ -22,6 +22,7 @@ type EsConceptModel struct {
 	Metrics                *ConceptMetrics `json:"metrics,omitempty"`
 	CountryCode            string          `json:"countryCode,omitempty"`
 	CountryOfIncorporation string          `json:"countryOfIncorporation,omitempty"`
+	ReplacedBy             string          `json:"replacedBy,omitempty"`
 }
 
 type ConceptMetrics struct {
@@ -30,20 +31,72 @@ type ConceptMetrics struct {
 }
 
 type Concept struct {
-	Id                     string `json:"id"`
-	UUID                   string `json:"uuid"`
-	ApiUrl                 string `json:"apiUrl"`
-	PrefLabel              string `json:"prefLabel"`
-	ConceptType            string `json:"type"`
-	IsFTAuthor             *bool  `json:"isFTAuthor,omitempty"`
-	IsDeprecated           bool   `json:"isDeprecated,omitempty"`
-	ScopeNote              string `json:"scopeNote,omitempty"`
-	CountryCode            string `json:"countryCode,omitempty"`
-	CountryOfIncorporation string `json:"countryOfIncorporation,omitempty"`
+	Id                     string   `json:"id"`
+	UUID                   string   `json:"uuid"`
+	ApiUrl                 string   `json:"apiUrl"`
+	PrefLabel              string   `json:"prefLabel"`
+	ConceptType            string   `json:"type"`
+	IsFTAuthor             *bool    `json:"isFTAuthor,omitempty"`
+	IsDeprecated           bool     `json:"isDeprecated,omitempty"`
+	ScopeNote              string   `json:"scopeNote,omitempty"`
+	CountryCode            string   `json:"countryCode,omitempty"`
+	CountryOfIncorporation string   `json:"countryOfIncorporation,omitempty"`
+	ReplacedBy             string   `json:"replacedBy,omitempty"`
+	Aliases                []string `json:"-"` // not part of the JSON representation, only used for linked data
 }
 
 type Concepts []Concept
 
+// ScoredConcept is a concept as it is stored in elasticsearch, along with the relevance score of the search hit
+type ScoredConcept struct {
+	EsConceptModel
+	Score float64
+}
+
+// Annotation is a mention of a concept in a text, between the Start and End (exclusive) character offsets
+type Annotation struct {
+	Start   int     `json:"start"`
+	End     int     `json:"end"`
+	Text    string  `json:"text"`
+	Concept Concept `json:"concept"`
+	Score   float64 `json:"score"`
+}
+
+// Statuses of the best match search of a term
+const (
+	BestMatchFound    = "found"
+	BestMatchNotFound = "notFound"
+	BestMatchError    = "error"
+)
+
+// ConceptGroup is the listing of the concepts of one of the types of a multi-type listing. Total counts all the concepts
+// of the type, of which only a page may be listed. Next is the cursor of the following page, if there may be one.
+type ConceptGroup struct {
+	Type     string   `json:"type"`
+	Total    int64    `json:"total"`
+	Concepts Concepts `json:"concepts"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// BestMatch is the outcome of the best match search of a single term. Err is only set for the BestMatchError status.
+type BestMatch struct {
+	Status   string
+	Concepts []ScoredConcept
+	Err      error
+}
+
+// BestMatchCriteria holds the terms to be matched against the concept aliases and the options of the best match search
+type BestMatchCriteria struct {
+	Terms                []string
+	ConceptTypes         []string
+	BoostType            string
+	FilterType           string
+	Limit                int     // the maximum number of candidates returned for each term, the best match only if zero
+	MinScore             float64 // candidates scoring below this are left out
+	SearchAllAuthorities bool
+	IncludeDeprecated    bool
+}
+
 var (
 	incorrectPath = "http://api.ft.com/things/"
 )
@@ -57,6 +110,10 @@ func ConvertToSimpleConcept(esConcept EsConceptModel) Concept {
 	c.ScopeNote = esConcept.ScopeNote
 	c.CountryCode = esConcept.CountryCode
 	c.CountryOfIncorporation = esConcept.CountryOfIncorporation
+	c.Aliases = esConcept.Aliases
+	if esConcept.ReplacedBy != "" {
+		c.ReplacedBy = correctPath(esConcept.ReplacedBy)
+	}
 	if esConcept.IsFTAuthor != nil {
 		ftAuthor, err := strconv.ParseBool(*esConcept.IsFTAuthor)
 		if err != nil {
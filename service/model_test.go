@@ -133,3 +133,17 @@ func TestConvertToSimpleConceptWithNonBoolFTAuthor(t *testing.T) {
 	actual := ConvertToSimpleConcept(esConcept)
 	assert.Nil(t, actual.IsFTAuthor)
 }
+
+func TestConvertToSimpleConceptWithReplacedBy(t *testing.T) {
+	esConcept := EsConceptModel{
+		Id:           "http://api.ft.com/things/82cba3ce-329b-3010-b29d-4282a215889f",
+		PrefLabel:    "Deprecated Concept",
+		Types:        []string{"any"},
+		DirectType:   "any",
+		IsDeprecated: true,
+		ReplacedBy:   "http://api.ft.com/things/1c4c4e9f-4a4e-3a3c-8c4f-2b3e0f2a9d1e",
+	}
+
+	actual := ConvertToSimpleConcept(esConcept)
+	assert.Equal(t, "http://www.ft.com/thing/1c4c4e9f-4a4e-3a3c-8c4f-2b3e0f2a9d1e", actual.ReplacedBy, "The replacedBy id did not get converted properly")
+}
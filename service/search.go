@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
@@ -13,72 +14,95 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const maxReplacementHops = 5 // replacements followed from a deprecated concept, guarding against cycles
+
 var (
-	errEmptyTextParameter = util.NewInputError("empty text parameter")
-	errEmptyIdsParameter  = util.NewInputError("empty Ids parameter")
+	errEmptyTextParameter = util.NewInputError(util.ErrCodeMissingParameter, "q", "empty text parameter")
+	errEmptyIdsParameter  = util.NewInputError(util.ErrCodeMissingParameter, "ids", "empty Ids parameter")
 
 	mentionTypes = []string{"http://www.ft.com/ontology/person/Person", "http://www.ft.com/ontology/organisation/Organisation", "http://www.ft.com/ontology/Location", "http://www.ft.com/ontology/Topic"}
 )
 
 type ConceptSearchService interface {
 	SetElasticClient(client *elastic.Client)
-	FindConceptsById(ids []string) ([]Concept, error)
-	FindAllConceptsByType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error)
-	FindAllConceptsByDirectType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error)
-	SearchConceptByTextAndTypes(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error)
-	SearchConceptByTextAndTypesWithBoost(textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error)
-	SearchConceptByTextAndTypesInTextMode(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error)
+	FindConceptsById(ctx context.Context, ids []string, followReplacements bool) ([]Concept, error)
+	FindAllConceptsByType(ctx context.Context, conceptType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error)
+	FindAllConceptsByTypes(ctx context.Context, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string, cursors []string) ([]ConceptGroup, error)
+	SearchConceptByTextAndTypes(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error)
+	SearchConceptByTextAndTypesWithBoost(ctx context.Context, textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error)
+	SearchConceptByTextAndTypesInTextMode(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error)
+	SearchConceptsByTerm(ctx context.Context, term string, searchAllAuthorities bool, includeDeprecated bool) ([]ScoredConcept, error)
+	FindBestMatchingConcepts(ctx context.Context, criteria BestMatchCriteria) (map[string]BestMatch, error)
+	AnnotateText(ctx context.Context, text string, conceptTypes []string) ([]Annotation, error)
+	IndexTargets() IndexTargets
+	SwitchIndices(ctx context.Context, targets IndexTargets) error
+	StartMappingRefresh(interval time.Duration)
+	MappingStatus() MappingStatus
+	SetCircuitBreaker(breaker *CircuitBreaker)
+	SetHedger(hedger *Hedger)
+	SetBackend(kind BackendKind)
 }
 
 type esConceptSearchService struct {
-	esClient               *elastic.Client
-	defaultIndex           string
-	extendedSearchIndex    string
+	backendKind            BackendKind
+	backend                Backend
+	indices                IndexTargets
+	indicesLock            *sync.RWMutex
 	maxSearchResults       int
 	maxIdsLimit            int
 	maxAutoCompleteResults int
 	mappingRefreshTicker   *time.Ticker
 	mappingRefreshInterval time.Duration
+	mappingRefresh         chan struct{}
+	mappingLock            *sync.RWMutex
+	mappingStatus          MappingStatus
+	unusableFields         map[string]map[string]bool // by index, the fields which are missing from or mistyped in its mapping
 	clientLock             *sync.RWMutex
+	directTypes            *directTypesCache
+	breaker                *CircuitBreaker
+	hedger                 *Hedger
 }
 
 func NewEsConceptSearchService(defaultIndex string, extendedSearchIndex string, maxSearchResults int, maxIdsLimit int, maxAutoCompleteResults int) ConceptSearchService {
 	return &esConceptSearchService{
-		defaultIndex:           defaultIndex,
-		extendedSearchIndex:    extendedSearchIndex,
+		indices:                IndexTargets{DefaultIndex: defaultIndex, ExtendedSearchIndex: extendedSearchIndex},
+		indicesLock:            &sync.RWMutex{},
 		maxSearchResults:       maxSearchResults,
 		maxIdsLimit:            maxIdsLimit,
 		maxAutoCompleteResults: maxAutoCompleteResults,
+		mappingRefresh:         make(chan struct{}, 1),
+		mappingLock:            &sync.RWMutex{},
 		clientLock:             &sync.RWMutex{},
+		backendKind:            Elasticsearch,
+		directTypes:            newDirectTypesCache(),
 	}
 }
 
 func (s *esConceptSearchService) checkElasticClient() error {
-	if s.elasticClient() == nil {
+	if s.searchBackend() == nil {
 		return util.ErrNoElasticClient
 	}
 	return nil
 }
 
-func (s *esConceptSearchService) FindAllConceptsByType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
-	t := util.EsType(conceptType)
-	if t == "" {
-		return nil, util.NewInputErrorf(util.ErrInvalidConceptTypeFormat, conceptType)
+// FindAllConceptsByType lists the concepts of the type. With includeSubtypes the concepts of its descendants in the
+// ontology are listed too. The concepts can be further restricted to some direct types.
+func (s *esConceptSearchService) FindAllConceptsByType(ctx context.Context, conceptType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
+	typeQuery, err := conceptTypeQuery(conceptType, includeSubtypes)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := s.checkElasticClient(); err != nil {
 		return nil, err
 	}
 
-	boolQuery := elastic.NewBoolQuery()
-	boolQuery.Must(elastic.NewTermQuery("type", t))
-
-	if !includeDeprecated {
-		boolQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
+	if err := s.validateDirectTypes(ctx, index, directTypes); err != nil {
+		return nil, err
 	}
 
-	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
-	result, err := s.esClient.Search(index).Size(s.maxSearchResults).Query(boolQuery).Do(context.Background())
+	result, err := s.doSearch(ctx, SearchRequest{Index: index, Source: elastic.NewSearchSource().Size(s.maxSearchResults).Query(typeListingQuery(typeQuery, includeDeprecated, directTypes))})
 	if err != nil {
 		log.Errorf("error: %v", err)
 		return nil, err
@@ -88,43 +112,195 @@ func (s *esConceptSearchService) FindAllConceptsByType(conceptType string, searc
 	return concepts, nil
 }
 
-func (s *esConceptSearchService) FindAllConceptsByDirectType(conceptType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
-	boolQuery := elastic.NewBoolQuery()
-	boolQuery.Must(elastic.NewMatchQuery("directType", conceptType))
+// FindAllConceptsByTypes lists the concepts of several types in a single multi search request. The concepts are
+// grouped by type, in the order of the types, and sorted by prefLabel then id within every group. A group which may
+// have more concepts returns the cursor of its next page, which can be given back to list the concepts after it.
+func (s *esConceptSearchService) FindAllConceptsByTypes(ctx context.Context, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string, cursors []string) ([]ConceptGroup, error) {
+	if len(conceptTypes) == 0 {
+		return nil, util.ErrNoConceptTypeParameter
+	}
+	after, err := decodeCursors(cursors, conceptTypes)
+	if err != nil {
+		return nil, err
+	}
 
-	if !includeDeprecated {
-		boolQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+	var types []string
+	var sources []*elastic.SearchSource
+	seen := make(map[string]bool)
+	for _, conceptType := range conceptTypes {
+		if seen[conceptType] {
+			continue
+		}
+		seen[conceptType] = true
+
+		typeQuery, err := conceptTypeQuery(conceptType, includeSubtypes)
+		if err != nil {
+			return nil, err
+		}
+		ss := elastic.NewSearchSource().Size(s.maxSearchResults).Query(typeListingQuery(typeQuery, includeDeprecated, directTypes)).
+			Sort("prefLabel.raw", true).Sort("_id", true)
+		if values, found := after[conceptType]; found {
+			ss = ss.SearchAfter(values...)
+		}
+		types = append(types, conceptType)
+		sources = append(sources, ss)
+	}
+
+	if err := s.checkElasticClient(); err != nil {
+		return nil, err
 	}
 
 	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
-	result, err := s.esClient.Search(index).Size(s.maxSearchResults).Query(boolQuery).Do(context.Background())
+	if err := s.validateDirectTypes(ctx, index, directTypes); err != nil {
+		return nil, err
+	}
+
+	result, err := s.doMultiSearch(ctx, index, sources)
 	if err != nil {
 		log.Errorf("error: %v", err)
 		return nil, err
 	}
-	concepts := searchResultToConcepts(result)
-	sort.Sort(concepts)
-	return concepts, nil
+	if len(result.Responses) != len(types) {
+		return nil, fmt.Errorf("expected %d responses from elasticsearch, got %d", len(types), len(result.Responses))
+	}
+
+	groups := make([]ConceptGroup, 0, len(types))
+	for i, response := range result.Responses {
+		if response.Error != nil || response.Hits == nil {
+			err := fmt.Errorf("failed to list the concepts of type %v", types[i])
+			if response.Error != nil {
+				err = fmt.Errorf("failed to list the concepts of type %v: %v: %v", types[i], response.Error.Type, response.Error.Reason)
+			}
+			log.WithError(err).Error("multi-type listing failed")
+			return nil, err
+		}
+		group := ConceptGroup{Type: types[i], Total: response.TotalHits(), Concepts: searchResultToConcepts(response)}
+		if hits := response.Hits.Hits; len(hits) == s.maxSearchResults {
+			group.Next = encodeCursor(types[i], hits[len(hits)-1].Sort)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
 }
 
-func (s *esConceptSearchService) FindConceptsById(ids []string) ([]Concept, error) {
+func typeListingQuery(typeQuery elastic.Query, includeDeprecated bool, directTypes []string) elastic.Query {
+	boolQuery := elastic.NewBoolQuery()
+	boolQuery.Must(typeQuery)
+	boolQuery.Filter(directTypeFilters(directTypes)...)
+
+	if !includeDeprecated {
+		boolQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+	}
+	return boolQuery
+}
+
+func conceptTypeQuery(conceptType string, includeSubtypes bool) (elastic.Query, error) {
+	if includeSubtypes {
+		if err := util.ValidateOntologyTypes([]string{conceptType}); err != nil {
+			return nil, err
+		}
+		return elastic.NewTermQuery("types", conceptType), nil
+	}
+
+	t, found := util.GetTypeRegistry().Lookup(conceptType)
+	if !found {
+		return nil, util.NewInputErrorf(util.ErrCodeInvalidConceptType, "type", util.ErrInvalidConceptTypeFormat, conceptType)
+	}
+	if t.DirectType {
+		return elastic.NewTermQuery("directType", conceptType), nil
+	}
+	return elastic.NewTermQuery("type", t.EsType), nil
+}
+
+func (s *esConceptSearchService) FindConceptsById(ctx context.Context, ids []string, followReplacements bool) ([]Concept, error) {
 	if ids == nil || len(ids) == 0 || containsOnlyEmptyValues(ids) {
 		return nil, errEmptyIdsParameter
 	}
 	if len(ids) > s.maxIdsLimit {
-		return nil, util.NewInputErrorf(util.ErrMaxIdsLimitFormat, len(ids), s.maxIdsLimit)
+		return nil, util.NewInputErrorf(util.ErrCodeIdsLimitExceeded, "ids", util.ErrMaxIdsLimitFormat, len(ids), s.maxIdsLimit)
 	}
 	if err := s.checkElasticClient(); err != nil {
 		return nil, err
 	}
+	concepts, err := s.findConceptsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if followReplacements {
+		return s.followReplacements(ctx, concepts)
+	}
+	return concepts, nil
+}
+
+func (s *esConceptSearchService) findConceptsByIds(ctx context.Context, ids []string) (Concepts, error) {
 	idsQuery := elastic.NewIdsQuery().Ids(ids...)
-	result, err := s.esClient.Search(s.extendedSearchIndex).Size(len(ids)).Query(idsQuery).Do(context.Background())
+	result, err := s.doSearch(ctx, SearchRequest{Index: s.IndexTargets().ExtendedSearchIndex, Source: elastic.NewSearchSource().Size(len(ids)).Query(idsQuery)})
 	if err != nil {
 		log.Errorf("error: %v", err)
 		return nil, err
 	}
-	concepts := searchResultToConcepts(result)
-	return concepts, nil
+	return searchResultToConcepts(result), nil
+}
+
+// followReplacements puts the live successor of every deprecated concept in its place, following chains of replacements
+// up to maxReplacementHops. A deprecated concept whose successor is not found is kept, along with its replacedBy pointer.
+func (s *esConceptSearchService) followReplacements(ctx context.Context, concepts Concepts) (Concepts, error) {
+	for hop := 0; hop < maxReplacementHops; hop++ {
+		var successorIds []string
+		for _, c := range concepts {
+			if id, replaced := replacementUUID(c); replaced {
+				successorIds = append(successorIds, id)
+			}
+		}
+		if len(successorIds) == 0 {
+			break
+		}
+
+		successors, err := s.findConceptsByIds(ctx, successorIds)
+		if err != nil {
+			return nil, err
+		}
+		successorsByUUID := make(map[string]Concept, len(successors))
+		for _, successor := range successors {
+			successorsByUUID[successor.UUID] = successor
+		}
+
+		replacedAny := false
+		for i, c := range concepts {
+			if id, replaced := replacementUUID(c); replaced {
+				if successor, found := successorsByUUID[id]; found {
+					concepts[i] = successor
+					replacedAny = true
+				}
+			}
+		}
+		if !replacedAny {
+			break
+		}
+	}
+
+	// several deprecated concepts may have been replaced by the same one, or by one which was asked for as well
+	unique := Concepts{}
+	seen := make(map[string]bool, len(concepts))
+	for _, c := range concepts {
+		if !seen[c.Id] {
+			seen[c.Id] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique, nil
+}
+
+func replacementUUID(c Concept) (string, bool) {
+	if !c.IsDeprecated || c.ReplacedBy == "" {
+		return "", false
+	}
+	uuid, err := util.ExtractUUID(c.ReplacedBy)
+	if err != nil {
+		log.WithField("id", c.Id).WithField("replacedBy", c.ReplacedBy).Warn("couldn't extract the UUID of the replacement concept")
+		return "", false
+	}
+	return uuid, true
 }
 
 func searchResultToConcepts(result *elastic.SearchResult) Concepts {
@@ -150,15 +326,15 @@ func transformToConcept(source json.RawMessage) (Concept, error) {
 	return ConvertToSimpleConcept(esConcept), nil
 }
 
-func (s *esConceptSearchService) SearchConceptByTextAndTypes(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
+func (s *esConceptSearchService) SearchConceptByTextAndTypes(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
 	searchQueryInputErr := s.validateSearchQueryInput(textQuery, conceptTypes)
 	if searchQueryInputErr != nil {
 		return nil, searchQueryInputErr
 	}
-	return s.searchConceptsForMultipleTypes(textQuery, conceptTypes, "", searchAllAuthorities, includeDeprecated)
+	return s.searchConceptsForMultipleTypes(ctx, textQuery, conceptTypes, "", searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
-func (s *esConceptSearchService) SearchConceptByTextAndTypesWithBoost(textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
+func (s *esConceptSearchService) SearchConceptByTextAndTypesWithBoost(ctx context.Context, textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
 	if err := util.ValidateForAuthorsSearch(conceptTypes, boostType); err != nil {
 		return nil, err
 	}
@@ -166,35 +342,41 @@ func (s *esConceptSearchService) SearchConceptByTextAndTypesWithBoost(textQuery
 	if searchQueryInputErr != nil {
 		return nil, searchQueryInputErr
 	}
-	return s.searchConceptsForMultipleTypes(textQuery, conceptTypes, boostType, searchAllAuthorities, includeDeprecated)
+	return s.searchConceptsForMultipleTypes(ctx, textQuery, conceptTypes, boostType, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
-func (s *esConceptSearchService) SearchConceptByTextAndTypesInTextMode(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
+func (s *esConceptSearchService) SearchConceptByTextAndTypesInTextMode(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
 	searchQueryInputErr := s.validateSearchQueryInput(textQuery, conceptTypes)
 	if searchQueryInputErr != nil {
 		return nil, searchQueryInputErr
 	}
-	return s.searchConceptsForMultipleTypesInTextMode(textQuery, conceptTypes, searchAllAuthorities, includeDeprecated)
+	return s.searchConceptsForMultipleTypesInTextMode(ctx, textQuery, conceptTypes, searchAllAuthorities, includeDeprecated, includeSubtypes, directTypes)
 }
 
 // Due to the popularity boost this configuration is mostly suited to topics, locations, and people
-func (s *esConceptSearchService) searchConceptsForMultipleTypes(textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
-	esTypes, isPublicCompanyType, err := util.ValidateAndConvertToEsTypes(conceptTypes)
+func (s *esConceptSearchService) searchConceptsForMultipleTypes(ctx context.Context, textQuery string, conceptTypes []string, boostType string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
+	typeFilterQuery, err := conceptTypesFilter(conceptTypes, includeSubtypes)
 	if err != nil {
 		return nil, err
 	}
+	if err := util.ValidateConceptTypesForSearchMode(conceptTypes); err != nil {
+		return nil, err
+	}
+	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
+	if err := s.validateDirectTypes(ctx, index, directTypes); err != nil {
+		return nil, err
+	}
+
+	// clauses on fields missing from the mapping of the index are dropped, or fall back to the parent field if required
+	fields := s.mappedFields(index)
 
-	textMatch := elastic.NewMatchQuery("prefLabel.edge_ngram", textQuery)
-	aliasesExactMatchMustQuery := elastic.NewMatchQuery("aliases.edge_ngram", textQuery).Boost(0.8)
+	textMatch := elastic.NewMatchQuery(fields.fieldOr("prefLabel.edge_ngram", "prefLabel"), textQuery)
+	aliasesExactMatchMustQuery := elastic.NewMatchQuery(fields.fieldOr("aliases.edge_ngram", "aliases"), textQuery).Boost(0.8)
 	mustQuery := elastic.NewBoolQuery().Should(textMatch, aliasesExactMatchMustQuery).MinimumNumberShouldMatch(1) // All searches must either match loosely on `prefLabel`, or exactly on `aliases`
 
 	termMatchQuery := elastic.NewMatchQuery("prefLabel", textQuery).Boost(0.1)             // Additional boost added if whole terms match, i.e. Donald Trump =returns=> Donald J Trump higher than Donald Trumpy
 	exactMatchQuery := elastic.NewMatchQuery("prefLabel.exact_match", textQuery).Boost(15) // Further boost if the prefLabel matches exactly (barring special characters)
 
-	topicsBoost := elastic.NewTermQuery("type", "topics").Boost(1.5)
-	locationBoost := elastic.NewTermQuery("type", "locations").Boost(0.25)
-	peopleBoost := elastic.NewTermQuery("type", "people").Boost(0.1)
-
 	// ES library does not support building an exists query like; {"exists": {"field":"scopeNote", "boost":1.7}}
 	// Another option to provide the same functionality/boosting is via a bool query.
 	scopeNoteExistBoost := elastic.NewBoolQuery().Must(elastic.NewExistsQuery("scopeNote")).Boost(1.7)
@@ -219,13 +401,18 @@ func (s *esConceptSearchService) searchConceptsForMultipleTypes(textQuery string
 
 	aliasesExactMatchShouldQuery := elastic.NewMatchQuery("aliases.exact_match", textQuery).Boost(0.85) // Also boost if an alias matches exactly, but this should not precede exact matched prefLabels
 
-	typeFilters := []elastic.Query{elastic.NewTermsQuery("type", util.ToTerms(esTypes)...)}
-	if isPublicCompanyType {
-		typeFilters = append(typeFilters, elastic.NewTermQuery("directType", util.PublicCompany))
-	}
-	typeFilterQuery := elastic.NewBoolQuery().Should(typeFilters...)
-
-	shouldMatch := []elastic.Query{termMatchQuery, exactMatchQuery, aliasesExactMatchShouldQuery, topicsBoost, locationBoost, peopleBoost, scopeNoteExistBoost, phraseMatchQuery, popularityBoost, lastWeekPopularityBoost}
+	shouldMatch := fields.clauses(
+		clause(termMatchQuery, "prefLabel"),
+		clause(exactMatchQuery, "prefLabel.exact_match"),
+		clause(aliasesExactMatchShouldQuery, "aliases.exact_match"),
+	)
+	shouldMatch = append(shouldMatch, typeBoosts(util.ModeSearch)...)
+	shouldMatch = append(shouldMatch, fields.clauses(
+		clause(scopeNoteExistBoost, "scopeNote"),
+		clause(phraseMatchQuery, "prefLabel.edge_ngram", "aliases.edge_ngram", "type", "metrics.annotationsCount", "metrics.prevWeekAnnotationsCount"),
+		clause(popularityBoost, "metrics.annotationsCount"),
+		clause(lastWeekPopularityBoost, "metrics.prevWeekAnnotationsCount"),
+	)...)
 
 	if boostType != "" {
 		shouldMatch = append(shouldMatch, elastic.NewTermQuery("isFTAuthor", "true").Boost(1.8))
@@ -237,12 +424,11 @@ func (s *esConceptSearchService) searchConceptsForMultipleTypes(textQuery string
 		mustNotMatch = append(mustNotMatch, elastic.NewTermQuery("isDeprecated", true)) // exclude deprecated docs
 	}
 
-	theQuery := elastic.NewBoolQuery().Must(mustQuery).Should(shouldMatch...).MustNot(mustNotMatch...).Filter(typeFilterQuery).MinimumNumberShouldMatch(0).Boost(1)
+	theQuery := elastic.NewBoolQuery().Must(mustQuery).Should(shouldMatch...).MustNot(mustNotMatch...).Filter(typeFilterQuery).Filter(directTypeFilters(directTypes)...).MinimumNumberShouldMatch(0).Boost(1)
 
-	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
-	search := s.esClient.Search(index).Size(s.maxAutoCompleteResults).Query(theQuery)
+	search := SearchRequest{Index: index, Source: elastic.NewSearchSource().Size(s.maxAutoCompleteResults).Query(theQuery)}
 
-	result, err := search.SearchType("dfs_query_then_fetch").Do(context.Background())
+	result, err := s.doHedgedSearch(ctx, search)
 	if err != nil {
 		log.Errorf("error: %v", err)
 		return nil, err
@@ -253,29 +439,31 @@ func (s *esConceptSearchService) searchConceptsForMultipleTypes(textQuery string
 
 // This configuration is better suited to types such as organisations and public companies whose popularity is not usually
 // affected by recent (last week) events
-func (s *esConceptSearchService) searchConceptsForMultipleTypesInTextMode(textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool) ([]Concept, error) {
-	esTypes, isPublicCompanyType, err := util.ValidateAndConvertToEsTypes(conceptTypes)
+func (s *esConceptSearchService) searchConceptsForMultipleTypesInTextMode(ctx context.Context, textQuery string, conceptTypes []string, searchAllAuthorities bool, includeDeprecated bool, includeSubtypes bool, directTypes []string) ([]Concept, error) {
+	typeFilterQuery, err := conceptTypesFilter(conceptTypes, includeSubtypes)
 	if err != nil {
 		return nil, err
 	}
+	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
+	if err := s.validateDirectTypes(ctx, index, directTypes); err != nil {
+		return nil, err
+	}
+
+	// clauses on fields missing from the mapping of the index are dropped, or fall back to the parent field if required
+	fields := s.mappedFields(index)
 
-	prefLabelMatchMustQuery := elastic.NewMatchQuery("prefLabel.edge_ngram", textQuery).Boost(5)
-	aliasesMatchMustQuery := elastic.NewMatchQuery("aliases.edge_ngram", textQuery).Boost(5)
+	prefLabelMatchMustQuery := elastic.NewMatchQuery(fields.fieldOr("prefLabel.edge_ngram", "prefLabel"), textQuery).Boost(5)
+	aliasesMatchMustQuery := elastic.NewMatchQuery(fields.fieldOr("aliases.edge_ngram", "aliases"), textQuery).Boost(5)
 	prefixMatchQuery := elastic.NewPrefixQuery("prefLabel.exact_match", textQuery)
 	aliasesPrefixMatchQuery := elastic.NewPrefixQuery("aliases.exact_match", textQuery)
-	mustQuery := elastic.NewBoolQuery().Should(prefLabelMatchMustQuery, aliasesMatchMustQuery, prefixMatchQuery, aliasesPrefixMatchQuery).MinimumNumberShouldMatch(1)
+	mustMatch := []elastic.Query{prefLabelMatchMustQuery, aliasesMatchMustQuery}
+	mustMatch = append(mustMatch, fields.clauses(clause(prefixMatchQuery, "prefLabel.exact_match"), clause(aliasesPrefixMatchQuery, "aliases.exact_match"))...)
+	mustQuery := elastic.NewBoolQuery().Should(mustMatch...).MinimumNumberShouldMatch(1)
 
 	exactMatchQuery := elastic.NewMatchQuery("prefLabel.edge_ngram", textQuery).Boost(4)
 	aliasesExactMatchShouldQuery := elastic.NewMatchQuery("aliases.edge_ngram", textQuery).Boost(6)
-	publicCompanyBoost := elastic.NewTermQuery("directType", util.PublicCompany).Boost(5)
-	organisationsBoost := elastic.NewTermQuery("type", "organisations").Boost(5)
-	shouldMatch := []elastic.Query{exactMatchQuery, publicCompanyBoost, organisationsBoost, aliasesExactMatchShouldQuery}
-
-	typeFilters := []elastic.Query{elastic.NewTermsQuery("type", util.ToTerms(esTypes)...)}
-	if isPublicCompanyType {
-		typeFilters = append(typeFilters, elastic.NewTermQuery("directType", util.PublicCompany))
-	}
-	typeFilterQuery := elastic.NewBoolQuery().Should(typeFilters...)
+	shouldMatch := fields.clauses(clause(exactMatchQuery, "prefLabel.edge_ngram"), clause(aliasesExactMatchShouldQuery, "aliases.edge_ngram"))
+	shouldMatch = append(shouldMatch, typeBoosts(util.ModeText)...)
 
 	mustNotMatch := []elastic.Query{}
 	// by default (include_deprecated is false) the deprecated entities are excluded
@@ -283,11 +471,11 @@ func (s *esConceptSearchService) searchConceptsForMultipleTypesInTextMode(textQu
 		mustNotMatch = append(mustNotMatch, elastic.NewTermQuery("isDeprecated", true)) // exclude deprecated docs
 	}
 
-	theQuery := elastic.NewBoolQuery().Must(mustQuery).Should(shouldMatch...).MustNot(mustNotMatch...).Filter(typeFilterQuery).MinimumNumberShouldMatch(0).Boost(1)
+	theQuery := elastic.NewBoolQuery().Must(mustQuery).Should(shouldMatch...).MustNot(mustNotMatch...).Filter(typeFilterQuery).Filter(directTypeFilters(directTypes)...).MinimumNumberShouldMatch(0).Boost(1)
 
-	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
-	search := s.esClient.Search(index).Size(s.maxAutoCompleteResults).MinScore(1).Query(theQuery).Explain(true)
-	result, err := search.SearchType("dfs_query_then_fetch").Do(context.Background())
+	// only the searches of the search mode are hedged, so that their latencies alone set the delay of the hedges
+	search := SearchRequest{Index: index, Source: elastic.NewSearchSource().Size(s.maxAutoCompleteResults).MinScore(1).Query(theQuery).Explain(true), SearchType: "dfs_query_then_fetch"}
+	result, err := s.doSearch(ctx, search)
 	if err != nil {
 		log.Errorf("error: %v", err)
 		return nil, err
@@ -300,6 +488,191 @@ func (s *esConceptSearchService) searchConceptsForMultipleTypesInTextMode(textQu
 	return concepts, nil
 }
 
+// conceptTypesFilter matches the concepts of any of the types, either through their ES type or their directType as
+// configured in the type registry. With includeSubtypes the concepts are matched on the ancestry in their types instead,
+// so that any ontology class matches its descendants too.
+func conceptTypesFilter(conceptTypes []string, includeSubtypes bool) (elastic.Query, error) {
+	if includeSubtypes {
+		if err := util.ValidateOntologyTypes(conceptTypes); err != nil {
+			return nil, err
+		}
+		return elastic.NewTermsQuery("types", util.ToTerms(conceptTypes)...), nil
+	}
+
+	esTypes, directTypes, err := util.ValidateAndConvertToEsTypes(conceptTypes)
+	if err != nil {
+		return nil, err
+	}
+	typeFilters := []elastic.Query{elastic.NewTermsQuery("type", util.ToTerms(esTypes)...)}
+	if len(directTypes) > 0 {
+		typeFilters = append(typeFilters, elastic.NewTermsQuery("directType", util.ToTerms(directTypes)...))
+	}
+	return elastic.NewBoolQuery().Should(typeFilters...), nil
+}
+
+// typeBoosts returns the boosts of the concept types configured for the search mode
+func typeBoosts(mode string) []elastic.Query {
+	var boosts []elastic.Query
+	for _, b := range util.TypeBoosts(mode) {
+		boosts = append(boosts, elastic.NewTermQuery(b.Field, b.Value).Boost(b.Boost))
+	}
+	return boosts
+}
+
+// SearchConceptsByTerm matches the term against the prefLabel and the aliases of the concepts, boosting exact matches
+func (s *esConceptSearchService) SearchConceptsByTerm(ctx context.Context, term string, searchAllAuthorities bool, includeDeprecated bool) ([]ScoredConcept, error) {
+	if err := s.checkElasticClient(); err != nil {
+		return nil, err
+	}
+
+	multiMatchQuery := elastic.NewMultiMatchQuery(term, "prefLabel", "aliases").Type("most_fields")
+	termQueryForPreflabelExactMatches := elastic.NewTermQuery("prefLabel.raw", term).Boost(2)
+	termQueryForAliasesExactMatches := elastic.NewTermQuery("aliases.raw", term).Boost(2)
+
+	index := s.getIndexForAuthoritiesParam(searchAllAuthorities)
+	fields := s.mappedFields(index)
+	theQuery := elastic.NewBoolQuery().Should(multiMatchQuery).Should(fields.clauses(
+		clause(termQueryForPreflabelExactMatches, "prefLabel.raw"),
+		clause(termQueryForAliasesExactMatches, "aliases.raw"),
+	)...)
+
+	// by default (include_deprecated is false) the deprecated entities are excluded
+	if !includeDeprecated {
+		theQuery = theQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+	}
+
+	result, err := s.doSearch(ctx, SearchRequest{Index: index, Source: elastic.NewSearchSource().Size(s.maxSearchResults).Query(theQuery)})
+	if err != nil {
+		log.Errorf("error: %v", err)
+		return nil, err
+	}
+	return searchResultToScoredConcepts(result), nil
+}
+
+// FindBestMatchingConcepts returns the best matching concepts for every term, ranked by their score, in a single multi
+// search request. Terms without any match scoring at least the minimum score are not found, and the failure of the
+// search of a single term is reported in its outcome rather than failing the whole request.
+func (s *esConceptSearchService) FindBestMatchingConcepts(ctx context.Context, criteria BestMatchCriteria) (map[string]BestMatch, error) {
+	limit := criteria.Limit
+	if limit == 0 {
+		limit = 1
+	}
+	if limit < 0 || limit > s.maxSearchResults {
+		return nil, util.NewInputErrorf(util.ErrCodeInvalidParameter, "bestMatchLimit", "bestMatchLimit must be between 1 and %d", s.maxSearchResults)
+	}
+	if criteria.MinScore < 0 {
+		return nil, util.NewInputError(util.ErrCodeInvalidParameter, "minScore", "minScore must not be negative")
+	}
+
+	filters, shouldMatch, err := bestMatchClauses(criteria)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkElasticClient(); err != nil {
+		return nil, err
+	}
+
+	sources := make([]*elastic.SearchSource, 0, len(criteria.Terms))
+	for _, term := range criteria.Terms {
+		theQuery := elastic.NewBoolQuery().
+			Must(elastic.NewMatchQuery("aliases", term).Operator("and")).
+			Should(shouldMatch...).
+			Filter(filters...)
+		// by default (include_deprecated is false) the deprecated entities are excluded
+		if !criteria.IncludeDeprecated {
+			theQuery = theQuery.MustNot(elastic.NewTermQuery("isDeprecated", true))
+		}
+		ss := elastic.NewSearchSource().Size(limit).Query(theQuery)
+		if criteria.MinScore > 0 {
+			ss = ss.MinScore(criteria.MinScore)
+		}
+		sources = append(sources, ss)
+	}
+
+	index := s.getIndexForAuthoritiesParam(criteria.SearchAllAuthorities)
+	result, err := s.doMultiSearch(ctx, index, sources)
+	if err != nil {
+		log.Errorf("error: %v", err)
+		return nil, err
+	}
+	if len(result.Responses) != len(criteria.Terms) {
+		return nil, fmt.Errorf("expected %d responses from elasticsearch, got %d", len(criteria.Terms), len(result.Responses))
+	}
+
+	bestMatches := make(map[string]BestMatch, len(criteria.Terms))
+	for i, response := range result.Responses {
+		term := criteria.Terms[i]
+		if response.Error != nil || response.Hits == nil {
+			err := fmt.Errorf("failed to search for best match of term %q", term)
+			if response.Error != nil {
+				err = fmt.Errorf("%w: %s: %s", err, response.Error.Type, response.Error.Reason)
+			}
+			log.WithError(err).Warn("best match search failed")
+			bestMatches[term] = BestMatch{Status: BestMatchError, Concepts: []ScoredConcept{}, Err: err}
+			continue
+		}
+		matches := searchResultToScoredConcepts(response)
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+		status := BestMatchFound
+		if len(matches) == 0 {
+			status = BestMatchNotFound
+		}
+		bestMatches[term] = BestMatch{Status: status, Concepts: matches}
+	}
+	return bestMatches, nil
+}
+
+// bestMatchClauses validates the options of the best match search and returns the filter and should clauses for them
+func bestMatchClauses(criteria BestMatchCriteria) ([]elastic.Query, []elastic.Query, error) {
+	var filters, shouldMatch []elastic.Query
+	if criteria.BoostType != "" {
+		if err := validateAuthorsOption(criteria.BoostType, criteria.ConceptTypes); err != nil {
+			return nil, nil, err
+		}
+		shouldMatch = append(shouldMatch, elastic.NewTermQuery("isFTAuthor", "true").Boost(1.8))
+	}
+	if criteria.FilterType != "" {
+		if err := validateAuthorsOption(criteria.FilterType, criteria.ConceptTypes); err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, elastic.NewTermQuery("isFTAuthor", "true"))
+	}
+	if len(criteria.ConceptTypes) > 0 {
+		esTypes, _, err := util.ValidateAndConvertToEsTypes(criteria.ConceptTypes)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, elastic.NewTermsQuery("type", util.ToTerms(esTypes)...))
+	}
+	return filters, shouldMatch, nil
+}
+
+// validateAuthorsOption checks a boost or filter option, of which "authors" is the only supported value
+func validateAuthorsOption(option string, conceptTypes []string) error {
+	if option != "authors" {
+		return util.ErrInvalidBoostTypeParameter
+	}
+	return util.ValidateForAuthorsSearch(conceptTypes, option)
+}
+
+func searchResultToScoredConcepts(result *elastic.SearchResult) []ScoredConcept {
+	concepts := []ScoredConcept{}
+	for _, hit := range result.Hits.Hits {
+		concept := ScoredConcept{}
+		if err := json.Unmarshal(hit.Source, &concept.EsConceptModel); err != nil {
+			log.Warnf("unmarshallable response from ElasticSearch: %v", err)
+			continue
+		}
+		if hit.Score != nil {
+			concept.Score = *hit.Score
+		}
+		concepts = append(concepts, concept)
+	}
+	return concepts
+}
+
 func containsOnlyEmptyValues(ids []string) bool {
 	for _, v := range ids {
 		if v != "" {
@@ -322,24 +695,81 @@ func (s *esConceptSearchService) validateSearchQueryInput(textQuery string, conc
 	return nil
 }
 
+// SetElasticClient queries the cluster through the client with the backend of the service
 func (s *esConceptSearchService) SetElasticClient(client *elastic.Client) {
 	s.clientLock.Lock()
-	defer s.clientLock.Unlock()
-	s.esClient = client
+	if client == nil {
+		s.backend = nil
+	} else {
+		s.backend = s.backendKind.New(client)
+	}
+	s.clientLock.Unlock()
+	s.requestMappingRefresh()
+}
+
+// SetBackend selects the backend the cluster is queried with, Elasticsearch by default, it must be set before the client
+func (s *esConceptSearchService) SetBackend(kind BackendKind) {
+	s.backendKind = kind
+}
+
+// SetCircuitBreaker makes the calls to ES go through the breaker, it is not set by default and must be set before the client
+func (s *esConceptSearchService) SetCircuitBreaker(breaker *CircuitBreaker) {
+	s.breaker = breaker
+}
+
+// doSearch runs the search through the circuit breaker
+func (s *esConceptSearchService) doSearch(ctx context.Context, search SearchRequest) (*elastic.SearchResult, error) {
+	done, err := s.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.searchBackend().Search(ctx, search)
+	done(err)
+	return result, err
+}
+
+// SetHedger hedges the searches of the search mode, they are not hedged by default and it must be set before the client
+func (s *esConceptSearchService) SetHedger(hedger *Hedger) {
+	s.hedger = hedger
+}
+
+// doHedgedSearch runs the search with the dfs_query_then_fetch search type through the hedger, each of its attempts
+// going through the circuit breaker
+func (s *esConceptSearchService) doHedgedSearch(ctx context.Context, search SearchRequest) (*elastic.SearchResult, error) {
+	search.SearchType = "dfs_query_then_fetch"
+	return s.hedger.Search(ctx, func(ctx context.Context) (*elastic.SearchResult, error) {
+		return s.doSearch(ctx, search)
+	})
+}
+
+// doMultiSearch runs the searches of the index in a single request through the circuit breaker
+func (s *esConceptSearchService) doMultiSearch(ctx context.Context, index string, sources []*elastic.SearchSource) (*elastic.MultiSearchResult, error) {
+	requests := make([]SearchRequest, 0, len(sources))
+	for _, source := range sources {
+		requests = append(requests, SearchRequest{Index: index, Source: source})
+	}
+	done, err := s.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.searchBackend().MultiSearch(ctx, requests)
+	done(err)
+	return result, err
 }
 
-func (s *esConceptSearchService) elasticClient() *elastic.Client {
+func (s *esConceptSearchService) searchBackend() Backend {
 	s.clientLock.RLock()
 	defer s.clientLock.RUnlock()
-	return s.esClient
+	return s.backend
 }
 
 func (s *esConceptSearchService) getIndexForAuthoritiesParam(searchAllAuthorities bool) string {
+	indices := s.IndexTargets()
 	if searchAllAuthorities {
-		return s.extendedSearchIndex
+		return indices.ExtendedSearchIndex
 	}
 
-	return s.defaultIndex
+	return indices.DefaultIndex
 }
 
 func sortConcepts(c Concepts) {
@@ -44,17 +44,18 @@ const (
 func TestNoElasticClient(t *testing.T) {
 	service := NewEsConceptSearchService("test", "", 50, 10, 10)
 
-	_, err := service.FindAllConceptsByType(ftGenreType, false, true)
+	_, err := service.FindAllConceptsByType(context.Background(), ftGenreType, false, true, false, nil)
 	assert.EqualError(t, err, util.ErrNoElasticClient.Error(), "error response")
 
-	_, err = service.SearchConceptByTextAndTypes("lucy", []string{ftBrandType}, false, true)
+	_, err = service.SearchConceptByTextAndTypes(context.Background(), "lucy", []string{ftBrandType}, false, true, false, nil)
 	assert.EqualError(t, err, util.ErrNoElasticClient.Error(), "error response")
 }
 
 type EsConceptSearchServiceTestSuite struct {
 	suite.Suite
-	esURL string
-	ec    *elastic.Client
+	esURL   string
+	ec      *elastic.Client
+	backend BackendKind
 }
 
 func TestEsConceptSearchServiceSuite(t *testing.T) {
@@ -63,6 +64,9 @@ func TestEsConceptSearchServiceSuite(t *testing.T) {
 
 func (s *EsConceptSearchServiceTestSuite) SetupSuite() {
 	s.esURL = getElasticSearchTestURL(s.T())
+	backend, err := ParseBackendKind(getSearchTestBackend())
+	require.NoError(s.T(), err, "expected a known search backend")
+	s.backend = backend
 
 	ec, err := elastic.NewClient(
 		elastic.SetURL(s.esURL),
@@ -103,6 +107,21 @@ func (s *EsConceptSearchServiceTestSuite) TearDownSuite() {
 	s.ec.DeleteIndex(testExtendedIndex).Do(context.Background())
 }
 
+// setClient makes the service query the test cluster with the backend of the suite
+func (s *EsConceptSearchServiceTestSuite) setClient(service ConceptSearchService) {
+	service.SetBackend(s.backend)
+	service.SetElasticClient(s.ec)
+}
+
+// getSearchTestBackend is the backend the suite runs with, so that it can be run against OpenSearch as well
+func getSearchTestBackend() string {
+	backend := os.Getenv("SEARCH_TEST_BACKEND")
+	if strings.TrimSpace(backend) == "" {
+		return string(Elasticsearch)
+	}
+	return backend
+}
+
 func getElasticSearchTestURL(t *testing.T) string {
 	if testing.Short() {
 		t.Skip("ElasticSearch integration for long tests only.")
@@ -306,11 +325,23 @@ func writeTestConceptModel(ec *elastic.Client, model EsConceptModel) error {
 	return nil
 }
 
+func (s *EsConceptSearchServiceTestSuite) TestMappingIsCompatibleWithTheQueries() {
+	service := NewEsConceptSearchService(testDefaultIndex, testExtendedIndex, 10, 10, 10).(*esConceptSearchService)
+	s.setClient(service)
+
+	service.refreshMappings()
+
+	status := service.MappingStatus()
+	assert.False(s.T(), status.Checked.IsZero(), "the mapping should be checked")
+	assert.Empty(s.T(), status.Error)
+	assert.Empty(s.T(), status.Problems, "the test mapping should have all the fields the queries depend on")
+}
+
 func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByType() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.FindAllConceptsByType(ftGenreType, false, true)
+	concepts, err := service.FindAllConceptsByType(context.Background(), ftGenreType, false, true, false, nil)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 4, "there should be four genres")
@@ -327,8 +358,8 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByType() {
 
 func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeResultSize() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 3, 10, 10)
-	service.SetElasticClient(s.ec)
-	concepts, err := service.FindAllConceptsByType(ftGenreType, false, true)
+	s.setClient(service)
+	concepts, err := service.FindAllConceptsByType(context.Background(), ftGenreType, false, true, false, nil)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 3, "there should be three genres")
@@ -345,16 +376,16 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeResultSize()
 
 func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeInvalid() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.FindAllConceptsByType("http://www.ft.com/ontology/Foo", false, true)
+	_, err := service.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/Foo", false, true, false, nil)
 
 	assert.EqualError(s.T(), err, fmt.Sprintf(util.ErrInvalidConceptTypeFormat, "http://www.ft.com/ontology/Foo"), "expected error")
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeDeprecatedFlag() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid := uuid.New().String()
 	prefLabel := "Rick and Morty"
@@ -373,7 +404,7 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeDeprecatedFla
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	conceptsWithoutDeprecated, err := service.FindAllConceptsByType("http://www.ft.com/ontology/person/Person", false, false)
+	conceptsWithoutDeprecated, err := service.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/person/Person", false, false, false, nil)
 	assert.NoError(s.T(), err, "no error expected")
 
 	for _, concept := range conceptsWithoutDeprecated {
@@ -381,7 +412,7 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeDeprecatedFla
 		assert.False(s.T(), concept.IsDeprecated)
 	}
 
-	conceptsWithDeprecated, err := service.FindAllConceptsByType("http://www.ft.com/ontology/person/Person", false, true)
+	conceptsWithDeprecated, err := service.FindAllConceptsByType(context.Background(), "http://www.ft.com/ontology/person/Person", false, true, false, nil)
 	assert.NoError(s.T(), err, "no error expected")
 
 	deprecatedConceptsFound := 0
@@ -398,11 +429,11 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeDeprecatedFla
 	cleanup(s.T(), s.ec, uuid)
 }
 
-func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByDirectType() {
+func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeMatchedOnDirectType() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.FindAllConceptsByDirectType(ftPublicCompanies, false, false)
+	concepts, err := service.FindAllConceptsByType(context.Background(), ftPublicCompanies, false, false, false, nil)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 4, "there should be four public companies")
@@ -417,11 +448,103 @@ func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByDirectType() {
 	}
 }
 
+func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeIncludingSubtypes() {
+	companyType := "http://www.ft.com/ontology/company/Company"
+	ancestry := []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", ftOrganisationType, companyType}
+	privateUUID := uuid.New().String()
+	publicUUID := uuid.New().String()
+	concepts := []EsConceptModel{
+		{Id: privateUUID, Type: esOrganisationType, ApiUrl: "http://api.ft.com/organisations/" + privateUUID, PrefLabel: "Subtypes Private Co", DirectType: "http://www.ft.com/ontology/company/PrivateCompany", Types: append(ancestry, "http://www.ft.com/ontology/company/PrivateCompany")},
+		{Id: publicUUID, Type: esOrganisationType, ApiUrl: "http://api.ft.com/organisations/" + publicUUID, PrefLabel: "Subtypes Public Co", DirectType: ftPublicCompanies, Types: append(ancestry, ftPublicCompanies)},
+	}
+	for _, c := range concepts {
+		require.NoError(s.T(), writeTestConceptModel(s.ec, c))
+	}
+	defer cleanup(s.T(), s.ec, privateUUID, publicUUID)
+	_, err := s.ec.Refresh(testDefaultIndex).Do(context.Background())
+	require.NoError(s.T(), err)
+
+	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
+	s.setClient(service)
+
+	found, err := service.FindAllConceptsByType(context.Background(), companyType, false, false, true, nil)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), found, 2, "both companies should be found through their ancestry")
+	assert.Equal(s.T(), "Subtypes Private Co", found[0].PrefLabel)
+	assert.Equal(s.T(), "Subtypes Public Co", found[1].PrefLabel)
+
+	_, err = service.FindAllConceptsByType(context.Background(), companyType, false, false, false, nil)
+	assert.Error(s.T(), err, "Company is not in the type registry")
+
+	found, err = service.SearchConceptByTextAndTypes(context.Background(), "Subtypes", []string{companyType}, false, false, true, nil)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), found, 2)
+
+	_, err = service.FindAllConceptsByType(context.Background(), "Company", false, false, true, nil)
+	assert.Error(s.T(), err, "not an ontology class")
+}
+
+func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypes() {
+	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
+	s.setClient(service)
+
+	groups, err := service.FindAllConceptsByTypes(context.Background(), []string{ftGenreType, ftPublicCompanies}, false, true, false, nil, nil)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), groups, 2)
+
+	assert.Equal(s.T(), ftGenreType, groups[0].Type)
+	assert.Len(s.T(), groups[0].Concepts, 4, "there should be four genres")
+	assert.Equal(s.T(), int64(4), groups[0].Total)
+	for _, c := range groups[0].Concepts {
+		assert.Equal(s.T(), ftGenreType, c.ConceptType)
+	}
+	assert.Equal(s.T(), ftPublicCompanies, groups[1].Type)
+	assert.Len(s.T(), groups[1].Concepts, 4, "there should be four public companies")
+	for _, c := range groups[1].Concepts {
+		assert.Equal(s.T(), ftPublicCompanies, c.ConceptType)
+	}
+}
+
+func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypesPages() {
+	service := NewEsConceptSearchService(testDefaultIndex, "", 3, 10, 10)
+	s.setClient(service)
+	types := []string{ftGenreType, ftPublicCompanies}
+
+	first, err := service.FindAllConceptsByTypes(context.Background(), types, false, true, false, nil, nil)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), first, 2)
+	require.Len(s.T(), first[0].Concepts, 3)
+	require.NotEmpty(s.T(), first[0].Next, "the first page of the genres is full")
+
+	second, err := service.FindAllConceptsByTypes(context.Background(), types, false, true, false, nil, []string{first[0].Next})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), second, 2)
+	require.Len(s.T(), second[0].Concepts, 1, "there should be one more genre")
+	assert.Empty(s.T(), second[0].Next)
+	assert.NotContains(s.T(), first[0].Concepts, second[0].Concepts[0])
+	assert.Equal(s.T(), first[1].Concepts, second[1].Concepts, "the public companies should be listed from their first page")
+}
+
+func (s *EsConceptSearchServiceTestSuite) TestFindAllConceptsByTypeWithDirectType() {
+	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
+	s.setClient(service)
+
+	concepts, err := service.FindAllConceptsByType(context.Background(), ftOrganisationType, false, false, false, []string{ftPublicCompanies})
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), concepts, 4, "there should be four public companies")
+	for _, c := range concepts {
+		assert.Equal(s.T(), ftPublicCompanies, c.ConceptType)
+	}
+
+	_, err = service.FindAllConceptsByType(context.Background(), ftOrganisationType, false, false, false, []string{"http://www.ft.com/ontology/company/Foo"})
+	assert.Error(s.T(), err, "there are no concepts of this direct type")
+}
+
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypes("test", []string{ftPeopleType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "test", []string{ftPeopleType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 8)
 
@@ -432,9 +555,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypes() {
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipleTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypes("test", []string{ftBrandType, ftAlphavilleSeriesType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "test", []string{ftBrandType, ftAlphavilleSeriesType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 5)
 
@@ -445,9 +568,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipl
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesPublicCompanies() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypes("test", []string{ftPublicCompanies}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "test", []string{ftPublicCompanies}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 4)
 
@@ -458,9 +581,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesPublicC
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipleTypesWithPublicCompanies() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypes("test", []string{ftBrandType, ftPublicCompanies}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "test", []string{ftBrandType, ftPublicCompanies}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 8)
 
@@ -471,9 +594,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipl
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesNoText() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.SearchConceptByTextAndTypes("", []string{ftPeopleType}, false, true)
+	_, err := service.SearchConceptByTextAndTypes(context.Background(), "", []string{ftPeopleType}, false, true, false, nil)
 	assert.EqualError(s.T(), err, errEmptyTextParameter.Error())
 }
 
@@ -485,9 +608,9 @@ func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsSingle() {
 	require.NoError(s.T(), err)
 
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.FindConceptsById([]string{uuid1})
+	concepts, err := service.FindConceptsById(context.Background(), []string{uuid1}, false)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 1, "there should be one concept")
@@ -509,11 +632,11 @@ func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsMultiple() {
 	require.NoError(s.T(), err)
 
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	testIds := []string{uuid1, uuid2}
 
-	concepts, err := service.FindConceptsById(testIds)
+	concepts, err := service.FindConceptsById(context.Background(), testIds, false)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 2, "there should be two concepts")
@@ -527,11 +650,50 @@ func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsMultiple() {
 	cleanup(s.T(), s.ec, uuid2)
 }
 
+func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsFollowingReplacements() {
+	deprecatedUUID := uuid.New().String()
+	intermediateUUID := uuid.New().String()
+	liveUUID := uuid.New().String()
+	orphanUUID := uuid.New().String()
+	concepts := []EsConceptModel{
+		{Id: deprecatedUUID, ApiUrl: "http://api.ft.com/organisations/" + deprecatedUUID, PrefLabel: "Old Org", DirectType: ftOrganisationType, Types: []string{ftOrganisationType}, IsDeprecated: true, ReplacedBy: "http://api.ft.com/things/" + intermediateUUID},
+		{Id: intermediateUUID, ApiUrl: "http://api.ft.com/organisations/" + intermediateUUID, PrefLabel: "Renamed Org", DirectType: ftOrganisationType, Types: []string{ftOrganisationType}, IsDeprecated: true, ReplacedBy: "http://api.ft.com/things/" + liveUUID},
+		{Id: liveUUID, ApiUrl: "http://api.ft.com/organisations/" + liveUUID, PrefLabel: "New Org", DirectType: ftOrganisationType, Types: []string{ftOrganisationType}},
+		{Id: orphanUUID, ApiUrl: "http://api.ft.com/organisations/" + orphanUUID, PrefLabel: "Orphan Org", DirectType: ftOrganisationType, Types: []string{ftOrganisationType}, IsDeprecated: true, ReplacedBy: "http://api.ft.com/things/" + uuid.New().String()},
+	}
+	for _, c := range concepts {
+		require.NoError(s.T(), writeTestConceptModel(s.ec, c))
+	}
+	defer cleanup(s.T(), s.ec, deprecatedUUID, intermediateUUID, liveUUID, orphanUUID)
+	_, err := s.ec.Refresh(testDefaultIndex).Do(context.Background())
+	require.NoError(s.T(), err)
+
+	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
+	s.setClient(service)
+
+	found, err := service.FindConceptsById(context.Background(), []string{deprecatedUUID, liveUUID, orphanUUID}, true)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), found, 2, "the deprecated concept should be replaced by the live one, which was asked for as well")
+	byId := map[string]Concept{}
+	for _, c := range found {
+		byId[c.UUID] = c
+	}
+	assert.Equal(s.T(), "New Org", byId[liveUUID].PrefLabel)
+	assert.False(s.T(), byId[liveUUID].IsDeprecated)
+	assert.True(s.T(), byId[orphanUUID].IsDeprecated, "a concept whose replacement is missing should be kept")
+	assert.NotEmpty(s.T(), byId[orphanUUID].ReplacedBy)
+
+	found, err = service.FindConceptsById(context.Background(), []string{deprecatedUUID}, false)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), found, 1)
+	assert.Equal(s.T(), "http://www.ft.com/thing/"+intermediateUUID, found[0].ReplacedBy)
+}
+
 func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsSingleInvalidUUID() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.FindConceptsById([]string{"uuid1"})
+	concepts, err := service.FindConceptsById(context.Background(), []string{"uuid1"}, false)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 0, "there should be no concepts")
@@ -550,11 +712,11 @@ func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsMultipleMixValidI
 	require.NoError(s.T(), err)
 
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	testIds := []string{uuid1, "xxx", uuid2, "zzzz"}
 
-	concepts, err := service.FindConceptsById(testIds)
+	concepts, err := service.FindConceptsById(context.Background(), testIds, false)
 
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 2, "there should be two concepts")
@@ -571,55 +733,55 @@ func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsMultipleMixValidI
 
 func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsEmptyStringValue() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.FindConceptsById([]string{""})
+	_, err := service.FindConceptsById(context.Background(), []string{""}, false)
 	assert.EqualError(s.T(), err, errEmptyIdsParameter.Error())
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsEmptySlice() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.FindConceptsById([]string{})
+	_, err := service.FindConceptsById(context.Background(), []string{}, false)
 	assert.EqualError(s.T(), err, errEmptyIdsParameter.Error())
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsNilSlice() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.FindConceptsById(nil)
+	_, err := service.FindConceptsById(context.Background(), nil, false)
 	assert.EqualError(s.T(), err, errEmptyIdsParameter.Error())
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestFindConceptsByIdsMaxIdsLimit() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 2, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.FindConceptsById([]string{"uuid1", "uuid2", "uuids3"})
+	_, err := service.FindConceptsById(context.Background(), []string{"uuid1", "uuid2", "uuids3"}, false)
 	assert.EqualError(s.T(), err, fmt.Sprintf(util.ErrMaxIdsLimitFormat, 3, 2))
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesNoConceptTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.SearchConceptByTextAndTypes("pippo", []string{}, false, true)
+	_, err := service.SearchConceptByTextAndTypes(context.Background(), "pippo", []string{}, false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrNoConceptTypeParameter.Error())
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInvalidConceptType() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	_, err := service.SearchConceptByTextAndTypes("pippo", []string{"http://www.ft.com/ontology/Foo"}, false, true)
+	_, err := service.SearchConceptByTextAndTypes(context.Background(), "pippo", []string{"http://www.ft.com/ontology/Foo"}, false, true, false, nil)
 	assert.EqualError(s.T(), err, fmt.Sprintf(util.ErrInvalidConceptTypeFormat, "http://www.ft.com/ontology/Foo"))
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesTermMatchBoosted() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esPeopleType, ftPeopleType, "Donaldo Trump", []string{}, nil)
@@ -632,7 +794,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesTermMat
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("donald trump", []string{ftPeopleType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "donald trump", []string{ftPeopleType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 2)
 
@@ -646,7 +808,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesTermMat
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMatchBoosted() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "New York", []string{}, nil)
@@ -659,7 +821,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMa
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("new york", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "new york", []string{ftLocationType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 2)
 
@@ -673,7 +835,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMa
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMatchBoostedWithScopeNotePresent() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "New York", []string{}, nil)
@@ -686,7 +848,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMa
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("new yor", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "new yor", []string{ftLocationType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 2)
 
@@ -700,7 +862,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesExactMa
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesDeprecated() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "New York", []string{}, nil)
@@ -722,7 +884,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesDepreca
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("new york", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "new york", []string{ftLocationType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 2)
 
@@ -732,7 +894,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesDepreca
 	assert.Equal(s.T(), "New York", nyc.PrefLabel, "Failure could indicate that the wrong concept had the higher boost")
 	assert.Equal(s.T(), "New York Deprecated", nycDeprecated.PrefLabel, "Failure could indicate that the wrong concept had the higher boost")
 
-	concepts, err = service.SearchConceptByTextAndTypes("new york", []string{ftLocationType}, false, false)
+	concepts, err = service.SearchConceptByTextAndTypes(context.Background(), "new york", []string{ftLocationType}, false, false, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 1)
 
@@ -745,7 +907,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesDepreca
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAuthorsBoost() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esPeopleType, ftPeopleType, "Roberto Shrimpley", []string{}, nil)
@@ -762,7 +924,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAut
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("robert shrimpley", []string{ftPeopleType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "robert shrimpley", []string{ftPeopleType}, "authors", false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 3)
 
@@ -779,7 +941,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAut
 // If 4 concepts are equivalent, then the type boosts should order them as expected.
 func (s *EsConceptSearchServiceTestSuite) TestSearch__SpecificTypesAreBoosted() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esPeopleType, ftPeopleType, "Fannie Mae", []string{}, nil)
@@ -800,7 +962,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearch__SpecificTypesAreBoosted()
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("Fannie Mae", []string{ftPeopleType, ftTopicType, ftLocationType, ftOrganisationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "Fannie Mae", []string{ftPeopleType, ftTopicType, ftLocationType, ftOrganisationType}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 4)
 
@@ -822,7 +984,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearch__SpecificTypesAreBoosted()
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAuthorsBoostAndDeprecated() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esPeopleType, ftPeopleType, "Roberto Shrimpley", []string{}, nil)
@@ -854,7 +1016,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAut
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	conceptsWithDeprecated, err := service.SearchConceptByTextAndTypesWithBoost("robert shrimple", []string{ftPeopleType}, "authors", false, true)
+	conceptsWithDeprecated, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "robert shrimple", []string{ftPeopleType}, "authors", false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), conceptsWithDeprecated, 4)
 
@@ -868,7 +1030,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAut
 	assert.Equal(s.T(), "Robert Real Shrimpley", theRealEditor.PrefLabel)
 	assert.Equal(s.T(), "Roberto Shrimpley", theFake.PrefLabel)
 
-	conceptsWithoutDeprecated, err := service.SearchConceptByTextAndTypesWithBoost("robert shrimpley", []string{ftPeopleType}, "authors", false, false)
+	conceptsWithoutDeprecated, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "robert shrimpley", []string{ftPeopleType}, "authors", false, false, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), conceptsWithoutDeprecated, 3)
 
@@ -885,7 +1047,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithAut
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByExactMatchAliases() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"USA"}, nil)
@@ -898,7 +1060,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByExactMatchAliases(
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("USA", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "USA", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -912,45 +1074,45 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByExactMatchAliases(
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostRestrictedSize() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 1)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{ftPeopleType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{ftPeopleType}, "authors", false, true, false, nil)
 	assert.NoError(s.T(), err, "expected no error for ES read")
 	assert.Len(s.T(), concepts, 1, "there should be one results")
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostNoInputText() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("", []string{ftPeopleType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "", []string{ftPeopleType}, "authors", false, true, false, nil)
 	assert.EqualError(s.T(), err, errEmptyTextParameter.Error())
 	assert.Nil(s.T(), concepts)
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostNoTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{}, "authors", false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrNoConceptTypeParameter.Error())
 	assert.Nil(s.T(), concepts)
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostMultipleTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{ftPeopleType, ftLocationType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{ftPeopleType, ftLocationType}, "authors", false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrNotSupportedCombinationOfConceptTypes.Error())
 	assert.Nil(s.T(), concepts)
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithInvalidBoost() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{ftPeopleType}, "pluto", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{ftPeopleType}, "pluto", false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrInvalidBoostTypeParameter.Error())
 	assert.Nil(s.T(), concepts)
 }
@@ -958,7 +1120,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithInv
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostNoESConnection() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{ftPeopleType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{ftPeopleType}, "authors", false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrNoElasticClient.Error())
 	assert.Nil(s.T(), concepts)
 }
@@ -966,7 +1128,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoo
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoostInvalidConceptType() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
 
-	concepts, err := service.SearchConceptByTextAndTypesWithBoost("test", []string{ftGenreType}, "authors", false, true)
+	concepts, err := service.SearchConceptByTextAndTypesWithBoost(context.Background(), "test", []string{ftGenreType}, "authors", false, true, false, nil)
 	assert.EqualError(s.T(), err, fmt.Sprintf(util.ErrInvalidConceptTypeFormat, ftGenreType))
 	assert.Nil(s.T(), concepts)
 }
@@ -974,23 +1136,23 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesWithBoo
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextModeNoInputText() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
 
-	concepts, err := service.SearchConceptByTextAndTypesInTextMode("", []string{ftOrganisationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypesInTextMode(context.Background(), "", []string{ftOrganisationType}, false, true, false, nil)
 	assert.EqualError(s.T(), err, errEmptyTextParameter.Error())
 	assert.Nil(s.T(), concepts)
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextModeNoTypes() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesInTextMode("test", []string{}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypesInTextMode(context.Background(), "test", []string{}, false, true, false, nil)
 	assert.EqualError(s.T(), err, util.ErrNoConceptTypeParameter.Error())
 	assert.Nil(s.T(), concepts)
 }
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextMode() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esOrganisationType, ftOrganisationType, "Google Inc", []string{"Google LLC"}, &ConceptMetrics{PrevWeekAnnotationsCount: 0, AnnotationsCount: 0}) // In text mode the annotations count is irrelevant
@@ -1007,7 +1169,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextM
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypesInTextMode("Google", []string{ftOrganisationType}, false, false)
+	concepts, err := service.SearchConceptByTextAndTypesInTextMode(context.Background(), "Google", []string{ftOrganisationType}, false, false, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1021,9 +1183,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextM
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextModePublicCompanies() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesInTextMode("test", []string{ftPublicCompanies}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypesInTextMode(context.Background(), "test", []string{ftPublicCompanies}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 4)
 
@@ -1034,9 +1196,9 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesInTextM
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipleTypesInTextModeWithPublicCompanies() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
-	concepts, err := service.SearchConceptByTextAndTypesInTextMode("test", []string{ftBrandType, ftPublicCompanies}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypesInTextMode(context.Background(), "test", []string{ftBrandType, ftPublicCompanies}, false, true, false, nil)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), concepts, 8)
 
@@ -1047,7 +1209,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptByTextAndTypesMultipl
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularity() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"USA"}, &ConceptMetrics{AnnotationsCount: 15000})
@@ -1060,7 +1222,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularity() {
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("USA", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "USA", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1074,7 +1236,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularity() {
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularityAliasMatch() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "Luca Panziera", []string{"Dr Git"}, &ConceptMetrics{AnnotationsCount: 15000})
@@ -1087,7 +1249,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularityAliasMat
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("Dr G", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "Dr G", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1101,7 +1263,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByPopularityAliasMat
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularitySameAnnotationsCount() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"USA"}, &ConceptMetrics{PrevWeekAnnotationsCount: 7, AnnotationsCount: 10})
@@ -1114,7 +1276,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularitySa
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("USA", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "USA", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1128,7 +1290,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularitySa
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularityNoRecentAnnotations() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"USA"}, &ConceptMetrics{PrevWeekAnnotationsCount: 0, AnnotationsCount: 100})
@@ -1141,7 +1303,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularityNo
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("USA", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "USA", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1155,7 +1317,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularityNo
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularity() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"USA"}, &ConceptMetrics{PrevWeekAnnotationsCount: 10, AnnotationsCount: 1000})
@@ -1168,7 +1330,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularity()
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("USA", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "USA", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 2)
 
@@ -1182,7 +1344,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByRecentPopularity()
 
 func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByAliasPartialMatch() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid1 := uuid.New().String()
 	err := writeTestConcept(s.ec, uuid1, esLocationType, ftLocationType, "United States of America", []string{"Franklin D Roosevelt"}, &ConceptMetrics{AnnotationsCount: 0})
@@ -1195,7 +1357,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByAliasPartialMatch(
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("roose", []string{ftLocationType}, false, true)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "roose", []string{ftLocationType}, false, true, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 1)
 
@@ -1207,7 +1369,7 @@ func (s *EsConceptSearchServiceTestSuite) TestSearchConceptsByAliasPartialMatch(
 
 func (s *EsConceptSearchServiceTestSuite) TestFindOrganisationWithCountryCodeAndCountryOfIncorporation() {
 	service := NewEsConceptSearchService(testDefaultIndex, "", 10, 10, 10)
-	service.SetElasticClient(s.ec)
+	s.setClient(service)
 
 	uuid := uuid.New().String()
 	err := writeTestConceptWithCountryCodeAndCountryOfIncorporation(s.ec, uuid, esOrganisationType, ftOrganisationType, "MooTech Ltd.", []string{"MooTech Ltd."}, "CA", "US")
@@ -1216,7 +1378,7 @@ func (s *EsConceptSearchServiceTestSuite) TestFindOrganisationWithCountryCodeAnd
 	_, err = s.ec.Refresh(testDefaultIndex).Do(context.Background())
 	require.NoError(s.T(), err)
 
-	concepts, err := service.SearchConceptByTextAndTypes("Moo", []string{ftOrganisationType}, false, false)
+	concepts, err := service.SearchConceptByTextAndTypes(context.Background(), "Moo", []string{ftOrganisationType}, false, false, false, nil)
 	require.NoError(s.T(), err)
 	require.Len(s.T(), concepts, 1)
 
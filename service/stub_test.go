@@ -0,0 +1,31 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/require"
+)
+
+// newStubbedClient returns a client of an Elasticsearch stubbed by the handler, which is served until the end of the test
+func newStubbedClient(t *testing.T, handler http.Handler) *elastic.Client {
+	es := httptest.NewServer(handler)
+	t.Cleanup(es.Close)
+	ec, err := elastic.NewClient(elastic.SetURL(es.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	require.NoError(t, err)
+	return ec
+}
+
+// newStubbedService returns a service of the concepts and all-concepts indices of an Elasticsearch stubbed by the
+// handler. The options set up the service before it is given its client.
+func newStubbedService(t *testing.T, handler http.Handler, options ...func(*esConceptSearchService)) *esConceptSearchService {
+	ec := newStubbedClient(t, handler)
+	s := NewEsConceptSearchService("concepts", "all-concepts", 50, 10, 10).(*esConceptSearchService)
+	for _, option := range options {
+		option(s)
+	}
+	s.SetElasticClient(ec)
+	return s
+}
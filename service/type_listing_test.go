@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/concept-search-api/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTypeListingESStub answers every search of a multi search request with the response for the ES type it filters on,
+// keeping the searches by ES type if searches is not nil
+func newTypeListingESStub(t *testing.T, responses map[string]string, searches map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasSuffix(r.URL.Path, "/_msearch"), "unexpected request %v", r.URL.Path)
+
+		var bodies []string
+		scanner := bufio.NewScanner(r.Body)
+		for line := 0; scanner.Scan(); line++ {
+			if line%2 == 0 {
+				continue // header
+			}
+			for esType, response := range responses {
+				if strings.Contains(scanner.Text(), fmt.Sprintf(`{"term":{"type":"%s"}}`, esType)) {
+					bodies = append(bodies, response)
+					if searches != nil {
+						searches[esType] = scanner.Text()
+					}
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"responses":[%s]}`, strings.Join(bodies, ","))
+	})
+}
+
+func typeListingHits(total int, prefLabels ...string) string {
+	var hits []string
+	for i, label := range prefLabels {
+		hits = append(hits, fmt.Sprintf(`{"_id":"%[1]d","_source":{"id":"http://api.ft.com/things/00000000-0000-0000-0000-%012[1]d","prefLabel":"%[2]s"},"sort":["%[2]s","%[1]d"]}`, i, label))
+	}
+	return fmt.Sprintf(`{"hits":{"total":{"value":%d,"relation":"eq"},"hits":[%s]},"status":200}`, total, strings.Join(hits, ","))
+}
+
+func TestFindAllConceptsByTypes(t *testing.T) {
+	searches := make(map[string]string)
+	s := newStubbedService(t, newTypeListingESStub(t, map[string]string{
+		"genres": typeListingHits(2, "Analysis", "Opinion"),
+		"brands": typeListingHits(120, "Lex"),
+	}, searches))
+
+	groups, err := s.FindAllConceptsByTypes(context.Background(), []string{"http://www.ft.com/ontology/product/Brand", "http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/product/Brand"}, false, false, false, nil, nil)
+
+	require.NoError(t, err)
+	require.Len(t, groups, 2, "the types should be deduplicated")
+	assert.Equal(t, "http://www.ft.com/ontology/product/Brand", groups[0].Type)
+	assert.Equal(t, int64(120), groups[0].Total)
+	require.Len(t, groups[0].Concepts, 1)
+	assert.Equal(t, "http://www.ft.com/ontology/Genre", groups[1].Type)
+	require.Len(t, groups[1].Concepts, 2)
+	assert.Equal(t, "Analysis", groups[1].Concepts[0].PrefLabel)
+	assert.Equal(t, "Opinion", groups[1].Concepts[1].PrefLabel)
+	assert.Empty(t, groups[0].Next, "a partial page should be the last one")
+	assert.Empty(t, groups[1].Next)
+
+	for esType, search := range searches {
+		assert.Contains(t, search, `"sort":[{"prefLabel.raw":{"order":"asc"}},{"_id":{"order":"asc"}}]`, "the %v should be sorted by elasticsearch", esType)
+		assert.NotContains(t, search, "search_after", "the first page of the %v should be listed", esType)
+	}
+}
+
+func TestFindAllConceptsByTypesPages(t *testing.T) {
+	var labels []string
+	for i := 0; i < 50; i++ {
+		labels = append(labels, fmt.Sprintf("Brand %02d", i))
+	}
+	searches := make(map[string]string)
+	s := newStubbedService(t, newTypeListingESStub(t, map[string]string{
+		"genres": typeListingHits(2, "Analysis", "Opinion"),
+		"brands": typeListingHits(120, labels...),
+	}, searches))
+	types := []string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/product/Brand"}
+
+	groups, err := s.FindAllConceptsByTypes(context.Background(), types, false, false, false, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Empty(t, groups[0].Next)
+	require.NotEmpty(t, groups[1].Next, "a full page should have a next one")
+
+	groups, err = s.FindAllConceptsByTypes(context.Background(), types, false, false, false, nil, []string{groups[1].Next})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Contains(t, searches["brands"], `"search_after":["Brand 49","49"]`, "the next page should be listed after the last brand")
+	assert.NotContains(t, searches["genres"], "search_after", "the other types should be listed from their first page")
+}
+
+func TestFindAllConceptsByTypesInvalidCursor(t *testing.T) {
+	s := NewEsConceptSearchService("concept", "all-concepts", 50, 10, 10)
+	types := []string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/product/Brand"}
+
+	tests := map[string][]string{
+		"malformed":          {"not a cursor"},
+		"unexpected values":  {encodeCursor("http://www.ft.com/ontology/Genre", []interface{}{"Opinion"})},
+		"type not listed":    {encodeCursor("http://www.ft.com/ontology/Topic", []interface{}{"Brexit", "1"})},
+		"duplicated on type": {encodeCursor("http://www.ft.com/ontology/Genre", []interface{}{"Analysis", "1"}), encodeCursor("http://www.ft.com/ontology/Genre", []interface{}{"Opinion", "2"})},
+	}
+	for name, cursors := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.FindAllConceptsByTypes(context.Background(), types, false, false, false, nil, cursors)
+
+			require.Error(t, err)
+			assert.IsType(t, util.InputError{}, err)
+		})
+	}
+}
+
+func TestFindAllConceptsByTypesFailingType(t *testing.T) {
+	s := newStubbedService(t, newTypeListingESStub(t, map[string]string{
+		"genres": typeListingHits(1, "Opinion"),
+		"brands": `{"error":{"type":"search_phase_execution_exception","reason":"all shards failed"},"status":500}`,
+	}, nil))
+
+	_, err := s.FindAllConceptsByTypes(context.Background(), []string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/product/Brand"}, false, false, false, nil, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http://www.ft.com/ontology/product/Brand")
+	assert.Contains(t, err.Error(), "all shards failed")
+}
+
+func TestFindAllConceptsByTypesInvalidType(t *testing.T) {
+	s := NewEsConceptSearchService("concept", "all-concepts", 50, 10, 10)
+
+	_, err := s.FindAllConceptsByTypes(context.Background(), []string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/Foo"}, false, false, false, nil, nil)
+
+	assert.Error(t, err)
+}
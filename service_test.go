@@ -6,26 +6,27 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"testing"
+	"time"
 
 	"log"
 
+	"github.com/Financial-Times/concept-search-api/service"
 	"github.com/olivere/elastic/v7"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConceptFinder(t *testing.T) {
 
 	testCases := []struct {
-		client        esClient
+		client        http.Handler
 		returnCode    int
 		requestURL    string
 		requestBody   string
@@ -137,17 +138,14 @@ func TestConceptFinder(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		conceptFinder := &esConceptFinder{
-			defaultIndex:      "concept",
-			searchResultLimit: 50,
-			lockClient:        &sync.RWMutex{},
-		}
-		conceptFinder.client = testCase.client
+		search, closeStub := newStubbedSearchService(t, testCase.client)
+		conceptFinder := newConceptFinder(search)
 
 		req, _ := http.NewRequest("POST", testCase.requestURL, strings.NewReader(testCase.requestBody))
 		w := httptest.NewRecorder()
 
 		conceptFinder.FindConcept(w, req)
+		closeStub()
 
 		assert.Equal(t, testCase.returnCode, w.Code, "Expected return code %d but got %d", testCase.returnCode, w.Code)
 		if testCase.returnCode != http.StatusOK {
@@ -182,11 +180,28 @@ func TestConceptFinder(t *testing.T) {
 	}
 }
 
+func TestConceptFinderFailsFastWithOpenCircuitBreaker(t *testing.T) {
+	search, closeStub := newStubbedSearchService(t, failClient{})
+	defer closeStub()
+	search.SetCircuitBreaker(service.NewCircuitBreaker(2, time.Minute, 1))
+	conceptFinder := newConceptFinder(search)
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", defaultRequestURL, strings.NewReader(validRequestBody))
+		w := httptest.NewRecorder()
+		conceptFinder.FindConcept(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable}, codes)
+}
+
 func TestConceptFinderForBestMatch(t *testing.T) {
 
 	testCases := []struct {
 		testName            string
-		client              esClient
+		client              http.Handler
 		returnCode          int
 		requestURL          string
 		requestBody         string
@@ -318,6 +333,54 @@ func TestConceptFinderForBestMatch(t *testing.T) {
 				}
 			},
 		},
+		{
+			testName:    "InvalidBestMatchLimit",
+			client:      mockClient{},
+			returnCode:  http.StatusBadRequest,
+			requestURL:  defaultRequestURL,
+			requestBody: `{"bestMatchTerms":["testTerm"], "bestMatchLimit": 0}`,
+		},
+		{
+			testName:    "BestMatchLimitAboveResultLimit",
+			client:      mockClient{},
+			returnCode:  http.StatusBadRequest,
+			requestURL:  defaultRequestURL,
+			requestBody: `{"bestMatchTerms":["testTerm"], "bestMatchLimit": 51}`,
+		},
+		{
+			testName:    "NegativeMinScore",
+			client:      mockClient{},
+			returnCode:  http.StatusBadRequest,
+			requestURL:  defaultRequestURL,
+			requestBody: `{"bestMatchTerms":["testTerm"], "minScore": -1}`,
+		},
+		{
+			testName: "TopCandidates",
+			client: mockClient{
+				queryResponse: validResponseBestMatch,
+			},
+			returnCode:  http.StatusOK,
+			requestURL:  defaultRequestURL,
+			requestBody: `{"bestMatchTerms":["Adam Samson", "Eric Platt", "Michael Hunter"], "conceptTypes": ["http://www.ft.com/ontology/person/Person"], "bestMatchLimit": 2}`,
+			expectedUUIDs: map[string][]string{
+				"Adam Samson": {
+					"f758ef56-c40a-3162-91aa-3e8a3aabc494",
+				},
+				"Eric Platt": {
+					"40281396-8369-4699-ae48-1ccc0c931a72",
+					"64302452-e369-4ddb-88fa-9adc5124a38c",
+				},
+				"Michael Hunter": {
+					"9332270e-f959-3f55-9153-d30acd0d0a51",
+				},
+			},
+			extraAssertionLogic: func(t *testing.T, searchResults map[string][]concept) {
+				assert.Len(t, searchResults["Eric Platt"], 2, "expected both candidates for Eric Platt")
+				assert.Equal(t, 16.62907, searchResults["Eric Platt"][0].Score)
+				assert.Equal(t, 16.264492, searchResults["Eric Platt"][1].Score)
+				assert.Equal(t, 16.835419, searchResults["Adam Samson"][0].Score)
+			},
+		},
 		{
 			testName: "IncludeFtAuthorQueryParam",
 			client: mockClient{
@@ -358,17 +421,14 @@ func TestConceptFinderForBestMatch(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		conceptFinder := &esConceptFinder{
-			defaultIndex:      "concept",
-			searchResultLimit: 50,
-			lockClient:        &sync.RWMutex{},
-		}
-		conceptFinder.client = testCase.client
+		search, closeStub := newStubbedSearchService(t, testCase.client)
+		conceptFinder := newConceptFinder(search)
 
 		req, _ := http.NewRequest("POST", testCase.requestURL, strings.NewReader(testCase.requestBody))
 		w := httptest.NewRecorder()
 
 		conceptFinder.FindConcept(w, req)
+		closeStub()
 
 		assert.Equal(t, testCase.returnCode, w.Code, "%s -> Expected return code %d but got %d", testCase.testName, testCase.returnCode, w.Code)
 		if testCase.returnCode != http.StatusOK {
@@ -394,6 +454,119 @@ func TestConceptFinderForBestMatch(t *testing.T) {
 	}
 }
 
+func TestConceptFinderForBestMatchWithStatus(t *testing.T) {
+	testCases := []struct {
+		testName         string
+		client           http.Handler
+		requestURL       string
+		returnCode       int
+		expectedStatuses map[string]string
+	}{
+		{
+			testName:         "AllTermsSearched",
+			client:           mockClient{queryResponse: validResponseBestMatchPartialResults},
+			requestURL:       defaultRequestURL + "?include_status=true",
+			returnCode:       http.StatusOK,
+			expectedStatuses: map[string]string{"Adam Samson": "found", "Eric Platt": "notFound", "Michael Hunter": "found"},
+		},
+		{
+			testName:         "NoTermFound",
+			client:           mockClient{queryResponse: validResponseBestMatchNoResults},
+			requestURL:       defaultRequestURL + "?include_status=true",
+			returnCode:       http.StatusOK,
+			expectedStatuses: map[string]string{"Adam Samson": "notFound", "Eric Platt": "notFound", "Michael Hunter": "notFound"},
+		},
+		{
+			testName:         "SomeTermsFailed",
+			client:           mockClient{queryResponse: validResponseBestMatchPartialErrors},
+			requestURL:       defaultRequestURL + "?include_status=true",
+			returnCode:       http.StatusMultiStatus,
+			expectedStatuses: map[string]string{"Adam Samson": "found", "Eric Platt": "error", "Michael Hunter": "notFound"},
+		},
+		{
+			testName:         "AllTermsFailed",
+			client:           mockClient{queryResponse: validResponseBestMatchAllErrors},
+			requestURL:       defaultRequestURL + "?include_status=true",
+			returnCode:       http.StatusInternalServerError,
+			expectedStatuses: map[string]string{"Adam Samson": "error", "Eric Platt": "error", "Michael Hunter": "error"},
+		},
+		{
+			testName:   "SomeTermsFailedWithoutStatus",
+			client:     mockClient{queryResponse: validResponseBestMatchPartialErrors},
+			requestURL: defaultRequestURL,
+			returnCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		search, closeStub := newStubbedSearchService(t, testCase.client)
+		conceptFinder := newConceptFinder(search)
+
+		req, _ := http.NewRequest("POST", testCase.requestURL, strings.NewReader(`{"bestMatchTerms":["Adam Samson", "Eric Platt", "Michael Hunter"], "conceptTypes": ["http://www.ft.com/ontology/person/Person"]}`))
+		w := httptest.NewRecorder()
+
+		conceptFinder.FindConcept(w, req)
+		closeStub()
+
+		assert.Equal(t, testCase.returnCode, w.Code, "%s -> http status", testCase.testName)
+		if testCase.expectedStatuses == nil {
+			continue
+		}
+
+		var searchResults map[string]bestMatchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &searchResults), "%s -> response body", testCase.testName)
+		require.Len(t, searchResults, len(testCase.expectedStatuses), "%s -> different no. of results", testCase.testName)
+		for term, expectedStatus := range testCase.expectedStatuses {
+			result := searchResults[term]
+			assert.Equal(t, expectedStatus, result.Status, "%s -> status of %s", testCase.testName, term)
+			assert.NotNil(t, result.Concepts, "%s -> concepts of %s", testCase.testName, term)
+			assert.Equal(t, expectedStatus == "found", len(result.Concepts) == 1, "%s -> concepts of %s", testCase.testName, term)
+			assert.Equal(t, expectedStatus == "error", result.Error != "", "%s -> error of %s", testCase.testName, term)
+		}
+	}
+}
+
+// The term search response has to stay byte for byte the same as before the search moved to the service package
+func TestConceptFinderResponseIsByteCompatible(t *testing.T) {
+	search, closeStub := newStubbedSearchService(t, mockClient{queryResponse: validResponse})
+	defer closeStub()
+
+	req, _ := http.NewRequest("POST", requestURLWithScore, strings.NewReader(validRequestBody))
+	w := httptest.NewRecorder()
+	newConceptFinder(search).FindConcept(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, expectedTermSearchBody+"\n", w.Body.String())
+}
+
+const expectedTermSearchBody = `{"results":[{"id":"http://api.ft.com/things/9a0dd8b8-2ae4-34ca-8639-cfef69711eb9","uuid":"9a0dd8b8-2ae4-34ca-8639-cfef69711eb9","apiUrl":"http://api.ft.com/organisations/9a0dd8b8-2ae4-34ca-8639-cfef69711eb9","prefLabel":"Foobar SpA","types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation","http://www.ft.com/ontology/company/Company","http://www.ft.com/ontology/company/PublicCompany"],"directType":"http://www.ft.com/ontology/company/PublicCompany","aliases":["Foobar SpA"],"score":9.992676,"countryCode":"CA","countryOfIncorporation":"US"},{"id":"http://api.ft.com/things/6084734d-f4c2-3375-b298-dbbc6c00a680","uuid":"6084734d-f4c2-3375-b298-dbbc6c00a680","apiUrl":"http://api.ft.com/organisations/6084734d-f4c2-3375-b298-dbbc6c00a680","prefLabel":"Foobar GmbH","types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"directType":"http://www.ft.com/ontology/organisation/Organisation","aliases":["Foobar GMBH"],"score":2.68152}]}`
+
+func TestConceptFinderSendsBestMatchLimitAndMinScoreToES(t *testing.T) {
+	var msearchBody string
+	stub := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		msearchBody = string(body)
+		mockClient{queryResponse: validResponseBestMatch}.ServeHTTP(w, r)
+	})
+	search, closeStub := newStubbedSearchService(t, stub)
+	defer closeStub()
+
+	req, _ := http.NewRequest("POST", defaultRequestURL, strings.NewReader(`{"bestMatchTerms":["Adam Samson", "Eric Platt", "Michael Hunter"], "bestMatchLimit": 3, "minScore": 12.5}`))
+	w := httptest.NewRecorder()
+	newConceptFinder(search).FindConcept(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(msearchBody), "\n")
+	require.Len(t, lines, 6, "a header and a body line for every term")
+	for i := 1; i < len(lines); i += 2 {
+		var source map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &source))
+		assert.Equal(t, 3.0, source["size"], "size of the best match search")
+		assert.Equal(t, 12.5, source["min_score"], "min score of the best match search")
+	}
+}
+
 // during concept deprecation story an issue was encountered during calling FindConcept.
 // The filtering was applied in a way that the data was returned even when the query did not match the doc.
 func TestEsQueryScore(t *testing.T) {
@@ -421,8 +594,9 @@ func TestEsQueryScore(t *testing.T) {
 	// prepare request and trigger this
 	req, _ := http.NewRequest("POST", "http://dummy_host/concepts?include_score=true", strings.NewReader(`{"term": "Anna"}`))
 	w := httptest.NewRecorder()
-	conceptFinder := newConceptFinder(filterScoreTestingIndexName, "", 10)
-	conceptFinder.SetElasticClient(ec)
+	search := service.NewEsConceptSearchService(filterScoreTestingIndexName, "", 10, 10, 10)
+	search.SetElasticClient(ec)
+	conceptFinder := newConceptFinder(search)
 	conceptFinder.FindConcept(w, req)
 
 	// check
@@ -469,8 +643,9 @@ func TestEsBestMatchImpl(t *testing.T) {
 			"conceptTypes": ["http://www.ft.com/ontology/person/Person"]
 		}`))
 	w := httptest.NewRecorder()
-	conceptFinder := newConceptFinder(bestMatchIndexName, "", 10)
-	conceptFinder.SetElasticClient(ec)
+	search := service.NewEsConceptSearchService(bestMatchIndexName, "", 10, 10, 10)
+	search.SetElasticClient(ec)
+	conceptFinder := newConceptFinder(search)
 	conceptFinder.FindConcept(w, req)
 
 	// check
@@ -604,44 +779,47 @@ func createIndex(ec *elastic.Client, mappingFile string, indexName string) error
 	return nil
 }
 
-type failClient struct{}
+// newStubbedSearchService returns a search service connected to an elasticsearch stub, which serves the given handler.
+// A nil handler leaves the service without any elasticsearch client.
+func newStubbedSearchService(t *testing.T, stub http.Handler) (service.ConceptSearchService, func()) {
+	search := service.NewEsConceptSearchService("concept", "", 50, 1000, 10)
+	if stub == nil {
+		return search, func() {}
+	}
 
-func (tc failClient) query(indexName string, query elastic.Query, resultLimit int) (*elastic.SearchResult, error) {
-	return &elastic.SearchResult{}, errors.New("Test ES failure")
+	server := httptest.NewServer(stub)
+	ec, err := elastic.NewClient(
+		elastic.SetURL(server.URL),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	require.NoError(t, err, "expected no error for ES client")
+	search.SetElasticClient(ec)
+	return search, server.Close
 }
 
-func (tc failClient) multiSearchQuery(indexName string, searchRequests ...*elastic.SearchRequest) (*elastic.MultiSearchResult, error) {
-	return &elastic.MultiSearchResult{}, errors.New("Test ES failure")
-}
+// failClient is an elasticsearch stub failing every request
+type failClient struct{}
 
-func (tc failClient) getClusterHealth() (*elastic.ClusterHealthResponse, error) {
-	return &elastic.ClusterHealthResponse{}, errors.New("Test ES failure")
+func (fc failClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(`{"error":{"type":"test_failure","reason":"Test ES failure"},"status":500}`))
 }
 
+// mockClient is an elasticsearch stub answering every search or multi search request with the canned query response
 type mockClient struct {
 	queryResponse string
 }
 
-func (mc mockClient) query(indexName string, query elastic.Query, resultLimit int) (*elastic.SearchResult, error) {
-	var searchResult elastic.SearchResult
-	err := json.Unmarshal([]byte(mc.queryResponse), &searchResult)
-	if err != nil {
-		log.Printf("%v \n", err.Error())
+func (mc mockClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/_search") && !strings.HasSuffix(r.URL.Path, "/_msearch") {
+		log.Printf("unexpected request to the ES stub: %v %v\n", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
-	return &searchResult, nil
-}
-
-func (mc mockClient) multiSearchQuery(indexName string, searchRequests ...*elastic.SearchRequest) (*elastic.MultiSearchResult, error) {
-	var searchResult elastic.MultiSearchResult
-	err := json.Unmarshal([]byte(mc.queryResponse), &searchResult)
-	if err != nil {
-		log.Printf("%v \n", err.Error())
-	}
-	return &searchResult, nil
-}
-
-func (mc mockClient) getClusterHealth() (*elastic.ClusterHealthResponse, error) {
-	return &elastic.ClusterHealthResponse{}, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(mc.queryResponse))
 }
 
 const (
@@ -1341,3 +1519,58 @@ var validResponseBestMatchNoResults = `{
         }
     ]
 }`
+
+var validResponseBestMatchPartialErrors = `{
+    "responses": [
+        {
+            "took": 2,
+            "timed_out": false,
+            "hits": {
+                "total": {"value": 1, "relation": "eq"},
+                "max_score": 16.835419,
+                "hits": [
+                    {
+                        "_index": "concepts",
+                        "_id": "f758ef56-c40a-3162-91aa-3e8a3aabc494",
+                        "_score": 16.835419,
+                        "_source": {
+                            "id": "http://api.ft.com/things/f758ef56-c40a-3162-91aa-3e8a3aabc494",
+                            "apiUrl": "http://api.ft.com/people/f758ef56-c40a-3162-91aa-3e8a3aabc494",
+                            "prefLabel": "Adam Samson",
+                            "types": ["http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/person/Person"],
+                            "directType": "http://www.ft.com/ontology/person/Person",
+                            "aliases": ["Adam Samson"],
+                            "isFTAuthor": "true"
+                        }
+                    }
+                ]
+            },
+            "status": 200
+        },
+        {
+            "error": {
+                "type": "search_phase_execution_exception",
+                "reason": "all shards failed"
+            },
+            "status": 503
+        },
+        {
+            "took": 2,
+            "timed_out": false,
+            "hits": {
+                "total": {"value": 0, "relation": "eq"},
+                "max_score": null,
+                "hits": []
+            },
+            "status": 200
+        }
+    ]
+}`
+
+var validResponseBestMatchAllErrors = `{
+    "responses": [
+        {"error": {"type": "search_phase_execution_exception", "reason": "all shards failed"}, "status": 503},
+        {"error": {"type": "search_phase_execution_exception", "reason": "all shards failed"}, "status": 503},
+        {"error": {"type": "search_phase_execution_exception", "reason": "all shards failed"}, "status": 503}
+    ]
+}`
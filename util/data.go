@@ -4,38 +4,23 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 )
 
-const (
-	PublicCompany = "http://www.ft.com/ontology/company/PublicCompany"
-)
+const ontologyPrefix = "http://www.ft.com/ontology/"
 
 var (
 	conceptUUIDRegex = regexp.MustCompile(`[0-9a-f]{8}-([0-9a-f]{4}-){3}[0-9a-f]{12}`)
 )
 
 var (
-	esTypeMapping = map[string]string{
-		"http://www.ft.com/ontology/Genre":                     "genres",
-		"http://www.ft.com/ontology/product/Brand":             "brands",
-		"http://www.ft.com/ontology/person/Person":             "people",
-		"http://www.ft.com/ontology/organisation/Organisation": "organisations",
-		"http://www.ft.com/ontology/Location":                  "locations",
-		"http://www.ft.com/ontology/Topic":                     "topics",
-		"http://www.ft.com/ontology/AlphavilleSeries":          "alphaville-series",
-		"http://www.ft.com/ontology/SVCategory":                "sv-categories",
-		"http://www.ft.com/ontology/provision/SVProvision":     "sv-provisions",
-		"http://www.ft.com/ontology/FTABrand":                  "fta-brands",
-		"http://www.ft.com/ontology/FTAGenre":                  "fta-genres",
-		"http://www.ft.com/ontology/FTATopic":                  "fta-topics",
-	}
-
 	ErrInvalidConceptTypeFormat              = "invalid concept type %v"
 	ErrMaxIdsLimitFormat                     = "number of 'ids' parameters exceeds the limit, supplied: %v; the max number of 'ids' is %v"
 	ErrNoElasticClient                       = errors.New("no ElasticSearch client available")
-	ErrNoConceptTypeParameter                = NewInputError("no concept type specified")
-	ErrNotSupportedCombinationOfConceptTypes = NewInputError("the combination of concept types is not supported")
-	ErrInvalidBoostTypeParameter             = NewInputError("invalid boost type")
+	ErrCircuitOpen                           = errors.New("ElasticSearch is unavailable, the circuit breaker is open")
+	ErrNoConceptTypeParameter                = NewInputError(ErrCodeMissingParameter, "type", "no concept type specified")
+	ErrNotSupportedCombinationOfConceptTypes = NewInputError(ErrCodeUnsupportedTypeCombination, "type", "the combination of concept types is not supported")
+	ErrInvalidBoostTypeParameter             = NewInputError(ErrCodeInvalidBoostType, "boost", "invalid boost type")
 )
 
 func FirstError(errors ...error) error {
@@ -56,20 +41,50 @@ func ToTerms(types []string) []interface{} {
 	return i
 }
 
+// EsType returns the ES type of the FT type, or an empty string for the types which are unknown or matched on their
+// directType
 func EsType(ftType string) string {
-	return esTypeMapping[ftType]
+	t, found := GetTypeRegistry().Lookup(ftType)
+	if !found || t.DirectType {
+		return ""
+	}
+	return t.EsType
 }
 
 func FtType(esType string) string {
-	for k, v := range esTypeMapping {
-		if v == esType {
-			return k
+	for _, t := range GetTypeRegistry().Types {
+		if !t.DirectType && t.EsType == esType {
+			return t.Type
 		}
 	}
 
 	return ""
 }
 
+// TypeBoost boosts the concepts having the value in the field
+type TypeBoost struct {
+	Field string
+	Value string
+	Boost float64
+}
+
+// TypeBoosts returns the boosts configured for the concept types in the search mode
+func TypeBoosts(mode string) []TypeBoost {
+	var boosts []TypeBoost
+	for _, t := range GetTypeRegistry().Types {
+		boost, found := t.Boosts[mode]
+		if !found {
+			continue
+		}
+		if t.DirectType {
+			boosts = append(boosts, TypeBoost{Field: "directType", Value: t.Type, Boost: boost})
+		} else {
+			boosts = append(boosts, TypeBoost{Field: "type", Value: t.EsType, Boost: boost})
+		}
+	}
+	return boosts
+}
+
 func ValidateForAuthorsSearch(conceptTypes []string, boostType string) error {
 	if len(conceptTypes) == 0 {
 		return ErrNoConceptTypeParameter
@@ -78,7 +93,7 @@ func ValidateForAuthorsSearch(conceptTypes []string, boostType string) error {
 		return ErrNotSupportedCombinationOfConceptTypes
 	}
 	if EsType(conceptTypes[0]) != "people" {
-		return NewInputErrorf(ErrInvalidConceptTypeFormat, conceptTypes[0])
+		return NewInputErrorf(ErrCodeInvalidConceptType, "type", ErrInvalidConceptTypeFormat, conceptTypes[0])
 	}
 	if boostType != "authors" {
 		return ErrInvalidBoostTypeParameter
@@ -86,37 +101,58 @@ func ValidateForAuthorsSearch(conceptTypes []string, boostType string) error {
 	return nil
 }
 
-func ValidateAndConvertToEsTypes(conceptTypes []string) ([]string, bool, error) {
+// ValidateAndConvertToEsTypes returns the ES types of the concept types, along with the concept types which are matched
+// on their directType
+func ValidateAndConvertToEsTypes(conceptTypes []string) ([]string, []string, error) {
 	esTypes := make([]string, len(conceptTypes))
-	isPublicCompany := false
+	var directTypes []string
 
+	registry := GetTypeRegistry()
 	for _, t := range conceptTypes {
-		if t == PublicCompany {
-			isPublicCompany = true
-			continue
+		conceptType, found := registry.Lookup(t)
+		if !found {
+			return esTypes, nil, NewInputErrorf(ErrCodeInvalidConceptType, "type", ErrInvalidConceptTypeFormat, t)
 		}
-		esT := EsType(t)
-		if esT == "" {
-			return esTypes, false, NewInputErrorf(ErrInvalidConceptTypeFormat, t)
+		if conceptType.DirectType {
+			directTypes = append(directTypes, t)
+			continue
 		}
-		esTypes = append(esTypes, esT)
+		esTypes = append(esTypes, conceptType.EsType)
 	}
-	return esTypes, isPublicCompany, nil
+	return esTypes, directTypes, nil
 }
 
-func ValidateConceptTypesForTextModeSearch(conceptTypes []string) error {
-	validConceptTypesForTextMode := []string{"http://www.ft.com/ontology/organisation/Organisation", "http://www.ft.com/ontology/company/PublicCompany"}
+// ValidateOntologyTypes checks that the concept types are classes of the FT ontology, which need not be in the type
+// registry as they are matched on the ancestry of the concepts
+func ValidateOntologyTypes(conceptTypes []string) error {
+	for _, t := range conceptTypes {
+		if !strings.HasPrefix(t, ontologyPrefix) || len(t) == len(ontologyPrefix) {
+			return NewInputErrorf(ErrCodeInvalidConceptType, "type", ErrInvalidConceptTypeFormat, t)
+		}
+	}
+	return nil
+}
 
-	for _, conceptType := range conceptTypes {
-		contains, err := contains(validConceptTypesForTextMode, conceptType)
-		if err != nil {
-			return err
+// ValidateConceptTypesForSearchMode checks that all the known concept types can be searched in the search mode
+func ValidateConceptTypesForSearchMode(conceptTypes []string) error {
+	registry := GetTypeRegistry()
+	for _, t := range conceptTypes {
+		if conceptType, found := registry.Lookup(t); found && !conceptType.SupportsMode(ModeSearch) {
+			return NewInputErrorf(ErrCodeInvalidConceptType, "type", "concept type %v does not support the search mode", t)
 		}
-		if contains {
+	}
+	return nil
+}
+
+// ValidateConceptTypesForTextModeSearch checks that at least one of the concept types can be searched in the text mode
+func ValidateConceptTypesForTextModeSearch(conceptTypes []string) error {
+	registry := GetTypeRegistry()
+	for _, t := range conceptTypes {
+		if conceptType, found := registry.Lookup(t); found && conceptType.SupportsMode(ModeText) {
 			return nil
 		}
 	}
-	return NewInputError("invalid or missing parameters for concept search (text mode but no organisation or public company type)")
+	return NewInputError(ErrCodeInvalidConceptType, "type", "invalid or missing parameters for concept search (text mode but no type supporting it)")
 }
 
 func ExtractUUID(id string) (string, error) {
@@ -126,19 +162,3 @@ func ExtractUUID(id string) (string, error) {
 	}
 	return uuid, nil
 }
-
-type InputError struct {
-	msg string
-}
-
-func (e InputError) Error() string {
-	return e.msg
-}
-
-func NewInputError(msg string) InputError {
-	return InputError{msg}
-}
-
-func NewInputErrorf(format string, args ...interface{}) InputError {
-	return InputError{fmt.Sprintf(format, args...)}
-}
@@ -86,29 +86,29 @@ func TestValidateAuthors(t *testing.T) {
 }
 
 func TestValidateEsTypesNoError(t *testing.T) {
-	res, isPublicCompany, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/person/Person"})
+	res, directTypes, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/person/Person"})
 	assert.NoError(t, err)
 	assert.Len(t, res, 2)
 	assert.Equal(t, "", res[0])
 	assert.Equal(t, "people", res[1])
-	assert.Equal(t, false, isPublicCompany)
+	assert.Empty(t, directTypes)
 }
 
 func TestValidateEsTypesReturnError(t *testing.T) {
-	_, isPublicCompany, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/Foo", "http://www.ft.com/ontology/person/Person"})
+	_, directTypes, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/Foo", "http://www.ft.com/ontology/person/Person"})
 	assert.Contains(t, err.Error(), "http://www.ft.com/ontology/Foo")
-	assert.Equal(t, false, isPublicCompany)
+	assert.Empty(t, directTypes)
 }
 
 func TestValidateEsTypesWithPublicCompany(t *testing.T) {
-	res, isPublicCompany, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/person/Person", "http://www.ft.com/ontology/company/PublicCompany"})
+	res, directTypes, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/person/Person", "http://www.ft.com/ontology/company/PublicCompany"})
 	fmt.Printf("%v", res)
 	assert.NoError(t, err)
 	assert.Len(t, res, 3)
 	assert.Equal(t, "", res[0])
 	assert.Equal(t, "", res[1])
 	assert.Equal(t, "people", res[2])
-	assert.Equal(t, true, isPublicCompany)
+	assert.Equal(t, []string{"http://www.ft.com/ontology/company/PublicCompany"}, directTypes)
 }
 
 func TestValidateConceptTypesForTextModeSearch(t *testing.T) {
@@ -123,3 +123,10 @@ func TestValidateConceptTypesForTextModeSearch(t *testing.T) {
 	assert.Error(t, ValidateConceptTypesForTextModeSearch(invalidConceptTypes1))
 	assert.Error(t, ValidateConceptTypesForTextModeSearch(invalidConceptTypes2))
 }
+
+func TestValidateOntologyTypes(t *testing.T) {
+	assert.NoError(t, ValidateOntologyTypes([]string{"http://www.ft.com/ontology/company/Company", "http://www.ft.com/ontology/person/Person"}))
+
+	assert.Error(t, ValidateOntologyTypes([]string{"http://www.ft.com/ontology/company/Company", "Company"}))
+	assert.Error(t, ValidateOntologyTypes([]string{"http://www.ft.com/ontology/"}))
+}
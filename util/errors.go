@@ -0,0 +1,109 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+)
+
+// Machine-readable error codes returned in the body of every error response
+const (
+	ErrCodeInvalidParameter           = "INVALID_PARAMETER"
+	ErrCodeMissingParameter           = "MISSING_PARAMETER"
+	ErrCodeInvalidConceptType         = "INVALID_CONCEPT_TYPE"
+	ErrCodeUnsupportedTypeCombination = "UNSUPPORTED_TYPE_COMBINATION"
+	ErrCodeInvalidBoostType           = "INVALID_BOOST_TYPE"
+	ErrCodeIdsLimitExceeded           = "IDS_LIMIT_EXCEEDED"
+	ErrCodeInvalidRequestBody         = "INVALID_REQUEST_BODY"
+	ErrCodeNotAcceptable              = "NOT_ACCEPTABLE"
+	ErrCodeUnauthorized               = "UNAUTHORIZED"
+	ErrCodeNotFound                   = "NOT_FOUND"
+	ErrCodeConflict                   = "CONFLICT"
+	ErrCodeESUnavailable              = "ES_UNAVAILABLE"
+	ErrCodeInternal                   = "INTERNAL_ERROR"
+)
+
+// CodedError is an error which knows its error code and, optionally, the request parameter which caused it
+type CodedError interface {
+	error
+	Code() string
+	Parameter() string
+}
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	Parameter     string `json:"parameter,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+type InputError struct {
+	code  string
+	param string
+	msg   string
+}
+
+func (e InputError) Error() string {
+	return e.msg
+}
+
+func (e InputError) Code() string {
+	return e.code
+}
+
+func (e InputError) Parameter() string {
+	return e.param
+}
+
+func NewInputError(code string, param string, msg string) InputError {
+	return InputError{code: code, param: param, msg: msg}
+}
+
+func NewInputErrorf(code string, param string, format string, args ...interface{}) InputError {
+	return InputError{code: code, param: param, msg: fmt.Sprintf(format, args...)}
+}
+
+// NewErrorResponse builds the error response for the given error. The code and the parameter are taken from the error
+// if it is a CodedError, otherwise the code is derived from the response status.
+func NewErrorResponse(req *http.Request, status int, err error) ErrorResponse {
+	response := ErrorResponse{
+		Code:          codeForStatus(status),
+		Message:       err.Error(),
+		TransactionID: transactionidutils.GetTransactionIDFromRequest(req),
+	}
+	if coded, ok := err.(CodedError); ok {
+		response.Code = coded.Code()
+		response.Parameter = coded.Parameter()
+	} else if err == ErrNoElasticClient || err == ErrCircuitOpen {
+		response.Code = ErrCodeESUnavailable
+	}
+	return response
+}
+
+func WriteHTTPError(w http.ResponseWriter, req *http.Request, status int, err error) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(NewErrorResponse(req, status, err))
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidParameter
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusNotAcceptable:
+		return ErrCodeNotAcceptable
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusServiceUnavailable:
+		return ErrCodeESUnavailable
+	default:
+		return ErrCodeInternal
+	}
+}
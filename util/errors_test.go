@@ -0,0 +1,41 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrorResponseFromInputError(t *testing.T) {
+	req, _ := http.NewRequest("GET", httpTestBasePath, nil)
+	req.Header.Set("X-Request-Id", "tid_test")
+
+	resp := NewErrorResponse(req, http.StatusBadRequest, NewInputError(ErrCodeIdsLimitExceeded, "ids", "too many ids"))
+
+	assert.Equal(t, ErrorResponse{Code: ErrCodeIdsLimitExceeded, Message: "too many ids", Parameter: "ids", TransactionID: "tid_test"}, resp)
+}
+
+func TestNewErrorResponseCodeDerivedFromStatus(t *testing.T) {
+	req, _ := http.NewRequest("GET", httpTestBasePath, nil)
+
+	assert.Equal(t, ErrCodeNotFound, NewErrorResponse(req, http.StatusNotFound, errors.New("no concepts")).Code)
+	assert.Equal(t, ErrCodeUnauthorized, NewErrorResponse(req, http.StatusUnauthorized, errors.New("missing or invalid API key")).Code)
+	assert.Equal(t, ErrCodeInternal, NewErrorResponse(req, http.StatusInternalServerError, errors.New("boom")).Code)
+	assert.Equal(t, ErrCodeESUnavailable, NewErrorResponse(req, http.StatusInternalServerError, ErrNoElasticClient).Code)
+	assert.Equal(t, ErrCodeESUnavailable, NewErrorResponse(req, http.StatusInternalServerError, ErrCircuitOpen).Code)
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	req, _ := http.NewRequest("GET", httpTestBasePath, nil)
+	req.Header.Set("X-Request-Id", "tid_test")
+	w := httptest.NewRecorder()
+
+	WriteHTTPError(w, req, http.StatusBadRequest, ErrNoConceptTypeParameter)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code":"MISSING_PARAMETER","message":"no concept type specified","parameter":"type","transactionId":"tid_test"}`, w.Body.String())
+}
@@ -1,7 +1,6 @@
 package util
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 )
@@ -9,7 +8,7 @@ import (
 func GetSingleValueQueryParameter(req *http.Request, param string, allowed ...string) (string, bool, error) {
 	values, found := GetMultipleValueQueryParameter(req, param)
 	if len(values) > 1 {
-		return "", found, fmt.Errorf("specified multiple %v query parameters in the URL", param)
+		return "", found, NewInputErrorf(ErrCodeInvalidParameter, param, "specified multiple %v query parameters in the URL", param)
 	}
 	if len(values) < 1 {
 		return "", found, nil
@@ -23,7 +22,7 @@ func GetSingleValueQueryParameter(req *http.Request, param string, allowed ...st
 			}
 		}
 
-		return "", found, fmt.Errorf("'%s' is not a valid value for parameter '%s'", v, param)
+		return "", found, NewInputErrorf(ErrCodeInvalidParameter, param, "'%s' is not a valid value for parameter '%s'", v, param)
 	}
 
 	return v, found, nil
@@ -37,7 +36,7 @@ func GetBoolQueryParameter(req *http.Request, param string, defaultVal bool) (bo
 
 	boolVal, err := strconv.ParseBool(val)
 	if err != nil {
-		return defaultVal, false, err
+		return defaultVal, false, NewInputError(ErrCodeInvalidParameter, param, err.Error())
 	}
 
 	return boolVal, true, nil
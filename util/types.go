@@ -0,0 +1,126 @@
+package util
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// The search modes a concept type can be searched in
+const (
+	ModeSearch = "search"
+	ModeText   = "text"
+)
+
+//go:embed concept-types.json
+var defaultTypeRegistryConfig []byte
+
+var (
+	typeRegistry     = mustParseTypeRegistry(defaultTypeRegistryConfig)
+	typeRegistryLock = &sync.RWMutex{}
+)
+
+// ConceptType describes how concepts of an FT ontology type are searched
+type ConceptType struct {
+	Type string `json:"type"`
+	// EsType is the value of the type field of the concepts in ES
+	EsType string `json:"esType,omitempty"`
+	// DirectType tells that the concepts are matched on their directType rather than on their ES type
+	DirectType bool               `json:"directType,omitempty"`
+	Modes      []string           `json:"modes"`
+	Boosts     map[string]float64 `json:"boosts,omitempty"`
+}
+
+// SupportsMode tells whether the type can be searched in the mode
+func (t ConceptType) SupportsMode(mode string) bool {
+	for _, m := range t.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeRegistry is the set of concept types known to the API, in the order of its configuration
+type TypeRegistry struct {
+	Types  []ConceptType `json:"types"`
+	byType map[string]ConceptType
+}
+
+// LoadTypeRegistry reads the type registry from the JSON file at the path
+func LoadTypeRegistry(path string) (*TypeRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := parseTypeRegistry(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type registry %v: %w", path, err)
+	}
+	return registry, nil
+}
+
+// SetTypeRegistry replaces the type registry used to validate and convert concept types
+func SetTypeRegistry(registry *TypeRegistry) {
+	typeRegistryLock.Lock()
+	defer typeRegistryLock.Unlock()
+	typeRegistry = registry
+}
+
+// GetTypeRegistry returns the type registry currently in use
+func GetTypeRegistry() *TypeRegistry {
+	typeRegistryLock.RLock()
+	defer typeRegistryLock.RUnlock()
+	return typeRegistry
+}
+
+// Lookup returns the configuration of the FT type
+func (r *TypeRegistry) Lookup(ftType string) (ConceptType, bool) {
+	t, found := r.byType[ftType]
+	return t, found
+}
+
+func mustParseTypeRegistry(data []byte) *TypeRegistry {
+	registry, err := parseTypeRegistry(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default type registry: %v", err))
+	}
+	return registry
+}
+
+func parseTypeRegistry(data []byte) (*TypeRegistry, error) {
+	registry := &TypeRegistry{}
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, err
+	}
+	if len(registry.Types) == 0 {
+		return nil, fmt.Errorf("no concept types configured")
+	}
+
+	registry.byType = make(map[string]ConceptType, len(registry.Types))
+	for _, t := range registry.Types {
+		if t.Type == "" {
+			return nil, fmt.Errorf("concept type without a type")
+		}
+		if _, found := registry.byType[t.Type]; found {
+			return nil, fmt.Errorf("concept type %v configured more than once", t.Type)
+		}
+		if t.EsType == "" && !t.DirectType {
+			return nil, fmt.Errorf("concept type %v needs either an esType or to be matched on its directType", t.Type)
+		}
+		for _, mode := range t.Modes {
+			if mode != ModeSearch && mode != ModeText {
+				return nil, fmt.Errorf("unknown mode %v for concept type %v", mode, t.Type)
+			}
+		}
+		for mode := range t.Boosts {
+			if !t.SupportsMode(mode) {
+				return nil, fmt.Errorf("boost for the %v mode which concept type %v does not support", mode, t.Type)
+			}
+		}
+		registry.byType[t.Type] = t
+	}
+	return registry, nil
+}
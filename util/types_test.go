@@ -0,0 +1,97 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTypeRegistryConfig = `{
+  "types": [
+    {"type": "http://www.ft.com/ontology/Genre", "esType": "genres", "modes": ["search"]},
+    {"type": "http://www.ft.com/ontology/Podcast", "esType": "podcasts", "modes": ["search", "text"], "boosts": {"search": 2}},
+    {"type": "http://www.ft.com/ontology/company/PrivateCompany", "directType": true, "modes": ["text"], "boosts": {"text": 3}}
+  ]
+}`
+
+func withTypeRegistry(t *testing.T, config string) {
+	path := filepath.Join(t.TempDir(), "types.json")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	registry, err := LoadTypeRegistry(path)
+	require.NoError(t, err)
+
+	previous := GetTypeRegistry()
+	SetTypeRegistry(registry)
+	t.Cleanup(func() { SetTypeRegistry(previous) })
+}
+
+func TestDefaultTypeRegistry(t *testing.T) {
+	registry := GetTypeRegistry()
+
+	assert.Len(t, registry.Types, 13)
+	publicCompany, found := registry.Lookup("http://www.ft.com/ontology/company/PublicCompany")
+	assert.True(t, found)
+	assert.True(t, publicCompany.DirectType)
+	assert.True(t, publicCompany.SupportsMode(ModeText))
+	assert.Equal(t, []TypeBoost{
+		{Field: "type", Value: "organisations", Boost: 5},
+		{Field: "directType", Value: "http://www.ft.com/ontology/company/PublicCompany", Boost: 5},
+	}, TypeBoosts(ModeText))
+}
+
+func TestTypesFromLoadedRegistry(t *testing.T) {
+	withTypeRegistry(t, testTypeRegistryConfig)
+
+	assert.Equal(t, "podcasts", EsType("http://www.ft.com/ontology/Podcast"))
+	assert.Equal(t, "http://www.ft.com/ontology/Podcast", FtType("podcasts"))
+	assert.Equal(t, "", EsType("http://www.ft.com/ontology/person/Person"), "type of the default registry")
+	assert.Equal(t, "", EsType("http://www.ft.com/ontology/company/PrivateCompany"), "type matched on the directType")
+
+	esTypes, directTypes, err := ValidateAndConvertToEsTypes([]string{"http://www.ft.com/ontology/Podcast", "http://www.ft.com/ontology/company/PrivateCompany"})
+	assert.NoError(t, err)
+	assert.Contains(t, esTypes, "podcasts")
+	assert.Equal(t, []string{"http://www.ft.com/ontology/company/PrivateCompany"}, directTypes)
+
+	assert.Equal(t, []TypeBoost{{Field: "type", Value: "podcasts", Boost: 2}}, TypeBoosts(ModeSearch))
+	assert.Equal(t, []TypeBoost{{Field: "directType", Value: "http://www.ft.com/ontology/company/PrivateCompany", Boost: 3}}, TypeBoosts(ModeText))
+}
+
+func TestModesFromLoadedRegistry(t *testing.T) {
+	withTypeRegistry(t, testTypeRegistryConfig)
+
+	assert.NoError(t, ValidateConceptTypesForSearchMode([]string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/Podcast"}))
+	assert.Error(t, ValidateConceptTypesForSearchMode([]string{"http://www.ft.com/ontology/company/PrivateCompany"}))
+
+	assert.NoError(t, ValidateConceptTypesForTextModeSearch([]string{"http://www.ft.com/ontology/Genre", "http://www.ft.com/ontology/Podcast"}))
+	assert.Error(t, ValidateConceptTypesForTextModeSearch([]string{"http://www.ft.com/ontology/organisation/Organisation"}))
+}
+
+func TestLoadInvalidTypeRegistry(t *testing.T) {
+	testCases := map[string]string{
+		"not json":        `types`,
+		"no types":        `{"types": []}`,
+		"no type":         `{"types": [{"esType": "genres", "modes": ["search"]}]}`,
+		"duplicate type":  `{"types": [{"type": "a", "esType": "a", "modes": ["search"]}, {"type": "a", "esType": "b", "modes": ["search"]}]}`,
+		"no es type":      `{"types": [{"type": "a", "modes": ["search"]}]}`,
+		"unknown mode":    `{"types": [{"type": "a", "esType": "a", "modes": ["fuzzy"]}]}`,
+		"unmatched boost": `{"types": [{"type": "a", "esType": "a", "modes": ["search"], "boosts": {"text": 2}}]}`,
+	}
+
+	for name, config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "types.json")
+			require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+
+			_, err := LoadTypeRegistry(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadMissingTypeRegistry(t *testing.T) {
+	_, err := LoadTypeRegistry(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}